@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 )
 
 // parseGcodeLine extracts X, Y, Z values from a Gcode line
@@ -16,9 +17,9 @@ func extractPos(gcodeLine string) (float64, float64, float64) {
 	var x, y, z float64
 	x, y, z = math.NaN(), math.NaN(), math.NaN() // Default to NaN if not found
 
-	reX := regexp.MustCompile(`X(-?\d+(\.\d+)?)`)
-	reY := regexp.MustCompile(`Y(-?\d+(\.\d+)?)`)
-	reZ := regexp.MustCompile(`Z(-?\d+(\.\d+)?)`)
+	reX := regexp.MustCompile(`X(` + number + `)`)
+	reY := regexp.MustCompile(`Y(` + number + `)`)
+	reZ := regexp.MustCompile(`Z(` + number + `)`)
 
 	if match := reX.FindStringSubmatch(gcodeLine); match != nil {
 		x, _ = strconv.ParseFloat(match[1], 64)
@@ -33,6 +34,35 @@ func extractPos(gcodeLine string) (float64, float64, float64) {
 	return x, y, z
 }
 
+// number matches a word value, including ones without a leading digit like .5
+const number = `[-+]?(?:\d+\.?\d*|\.\d+)`
+
+// DefaultSegmentLength is the longest move ApplyHeightMap leaves unsplit
+const DefaultSegmentLength = 2.0
+
+var (
+	reIgnore  = regexp.MustCompile(`(?i)\bG0*(10|28|30|38|53|92)\b`) // ignore commands with X,Y,Z that dont actually move
+	reMotion  = regexp.MustCompile(`(?i)G0*([0-3])\b`)
+	reZWord   = regexp.MustCompile(`Z` + number + `\s*`)
+	reComment = regexp.MustCompile(`\s*(;.*|\(.*\))$`)
+	reAxis    = regexp.MustCompile(`[XYZ]` + number + `\s*`)
+	reUnits   = regexp.MustCompile(`(?i)\bG2([01])\b`)
+	reDist    = regexp.MustCompile(`(?i)\bG9([01])(\.\d)?\b`) // G90.1 and G91.1 are arc centre modes
+)
+
+// mmPerInch converts the height map for G20 programs
+const mmPerInch = 25.4
+
+// Inches returns the height map converted from millimetres to inches
+func (hm HeightMap) Inches() HeightMap {
+	out := make(HeightMap, len(hm))
+	for i, p := range hm {
+		out[i] = Point{X: p.X / mmPerInch, Y: p.Y / mmPerInch, Z: p.Z / mmPerInch}
+	}
+	return out
+}
+
+// ApplyHeightMap reads a Gcode file and returns its lines with the height map applied
 func ApplyHeightMap(gcodeFile string, heightMap HeightMap) []string {
 	file, err := os.Open(gcodeFile)
 	if err != nil {
@@ -40,18 +70,63 @@ func ApplyHeightMap(gcodeFile string, heightMap HeightMap) []string {
 	}
 	defer file.Close()
 
+	lines := []string{}
 	scanner := bufio.NewScanner(file)
-	var curX, curY, curZ float64
-	// optionally, resize scanner's capacity for lines over 64K, see next example
 	for scanner.Scan() {
-		curLine := scanner.Text()
-		r := regexp.MustCompile(`(?i)^(G21|G22|G38|G10)`) // ignore commands with X,Y,Z that dont actually move
-		if curLine == "" || r.MatchString(curLine) {
-			fmt.Println(curLine)
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	out, err := ApplyHeightMapLines(lines, heightMap, DefaultSegmentLength)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return out
+}
+
+// ApplyHeightMapLines offsets the Z of every move by the height map at its XY position. G0/G1
+// moves longer than maxSeg are split so the tool follows the surface between probe points,
+// arcs only get their end point adjusted. The program must use absolute (G90) coordinates,
+// G91 is refused.
+// The height map and maxSeg are in millimetres and are converted while the program is in G20.
+func ApplyHeightMapLines(lines []string, heightMap HeightMap, maxSeg float64) ([]string, error) {
+	out := []string{}
+	var curX, curY, curZ float64
+	motion := 0
+	mmMap, mmSeg := heightMap, maxSeg
+	inchMap := heightMap.Inches()
+	digits := 3 // decimals written, one more in inches
+	for n, curLine := range lines {
+		for _, m := range reDist.FindAllStringSubmatch(reComment.ReplaceAllString(curLine, ""), -1) {
+			if m[1] == "1" && m[2] == "" {
+				return nil, fmt.Errorf("line %d: relative moves (G91) can not be levelled, convert the program with cnctools distance first", n+1)
+			}
+		}
+		if m := reUnits.FindStringSubmatch(reComment.ReplaceAllString(curLine, "")); m != nil {
+			heightMap, maxSeg, digits = mmMap, mmSeg, 3
+			if m[1] == "0" {
+				heightMap, maxSeg, digits = inchMap, mmSeg/mmPerInch, 4
+			}
+		}
+		// keep comments out of the way of the coordinate words
+		comment := reComment.FindString(curLine)
+		code := strings.TrimSuffix(curLine, comment)
+		if code == "" || reIgnore.MatchString(code) {
+			out = append(out, curLine)
 			continue
 		}
+		if m := reMotion.FindStringSubmatch(code); m != nil {
+			motion, _ = strconv.Atoi(m[1])
+		}
 
-		x, y, z := extractPos(curLine)
+		x, y, z := extractPos(code)
+		if math.IsNaN(x) && math.IsNaN(y) && math.IsNaN(z) {
+			out = append(out, curLine)
+			continue
+		}
+		prevX, prevY, prevZ := curX, curY, curZ
 		if !math.IsNaN(x) {
 			curX = x
 		}
@@ -62,20 +137,40 @@ func ApplyHeightMap(gcodeFile string, heightMap HeightMap) []string {
 			curZ = z
 		}
 
+		dist := math.Hypot(curX-prevX, curY-prevY)
+		if motion <= 1 && maxSeg > 0 && dist > maxSeg {
+			// split the move and follow the surface along it, the other words of the line like
+			// the feed go on the first segment
+			n := int(math.Ceil(dist / maxSeg))
+			rest := strings.TrimSpace(reAxis.ReplaceAllString(reMotion.ReplaceAllString(code, ""), ""))
+			if rest != "" {
+				rest = " " + rest
+			}
+			for i := 1; i <= n; i++ {
+				t := float64(i) / float64(n)
+				sx, sy := prevX+(curX-prevX)*t, prevY+(curY-prevY)*t
+				zoffset, err := heightMap.FindZOffset(sx, sy)
+				if err != nil {
+					return nil, err
+				}
+				line := fmt.Sprintf("G%d X%.*f Y%.*f Z%.*f%s", motion, digits, sx, digits, sy, digits, prevZ+(curZ-prevZ)*t+zoffset, rest)
+				if i == 1 {
+					line += comment
+				}
+				out = append(out, line)
+				rest = ""
+			}
+			continue
+		}
+
 		zoffset, err := heightMap.FindZOffset(curX, curY)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-
-		lineout := fmt.Sprintf("%s ; %.3f + %.3f -> %.3f", curLine, curZ, zoffset, curZ+zoffset)
-		fmt.Println(lineout)
-
-	}
-
-	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+		code = strings.TrimSpace(reZWord.ReplaceAllString(code, ""))
+		out = append(out, fmt.Sprintf("%s Z%.*f%s", code, digits, curZ+zoffset, comment))
 	}
-	return nil
+	return out, nil
 }
 
 // FindZOffset calculates the Z offset for a given (x, y) using plane fitting
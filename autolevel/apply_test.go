@@ -0,0 +1,51 @@
+package autolevel
+
+import (
+	"strings"
+	"testing"
+)
+
+// flat is a height map with the surface 0.5 above Z0
+var flat = HeightMap{{X: 0, Y: 0, Z: 0.5}, {X: 20, Y: 0, Z: 0.5}, {X: 0, Y: 20, Z: 0.5}, {X: 20, Y: 20, Z: 0.5}}
+
+func TestApplyIgnoresNonMoves(t *testing.T) {
+	lines := []string{
+		"G21",
+		"G90 G10 L20 P1 X0 Y0",
+		"G90 G53 G0 Z0 ; Machine Z",
+		"G0 G28 X0 Y0",
+		"G92 X1 Y1",
+		"G38.2 Z-10 F50",
+	}
+	out, err := ApplyHeightMapLines(lines, flat, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, l := range lines {
+		if out[i] != l {
+			t.Errorf("%q written as %q", l, out[i])
+		}
+	}
+}
+
+func TestApplySplitKeepsWords(t *testing.T) {
+	out, err := ApplyHeightMapLines([]string{"G21", "G1 X10 Y0 Z-1 F300 S1000 M3 ; Cut"}, flat, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = out[1:]
+	if len(out) != 5 {
+		t.Fatalf("move split into %d segments, want 5: %q", len(out), out)
+	}
+	if want := "G1 X2.000 Y0.000 Z0.300 F300 S1000 M3 ; Cut"; out[0] != want {
+		t.Errorf("first segment %q, want %q", out[0], want)
+	}
+	for _, l := range out[1:] {
+		if strings.ContainsAny(l, "FSM;") {
+			t.Errorf("segment %q repeats the words of the first", l)
+		}
+	}
+	if want := "G1 X10.000 Y0.000 Z-0.500"; out[4] != want {
+		t.Errorf("last segment %q, want %q", out[4], want)
+	}
+}
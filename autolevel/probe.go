@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/exp/rand"
@@ -99,6 +102,40 @@ func (h *HeightMap) Json() string {
 	return string(out)
 }
 
+// LoadHeightMap reads a height map saved as JSON (see Json) or as x,y,z CSV lines (see CSV)
+func LoadHeightMap(filePath string) (HeightMap, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	hm := HeightMap{}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if err := json.Unmarshal(data, &hm); err != nil {
+			return nil, fmt.Errorf("bad height map: %v", err)
+		}
+		return hm, nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Split(strings.TrimSpace(line), ",")
+		if len(f) != 3 {
+			continue
+		}
+		var p Point
+		var errs [3]error
+		p.X, errs[0] = strconv.ParseFloat(strings.TrimSpace(f[0]), 64)
+		p.Y, errs[1] = strconv.ParseFloat(strings.TrimSpace(f[1]), 64)
+		p.Z, errs[2] = strconv.ParseFloat(strings.TrimSpace(f[2]), 64)
+		if errs[0] != nil || errs[1] != nil || errs[2] != nil {
+			continue
+		}
+		hm = append(hm, p)
+	}
+	if len(hm) < 3 {
+		return nil, fmt.Errorf("height map needs at least 3 points")
+	}
+	return hm, nil
+}
+
 func (h *HeightMap) CSV() string {
 	var out string
 	for _, p := range *h {
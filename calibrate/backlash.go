@@ -0,0 +1,124 @@
+package calibrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/redt1de/cnctools/util"
+)
+
+// backlash measuring methods
+const (
+	Indicator = "indicator" // dial indicator against the moving part
+	Probe     = "probe"     // touch probe against a fixed block
+)
+
+// BacklashParams configures the backlash measuring routine
+type BacklashParams struct {
+	Method    string
+	Axes      string
+	Distance  float64 // travel of each move, more than the backlash plus the indicator preload
+	Feed      float64
+	ProbeFeed float64 // slow feed for pulling off the probe
+	Repeats   int
+	Negative  bool // probe towards the negative end of the axis
+}
+
+// DefaultBacklashParams returns three indicator readings per axis with 2mm moves
+func DefaultBacklashParams() BacklashParams {
+	return BacklashParams{
+		Method:    Indicator,
+		Axes:      "XYZ",
+		Distance:  2,
+		Feed:      200,
+		ProbeFeed: 10,
+		Repeats:   3,
+	}
+}
+
+// Validate checks the parameters
+func (p BacklashParams) Validate() error {
+	switch {
+	case p.Method != Indicator && p.Method != Probe:
+		return fmt.Errorf("unknown method %q", p.Method)
+	case p.Axes == "" || strings.Trim(strings.ToUpper(p.Axes), "XYZABC") != "":
+		return fmt.Errorf("bad axes %q", p.Axes)
+	case p.Distance <= 0:
+		return fmt.Errorf("distance must be positive")
+	case p.Feed <= 0 || p.ProbeFeed <= 0:
+		return fmt.Errorf("feed rates must be positive")
+	case p.Repeats < 1:
+		return fmt.Errorf("at least one repeat is needed")
+	}
+	return nil
+}
+
+// ProbeMoves returns the two probing blocks of one reading on an axis, relative to the current
+// position. The probe touches the block and then pulls off it slowly, the machine positions
+// the two report differ by the backlash.
+func (p BacklashParams) ProbeMoves(axis byte) (touch, pull string) {
+	d := p.Distance
+	if p.Negative {
+		d = -d
+	}
+	return fmt.Sprintf("G38.2 %c%.3f F%.0f", axis, d, p.Feed), fmt.Sprintf("G38.4 %c%.3f F%.0f", axis, -d, p.ProbeFeed)
+}
+
+// BacklashTest returns the measuring program. With an indicator the slack is taken up moving
+// positive, the indicator zeroed, and after going on and coming back the reading is the
+// backlash. With a probe every reading touches a block and pulls off it, the difference of the
+// two [PRB] positions the controller reports is the backlash.
+func BacklashTest(p BacklashParams) (util.Gcode, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	g := util.Gcode("")
+	g.G91Preamble()
+	d := p.Distance
+	for _, a := range []byte(strings.ToUpper(p.Axes)) {
+		if p.Method == Probe {
+			g.Add("; %c axis, probe within %.3fmm of the block", a, p.Distance)
+			g.Add("M0 ; Check the probe")
+			for i := 0; i < p.Repeats; i++ {
+				touch, pull := p.ProbeMoves(a)
+				g.Add("; Reading %d, backlash is the difference of the two %c positions", i+1, a)
+				g.Add(touch)
+				g.Add(pull)
+			}
+			back := -d
+			if p.Negative {
+				back = d
+			}
+			g.Add("G0 %c%.3f ; Clear the block", a, back)
+			continue
+		}
+		g.Add("; %c axis, set the indicator against the moving part", a)
+		for i := 0; i < p.Repeats; i++ {
+			g.Add("; Reading %d", i+1)
+			g.Add("G1 %c%.3f F%.0f", a, -d, p.Feed)
+			g.Add("G1 %c%.3f ; Take up the slack", a, d)
+			g.Add("M0 ; Zero the indicator")
+			g.Add("G1 %c%.3f", a, d)
+			g.Add("G1 %c%.3f ; Reverse back to zero", a, -d)
+			g.Add("M0 ; The indicator reading is the backlash")
+		}
+	}
+	g.Add("G90")
+	g.Add("M30 ; End program")
+	return g, nil
+}
+
+// Average returns the mean of readings, which must not be negative
+func Average(readings []float64) (float64, error) {
+	if len(readings) == 0 {
+		return 0, fmt.Errorf("no readings")
+	}
+	sum := 0.0
+	for _, r := range readings {
+		if r < 0 {
+			return 0, fmt.Errorf("readings can not be negative, not %g", r)
+		}
+		sum += r
+	}
+	return sum / float64(len(readings)), nil
+}
@@ -0,0 +1,105 @@
+package calibrate
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/text"
+	"github.com/redt1de/cnctools/util"
+)
+
+// maxSkew is the largest skew accepted in degrees, more is a mismeasured or swapped diagonal
+const maxSkew = 5
+
+// SquareParams configures the squareness reference rectangle
+type SquareParams struct {
+	Width  float64 // X size of the rectangle, as large as the work area allows
+	Height float64 // Y size
+	Draw   text.EngraveParams
+}
+
+// DefaultSquareParams returns a 300x300mm rectangle drawn with a laser
+func DefaultSquareParams() SquareParams {
+	return SquareParams{
+		Width:  300,
+		Height: 300,
+		Draw: text.EngraveParams{
+			Laser:      true,
+			Power:      500,
+			Spindle:    10000,
+			Depth:      0.2,
+			SafeZ:      5,
+			Feed:       1000,
+			PlungeFeed: 200,
+		},
+	}
+}
+
+// Validate checks the parameters
+func (p SquareParams) Validate() error {
+	if p.Width <= 0 || p.Height <= 0 {
+		return fmt.Errorf("rectangle size must be positive")
+	}
+	return p.Draw.Validate()
+}
+
+// SquareTest returns a program that draws a rectangle from X0 Y0 with both diagonals. Diagonal
+// 1 runs from the origin to the far corner, diagonal 2 between the other two corners, and each
+// is labelled near its start.
+func SquareTest(p SquareParams) (util.Gcode, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	w, h := p.Width, p.Height
+	paths := []geom.Path{
+		{{X: 0, Y: 0}, {X: w, Y: 0}, {X: w, Y: h}, {X: 0, Y: h}, {X: 0, Y: 0}},
+		{{X: 0, Y: 0}, {X: w, Y: h}},
+		{{X: w, Y: 0}, {X: 0, Y: h}},
+	}
+	size := math.Min(10, math.Min(w, h)/10)
+	o := text.DefaultOptions()
+	o.Size = size
+	for i, at := range []geom.Point{{X: size, Y: size * 2.5}, {X: w - size*2, Y: size * 2.5}} {
+		label, err := text.Strokes(fmt.Sprint(i+1), at, o)
+		if err != nil {
+			return "", err
+		}
+		paths = append(paths, label...)
+	}
+
+	g := util.Gcode("")
+	g.G90Preamble()
+	g.Add("; Squareness test %.0fx%.0f, measure both diagonals corner to corner", w, h)
+	if !p.Draw.Laser {
+		g.Add("G0 Z%.3f ; Safe height", p.Draw.SafeZ)
+	}
+	text.Engrave(&g, paths, p.Draw)
+	g.Add("G0 X0 Y0")
+	g.Add("M30 ; End program")
+	return g, nil
+}
+
+// Skew returns the angle in degrees the Y axis leans towards +X from the diagonals measured on
+// a width by height rectangle. A leaning Y axis turns the rectangle into a parallelogram whose
+// diagonals squared differ by four times the area times the sine of the lean.
+func Skew(width, height, d1, d2 float64) (float64, error) {
+	switch {
+	case width <= 0 || height <= 0:
+		return 0, fmt.Errorf("rectangle size must be positive")
+	case d1 <= 0 || d2 <= 0:
+		return 0, fmt.Errorf("measured diagonals must be positive")
+	}
+	nominal := math.Hypot(width, height)
+	for _, d := range []float64{d1, d2} {
+		if math.Abs(d-nominal)/nominal > 0.1 {
+			return 0, fmt.Errorf("diagonal %g is far from the expected %.1f, check the rectangle size", d, nominal)
+		}
+	}
+	s := (d1*d1 - d2*d2) / (4 * width * height)
+	angle := math.Asin(s) * 180 / math.Pi
+	if math.Abs(angle) > maxSkew {
+		return 0, fmt.Errorf("skew of %.2f degrees is implausible, check the diagonals are not swapped", angle)
+	}
+	return angle, nil
+}
@@ -0,0 +1,84 @@
+package calibrate
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/redt1de/cnctools/util"
+)
+
+// maxStepsError is the largest measured error accepted, bigger ones are usually a misread
+// ruler or the wrong units
+const maxStepsError = 0.5
+
+// StepsParams configures the steps per mm test move
+type StepsParams struct {
+	Axes     string  // axes to test, e.g. XYZ
+	Distance float64 // commanded travel
+	Feed     float64
+}
+
+// DefaultStepsParams returns a 100mm move on every axis
+func DefaultStepsParams() StepsParams {
+	return StepsParams{Axes: "XYZ", Distance: 100, Feed: 500}
+}
+
+// Validate checks the parameters
+func (p StepsParams) Validate() error {
+	switch {
+	case p.Axes == "":
+		return fmt.Errorf("no axes to test")
+	case strings.Trim(strings.ToUpper(p.Axes), "XYZABC") != "":
+		return fmt.Errorf("unknown axis in %q", p.Axes)
+	case p.Distance == 0:
+		return fmt.Errorf("test distance can not be zero")
+	case p.Feed <= 0:
+		return fmt.Errorf("feed rate must be positive")
+	}
+	return nil
+}
+
+// StepsTest returns a program that moves each axis by the test distance and back, pausing at
+// both ends so the position can be marked or read off a dial indicator
+func StepsTest(p StepsParams) (util.Gcode, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	g := util.Gcode("")
+	g.G91Preamble()
+	for _, a := range strings.ToUpper(p.Axes) {
+		g.Add("; %c axis, mark or zero the indicator before resuming", a)
+		g.Add("M0 ; Mark the start")
+		g.Add("G1 %c%.3f F%.0f ; Test move", a, p.Distance, p.Feed)
+		g.Add("M0 ; Measure the travel")
+		g.Add("G1 %c%.3f ; Back to the start", a, -p.Distance)
+	}
+	g.Add("G90")
+	g.Add("M30 ; End program")
+	return g, nil
+}
+
+// Steps returns the corrected steps per mm from the current setting and the travel measured
+// for a commanded move. Several measurements are averaged.
+func Steps(current, commanded float64, measured []float64) (float64, error) {
+	switch {
+	case current <= 0:
+		return 0, fmt.Errorf("current steps per mm must be positive")
+	case commanded == 0:
+		return 0, fmt.Errorf("commanded distance can not be zero")
+	case len(measured) == 0:
+		return 0, fmt.Errorf("no measurements")
+	}
+	sum := 0.0
+	for _, m := range measured {
+		if m <= 0 {
+			return 0, fmt.Errorf("measured travel must be positive, not %g", m)
+		}
+		if e := math.Abs(m-math.Abs(commanded)) / math.Abs(commanded); e > maxStepsError {
+			return 0, fmt.Errorf("measured %g is %.0f%% off the commanded %g, check the units", m, e*100, math.Abs(commanded))
+		}
+		sum += m
+	}
+	return current * math.Abs(commanded) / (sum / float64(len(measured))), nil
+}
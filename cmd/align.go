@@ -0,0 +1,128 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/grbl"
+	"github.com/redt1de/cnctools/post"
+	"github.com/redt1de/cnctools/zero"
+	"github.com/spf13/cobra"
+)
+
+// alignCmd represents the align command
+var alignCmd = &cobra.Command{
+	Use:   "align",
+	Short: "probe how far the stock is turned and rotate a program to match",
+	Long: `Touches a straight stock edge twice, --span apart along it, works out how far the stock is
+turned and rotates the program about the work origin to match, so zero the work on the stock
+corner first. --axis is the axis the edge runs along. Jog the tool beside the edge, below its
+top, at the end the second touch goes on from. It probes across the edge in the positive
+direction, or the negative one with --negative.
+
+Without --port give the two positions across the edge with --measured, read off a dial or a
+probe, or the angle with --angle. With --g68 the program is left alone and wrapped in G68 and
+G69 for controllers that rotate coordinates themselves, see cnctools dialects, GRBL does not.
+
+  cnctools align -i job.nc --axis x --span 80 --port /dev/ttyUSB0 > job-aligned.nc
+  cnctools align -i job.nc --axis y --span 100 --measured 0.12,0.47 --g68 --controller mach3 > job.tap`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := zero.DefaultParams()
+		axis, _ := cmd.Flags().GetString("axis")
+		if len(axis) != 1 {
+			log.Fatal("--axis is x or y")
+		}
+		p.Axis = strings.ToUpper(axis)[0]
+		p.Negative, _ = cmd.Flags().GetBool("negative")
+		p.Span, _ = cmd.Flags().GetFloat64("span")
+		p.Travel, _ = cmd.Flags().GetFloat64("travel")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed")
+		p.LatchFeed, _ = cmd.Flags().GetFloat64("latch")
+		p.PullOff, _ = cmd.Flags().GetFloat64("pull-off")
+
+		g68, _ := cmd.Flags().GetBool("g68")
+		if g68 {
+			d, err := outputDialect(cmd)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !d.Rotation {
+				log.Fatalf("%s has no G68 coordinate rotation, leave out --g68 to rotate the program itself", d.ID)
+			}
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		blocks, err := gcode.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		angle, _ := cmd.Flags().GetFloat64("angle")
+		measured, _ := cmd.Flags().GetFloat64Slice("measured")
+		port, _ := cmd.Flags().GetString("port")
+		switch {
+		case cmd.Flags().Changed("angle"):
+		case len(measured) > 0:
+			if len(measured) != 2 {
+				log.Fatal("--measured takes the two positions across the edge")
+			}
+			if angle, err = zero.Rotation(p.Axis, measured[0], measured[1], p.Span); err != nil {
+				log.Fatal(err)
+			}
+		case port != "":
+			// probing holds the answer back
+			grbl.Timeout = 2 * time.Minute
+			baud, _ := cmd.Flags().GetInt("baud")
+			conn, err := grbl.Dial(port, baud)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer conn.Close()
+			conn.Echo = os.Stderr
+			if angle, err = zero.ProbeRotation(conn, p); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			log.Fatal("give --port to probe the edge, or --measured or --angle")
+		}
+		fmt.Fprintf(os.Stderr, "the stock is turned %.4f degrees\n", angle)
+
+		if g68 {
+			writeBlocks(cmd, post.CoordinateRotation(blocks, angle, 0, 0))
+			return
+		}
+		tol, _ := cmd.Flags().GetFloat64("tolerance")
+		out, err := post.Transform(blocks, post.Rotate(angle, 0, 0), tol)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeBlocks(cmd, out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(alignCmd)
+	d := zero.DefaultParams()
+	alignCmd.Flags().StringP("file", "i", "", "gcode file, - for standard input")
+	alignCmd.Flags().String("axis", "x", "axis the edge runs along, x or y")
+	alignCmd.Flags().Bool("negative", false, "probe across the edge in the negative direction")
+	alignCmd.Flags().Float64("span", d.Span, "distance along the edge between the touches, negative to go the other way")
+	alignCmd.Flags().Float64("travel", d.Travel, "furthest each probe move goes")
+	alignCmd.Flags().Float64P("feed", "f", d.Feed, "first probing feed rate")
+	alignCmd.Flags().Float64("latch", d.LatchFeed, "slow second probing feed rate")
+	alignCmd.Flags().Float64("pull-off", d.PullOff, "back off between the two touches")
+	alignCmd.Flags().Float64Slice("measured", nil, "positions across the edge at the two points, instead of probing")
+	alignCmd.Flags().Float64P("angle", "a", 0, "stock rotation in degrees counter clockwise, instead of probing")
+	alignCmd.Flags().Bool("g68", false, "wrap the program in G68 rotation instead of rotating it")
+	alignCmd.Flags().Float64("tolerance", 0.01, "chord error for arcs out of the XY plane that need breaking into lines")
+	alignCmd.Flags().StringP("port", "P", "", "controller serial device or host:port to probe with")
+	alignCmd.Flags().Int("baud", 115200, "serial baud rate")
+	alignCmd.MarkFlagRequired("file")
+}
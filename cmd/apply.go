@@ -4,36 +4,46 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
+	"log"
+	"strings"
 
+	"github.com/redt1de/cnctools/autolevel"
 	"github.com/spf13/cobra"
 )
 
 // applyCmd represents the apply command
 var applyCmd = &cobra.Command{
 	Use:   "apply",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Short: "apply a height map to a gcode file",
+	Long: `Offsets the Z of every move in an absolute (G90) gcode file by a probed height map. Long
+moves are split so the tool follows the surface between probe points. The height map is the
+JSON or CSV output of the autolevel command.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("apply called")
+		file, _ := cmd.Flags().GetString("file")
+		mapFile, _ := cmd.Flags().GetString("map")
+		seg, _ := cmd.Flags().GetFloat64("segment")
+
+		hm, err := autolevel.LoadHeightMap(mapFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lines, err := readLines(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := autolevel.ApplyHeightMapLines(lines, hm, seg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(cmd, strings.Join(out, "\n"))
 	},
 }
 
 func init() {
 	autolevelCmd.AddCommand(applyCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// applyCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// applyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	applyCmd.Flags().StringP("file", "f", "", "gcode file to level")
+	applyCmd.Flags().StringP("map", "m", "", "height map file, JSON or x,y,z CSV")
+	applyCmd.Flags().Float64P("segment", "s", autolevel.DefaultSegmentLength, "split moves longer than this")
+	applyCmd.MarkFlagRequired("file")
+	applyCmd.MarkFlagRequired("map")
 }
@@ -37,7 +37,9 @@ to quickly create a Cobra application.`,
 
 		fmt.Println(hm.GoCode())
 
-		autolevel.ApplyHeightMap(file, hm)
+		for _, line := range autolevel.ApplyHeightMap(file, hm) {
+			fmt.Println(line)
+		}
 
 	},
 }
@@ -0,0 +1,227 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redt1de/cnctools/calibrate"
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/grbl"
+	"github.com/redt1de/cnctools/post"
+	"github.com/redt1de/cnctools/profile"
+	"github.com/spf13/cobra"
+)
+
+// backlashCalCmd represents the calibrate backlash command
+var backlashCalCmd = &cobra.Command{
+	Use:   "backlash",
+	Short: "measure the backlash of each axis",
+	Long: `Measures the lost motion when an axis reverses.
+
+With a dial indicator (--method indicator) print the program with --test and run it. Each
+reading takes up the slack, pauses to zero the indicator, goes on and comes back, and the
+indicator then shows the backlash. Pass the readings back with --measured.
+
+With a touch probe (--method probe) set the probe within --distance of a fixed block. Each
+reading touches the block and pulls off it slowly, and the two probe positions differ by the
+backlash. Give --port to run it on the controller and work the readings out, or run the --test
+program and pass the differences with --measured.
+
+--save stores the averages in the machine profile for the backlash post processor.
+
+  cnctools calibrate backlash --test -a XY
+  cnctools calibrate backlash -m x=0.08,0.09,0.08 -m y=0.12 --save
+  cnctools calibrate backlash --method probe -a X --port /dev/ttyUSB0 --save`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := calibrate.DefaultBacklashParams()
+		p.Method, _ = cmd.Flags().GetString("method")
+		p.Axes, _ = cmd.Flags().GetString("axes")
+		p.Distance, _ = cmd.Flags().GetFloat64("distance")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed")
+		p.ProbeFeed, _ = cmd.Flags().GetFloat64("probe-feed")
+		p.Repeats, _ = cmd.Flags().GetInt("repeats")
+		p.Negative, _ = cmd.Flags().GetBool("negative")
+		if err := p.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		if test, _ := cmd.Flags().GetBool("test"); test {
+			g, err := calibrate.BacklashTest(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+			write(cmd, string(g))
+			return
+		}
+
+		entries, _ := cmd.Flags().GetStringArray("measured")
+		readings, err := parseAxisValues(entries)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if port, _ := cmd.Flags().GetString("port"); port != "" {
+			if p.Method != calibrate.Probe {
+				log.Fatal("measuring on the controller needs --method probe")
+			}
+			// probing holds the answer back until the slow pull off has gone the whole distance
+			slowest := math.Min(p.Feed, p.ProbeFeed)
+			grbl.Timeout = time.Duration(p.Distance/slowest*float64(time.Minute)) + 10*time.Second
+			baud, _ := cmd.Flags().GetInt("baud")
+			conn, err := grbl.Dial(port, baud)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer conn.Close()
+			if readings, err = probeBacklash(conn, p); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if len(readings) == 0 {
+			log.Fatal("no readings, use --measured, --port or --test for the program")
+		}
+
+		name, _ := cmd.Flags().GetString("profile")
+		prof, err := profile.Load(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if prof.Machine.Backlash == nil {
+			prof.Machine.Backlash = map[string]float64{}
+		}
+		for _, a := range []byte("XYZABC") {
+			r, ok := readings[a]
+			if !ok {
+				continue
+			}
+			avg, err := calibrate.Average(r)
+			if err != nil {
+				log.Fatalf("%c: %v", a, err)
+			}
+			fmt.Printf("%c backlash %.3f from %d reading(s)\n", a, avg, len(r))
+			prof.Machine.Backlash[string(a)] = avg
+		}
+		if save, _ := cmd.Flags().GetBool("save"); save {
+			if err := prof.Save(); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("saved to profile %s\n", name)
+		}
+	},
+}
+
+// probeBacklash runs the probe readings on the controller
+func probeBacklash(conn *grbl.Conn, p calibrate.BacklashParams) (map[byte][]float64, error) {
+	conn.Echo = os.Stderr
+	if _, err := conn.Command("G21 G91"); err != nil {
+		return nil, err
+	}
+	defer conn.Command("G90")
+	out := map[byte][]float64{}
+	for _, a := range []byte(strings.ToUpper(p.Axes)) {
+		i := gcode.AxisIndex(a)
+		for r := 0; r < p.Repeats; r++ {
+			touch, pull := p.ProbeMoves(a)
+			lines, err := conn.Command(touch)
+			if err != nil {
+				return nil, err
+			}
+			t, err := grbl.ProbeResult(lines)
+			if err != nil {
+				return nil, err
+			}
+			if lines, err = conn.Command(pull); err != nil {
+				return nil, err
+			}
+			l, err := grbl.ProbeResult(lines)
+			if err != nil {
+				return nil, err
+			}
+			if i >= len(t) || i >= len(l) {
+				return nil, fmt.Errorf("the controller does not report %c", a)
+			}
+			out[a] = append(out[a], math.Abs(t[i]-l[i]))
+		}
+		back := -p.Distance
+		if p.Negative {
+			back = p.Distance
+		}
+		if _, err := conn.Command(fmt.Sprintf("G0 %c%.3f", a, back)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// backlashCmd represents the backlash post processor command
+var backlashCmd = &cobra.Command{
+	Use:   "backlash",
+	Short: "add backlash compensation to a gcode file",
+	Long: `Inserts a short move wherever an axis reverses to take up the slack, and shifts the rest
+of the program by it so the tool lands where it was meant to. The amounts come from the machine
+profile (see calibrate backlash) unless given with --amount.
+
+  cnctools backlash -i part.nc -a x=0.08 -a y=0.12 > part-comp.nc`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("profile")
+		prof, err := profile.Load(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var amounts gcode.Axes
+		for a, v := range prof.Machine.Backlash {
+			if i := gcode.AxisIndex(a[0]); len(a) == 1 && i >= 0 {
+				amounts[i] = v
+			}
+		}
+		entries, _ := cmd.Flags().GetStringSlice("amount")
+		given, err := parseAxisValues(entries)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for a, v := range given {
+			amounts[gcode.AxisIndex(a)] = v[len(v)-1]
+		}
+		if amounts == (gcode.Axes{}) {
+			log.Fatal("no backlash amounts, run calibrate backlash --save or use --amount")
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		blocks, err := gcode.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := post.Backlash(blocks, amounts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeBlocks(cmd, out)
+	},
+}
+
+func init() {
+	calibrateCmd.AddCommand(backlashCalCmd)
+	d := calibrate.DefaultBacklashParams()
+	backlashCalCmd.Flags().StringP("method", "M", d.Method, "indicator or probe")
+	backlashCalCmd.Flags().StringP("axes", "a", d.Axes, "axes to measure")
+	backlashCalCmd.Flags().Float64P("distance", "d", d.Distance, "travel of each move")
+	backlashCalCmd.Flags().Float64P("feed", "f", d.Feed, "feed rate, and probing feed")
+	backlashCalCmd.Flags().Float64("probe-feed", d.ProbeFeed, "feed rate pulling off the probe")
+	backlashCalCmd.Flags().IntP("repeats", "n", d.Repeats, "readings per axis")
+	backlashCalCmd.Flags().Bool("negative", false, "probe towards the negative end of the axes")
+	backlashCalCmd.Flags().Bool("test", false, "print the measuring program")
+	backlashCalCmd.Flags().StringArrayP("measured", "m", nil, "readings as axis=value[,value...], repeatable")
+	backlashCalCmd.Flags().StringP("port", "P", "", "controller serial device (Linux only) or host:port to probe with")
+	backlashCalCmd.Flags().Int("baud", 115200, "serial baud rate")
+	backlashCalCmd.Flags().Bool("save", false, "store the averages in the machine profile")
+
+	rootCmd.AddCommand(backlashCmd)
+	backlashCmd.Flags().StringP("file", "i", "", "gcode file, - for standard input")
+	backlashCmd.Flags().StringSliceP("amount", "a", nil, "backlash per axis as axis=value, overrides the profile")
+	backlashCmd.MarkFlagRequired("file")
+}
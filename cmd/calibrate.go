@@ -0,0 +1,44 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// calibrateCmd represents the calibrate command
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate",
+	Short: "machine calibration routines",
+	Long:  `Test programs and calculators that tune the controller settings of the machine.`,
+}
+
+func init() {
+	rootCmd.AddCommand(calibrateCmd)
+}
+
+// parseAxisValues parses entries like x=99.8,99.9 into values per upper case axis letter.
+// Repeated axes add to the values.
+func parseAxisValues(entries []string) (map[byte][]float64, error) {
+	out := map[byte][]float64{}
+	for _, e := range entries {
+		axis, vals, ok := strings.Cut(e, "=")
+		if !ok || len(axis) != 1 || !strings.Contains("XYZABC", strings.ToUpper(axis)) {
+			return nil, fmt.Errorf("expected axis=value, not %q", e)
+		}
+		a := strings.ToUpper(axis)[0]
+		for _, v := range strings.Split(vals, ",") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad value %q for %c", v, a)
+			}
+			out[a] = append(out[a], f)
+		}
+	}
+	return out, nil
+}
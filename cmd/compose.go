@@ -0,0 +1,86 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/post"
+	"github.com/spf13/cobra"
+)
+
+// composeCmd represents the compose command
+var composeCmd = &cobra.Command{
+	Use:   "compose file[:tool[:note]]...",
+	Short: "join several gcode files into one job",
+	Long: `Joins programs into one job, in the order given, with one header and one program end.
+Each file can name the tool it needs after a colon, and a description after another. The tool
+is changed with M6, or with --manual by stopping the spindle and pausing with M0. Between
+operations the tool retracts to --safe-height, or to machine Z0 with --machine-retract, and
+the modes go back to G90 G17 G94. Programs in inches are converted, and repeated preamble
+codes and program ends are dropped.
+
+  cnctools compose surface.nc:1 drill.nc:2:"0.8mm drill" profile.nc:3 > job.nc
+  cnctools compose --manual --safe-height 10 pocket.nc:1 chamfer.nc:2`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		p := post.DefaultComposeParams()
+		p.SafeZ, _ = cmd.Flags().GetFloat64("safe-height")
+		p.Machine, _ = cmd.Flags().GetBool("machine-retract")
+		p.Manual, _ = cmd.Flags().GetBool("manual")
+		if noRetract, _ := cmd.Flags().GetBool("no-retract"); noRetract {
+			p.Retract = false
+		}
+
+		ops := []post.Operation{}
+		for _, arg := range args {
+			op, err := parseOperation(arg)
+			if err != nil {
+				log.Fatal(err)
+			}
+			ops = append(ops, op)
+		}
+		out, err := post.Compose(ops, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeBlocks(cmd, out)
+	},
+}
+
+// parseOperation reads an operation given as file[:tool[:note]]
+func parseOperation(arg string) (post.Operation, error) {
+	parts := strings.SplitN(arg, ":", 3)
+	op := post.Operation{Name: filepath.Base(parts[0])}
+	if len(parts) > 1 && parts[1] != "" {
+		t, err := strconv.Atoi(parts[1])
+		if err != nil || t < 0 {
+			return op, fmt.Errorf("bad tool number %q in %q", parts[1], arg)
+		}
+		op.Tool = t
+	}
+	if len(parts) > 2 {
+		op.Note = parts[2]
+	}
+	blocks, err := gcode.ReadFile(parts[0])
+	if err != nil {
+		return op, fmt.Errorf("%s: %v", parts[0], err)
+	}
+	op.Blocks = blocks
+	return op, nil
+}
+
+func init() {
+	rootCmd.AddCommand(composeCmd)
+	d := post.DefaultComposeParams()
+	composeCmd.Flags().Float64("safe-height", d.SafeZ, "work Z to retract to between operations")
+	composeCmd.Flags().Bool("machine-retract", false, "retract to machine Z0 with G53 instead")
+	composeCmd.Flags().Bool("no-retract", false, "do not retract between operations, for laser jobs")
+	composeCmd.Flags().Bool("manual", false, "pause with M0 for tool changes instead of M6")
+}
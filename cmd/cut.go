@@ -0,0 +1,136 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/laser"
+	"github.com/redt1de/cnctools/profile"
+	"github.com/spf13/cobra"
+)
+
+// cutCmd represents the laser cut command
+var cutCmd = &cobra.Command{
+	Use:   "cut",
+	Short: "cut the contours of a DXF or SVG file in several passes",
+	Long: `Cuts every contour and open path of a DXF or SVG drawing with the laser. Holes and
+other contours inside a part are cut before the part itself. Closed contours are grown by half
+the kerf stored in the machine profile so parts come out on size, use --no-kerf to cut on the
+lines. The first pass runs at the profile focus Z and each further pass drops by --step-down,
+which needs a focus Z to step down from as Z0 is the laser touching the work.
+
+Power, feed and air take one value per pass, the last value is used for the remaining passes.
+A material preset sets all of them, flags given as well override the preset. Presets are
+extended or replaced by a materials.json file in the cnctools config directory, keyed by name:
+
+  {"birch-4": {"thickness": 4, "passes": 3, "power": [1000], "feed": [250], "step_down": 1, "air": "M8"}}
+
+  cnctools laser cut -i box.svg --material plywood-3
+  cnctools laser cut -i box.dxf --passes 3 --power 1000 --feed 400,300 --air-code M7 --air on,on,off`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("profile")
+		prof, err := profile.Load(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dir, err := profile.ConfigDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		materials, err := laser.LoadMaterials(filepath.Join(dir, "materials.json"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if list, _ := cmd.Flags().GetBool("list-materials"); list {
+			for _, n := range materials.Names() {
+				m := materials[n]
+				fmt.Printf("%-14s %4.1fmm  %d passes  S%v  F%v  step down %.2f  air %q  %s\n", n, m.Thickness, m.Passes, m.Power, m.Feed, m.StepDown, m.Air, m.Note)
+			}
+			return
+		}
+
+		p := laser.DefaultCutParams()
+		if mat, _ := cmd.Flags().GetString("material"); mat != "" {
+			m, err := materials.Get(mat)
+			if err != nil {
+				log.Fatal(err)
+			}
+			p.Apply(m)
+		}
+		if cmd.Flags().Changed("passes") {
+			p.Passes, _ = cmd.Flags().GetInt("passes")
+		}
+		if cmd.Flags().Changed("power") {
+			p.Power, _ = cmd.Flags().GetFloat64Slice("power")
+		}
+		if cmd.Flags().Changed("feed") {
+			p.Feed, _ = cmd.Flags().GetFloat64Slice("feed")
+		}
+		if cmd.Flags().Changed("step-down") {
+			p.StepDown, _ = cmd.Flags().GetFloat64("step-down")
+		}
+		if cmd.Flags().Changed("air-code") {
+			code, _ := cmd.Flags().GetString("air-code")
+			p.AirCode = strings.ToUpper(code)
+		}
+		if cmd.Flags().Changed("air") {
+			p.Air = nil
+			vals, _ := cmd.Flags().GetStringSlice("air")
+			for _, v := range vals {
+				switch strings.ToLower(v) {
+				case "on", "1", "true":
+					p.Air = append(p.Air, true)
+				case "off", "0", "false":
+					p.Air = append(p.Air, false)
+				default:
+					log.Fatalf("air must be on or off, not %q", v)
+				}
+			}
+		}
+		p.FocusZ = prof.Laser.FocusZ
+		if cmd.Flags().Changed("focus-z") {
+			p.FocusZ, _ = cmd.Flags().GetFloat64("focus-z")
+		}
+		if noKerf, _ := cmd.Flags().GetBool("no-kerf"); !noKerf {
+			p.Kerf = prof.Laser.Kerf
+		}
+		p.Resolution, _ = cmd.Flags().GetFloat64("resolution")
+
+		file, _ := cmd.Flags().GetString("file")
+		if file == "" {
+			log.Fatal("no input file, use -i")
+		}
+		d, err := geom.ReadDrawing(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g, err := laser.Cut(d, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeLaser(cmd, string(g))
+	},
+}
+
+func init() {
+	laserCmd.AddCommand(cutCmd)
+	d := laser.DefaultCutParams()
+	cutCmd.Flags().StringP("file", "i", "", "DXF or SVG file to cut")
+	cutCmd.Flags().StringP("material", "m", "", "material preset")
+	cutCmd.Flags().Bool("list-materials", false, "list the material presets and exit")
+	cutCmd.Flags().IntP("passes", "n", d.Passes, "number of passes")
+	cutCmd.Flags().Float64SliceP("power", "p", d.Power, "laser power per pass")
+	cutCmd.Flags().Float64SliceP("feed", "f", d.Feed, "feed rate per pass")
+	cutCmd.Flags().Float64P("step-down", "z", d.StepDown, "Z descent between passes")
+	cutCmd.Flags().String("air-code", "", "air assist code, M7 or M8")
+	cutCmd.Flags().StringSlice("air", []string{"on"}, "air assist on or off per pass")
+	cutCmd.Flags().Float64("focus-z", 0, "Z of the first pass (default from the profile)")
+	cutCmd.Flags().Bool("no-kerf", false, "cut on the lines without kerf compensation")
+	cutCmd.Flags().Float64("resolution", d.Resolution, "grid spacing for the kerf offset")
+}
@@ -0,0 +1,88 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/redt1de/cnctools/dialect"
+	"github.com/redt1de/cnctools/profile"
+	"github.com/spf13/cobra"
+)
+
+// dialectsCmd represents the dialects command
+var dialectsCmd = &cobra.Command{
+	Use:   "dialects [controller]",
+	Short: "list the controller dialects programs can be written in",
+	Long: `Every program is written for the controller picked with --controller, or the one saved in
+the profile, GRBL otherwise. The dialects differ in:
+  laser   M4 dynamic laser power, or M3 where the controller lacks it, spindle M4 is kept
+  probe   G38.2, G31 on Mach3, or a Z only G30 on Marlin that probes down at its own feed
+  comment ; or (brackets)
+  lines   N line numbers, --line-numbers turns them on for any controller
+  cycles  G73 and G81 to G83 drilling cycles, or the same as plain moves
+  rotate  G68 coordinate rotation, align --g68 needs it
+  digits  decimal places in mm, one more in inches
+
+The live senders talk to GRBL and are not affected.
+
+  cnctools dialects
+  cnctools dialects linuxcnc --save
+  cnctools drill -i board.drl --controller mach3 > board.tap`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "controller\tlaser\tprobe\tcomment\tlines\tcycles\trotate\tdigits")
+			for _, c := range dialect.Controllers {
+				laser, comment, lines, cycles, rotate := "M3", ";", "-", "expanded", "-"
+				if c.DynamicLaser {
+					laser = "M4"
+				}
+				if c.Parens {
+					comment = "()"
+				}
+				if c.LineNumbers {
+					lines = "N"
+				}
+				if c.Cycles {
+					cycles = "canned"
+				}
+				if c.Rotation {
+					rotate = "G68"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", c.ID, laser, c.Probe, comment, lines, cycles, rotate, c.Digits)
+			}
+			w.Flush()
+			return
+		}
+
+		c, err := dialect.Get(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if save, _ := cmd.Flags().GetBool("save"); !save {
+			fmt.Printf("%+v\n", c)
+			return
+		}
+		name, _ := cmd.Flags().GetString("profile")
+		prof, err := profile.Load(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		prof.Machine.Controller = c.ID
+		if err := prof.Save(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("programs are written for %s, saved to profile %s\n", c.ID, name)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dialectsCmd)
+	dialectsCmd.Flags().Bool("save", false, "write programs for the controller from now on")
+}
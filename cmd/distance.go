@@ -0,0 +1,63 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/post"
+	"github.com/spf13/cobra"
+)
+
+// distanceCmd represents the distance command
+var distanceCmd = &cobra.Command{
+	Use:   "distance",
+	Short: "rewrite a gcode file in absolute or relative coordinates",
+	Long: `Rewrites a program entirely into absolute (G90) or relative (G91) coordinates, so outputs
+like laser focus and power can be combined with others or autolevelled. --start is the work
+position the machine starts the program at, X,Y,Z.
+
+Moves after homing, probing or a G53 move can not be converted until an absolute move sets the
+position again, and canned cycles are not converted, they keep their own mode with a G90 or
+G91 around them.
+
+  cnctools laser power | cnctools distance -i - --start 20,20,0 > power-abs.nc`,
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetString("to")
+		var absolute bool
+		switch to {
+		case "absolute", "abs", "G90", "g90":
+			absolute = true
+		case "relative", "rel", "G91", "g91":
+		default:
+			log.Fatalf("unknown mode %q, use absolute or relative", to)
+		}
+		var start gcode.Axes
+		values, _ := cmd.Flags().GetFloat64Slice("start")
+		if len(values) > len(start) {
+			log.Fatal("--start takes up to x,y,z,a,b,c")
+		}
+		copy(start[:], values)
+
+		file, _ := cmd.Flags().GetString("file")
+		blocks, err := gcode.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := post.Distance(blocks, absolute, start)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeBlocks(cmd, out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(distanceCmd)
+	distanceCmd.Flags().StringP("file", "i", "", "gcode file, - for standard input")
+	distanceCmd.Flags().StringP("to", "t", "absolute", "absolute or relative")
+	distanceCmd.Flags().Float64SliceP("start", "s", []float64{0, 0, 0}, "work position the program starts at, x,y,z")
+	distanceCmd.MarkFlagRequired("file")
+}
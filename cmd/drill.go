@@ -0,0 +1,144 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/redt1de/cnctools/dialect"
+	"github.com/redt1de/cnctools/drill"
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/geom"
+	"github.com/spf13/cobra"
+)
+
+// drillCmd represents the drill command
+var drillCmd = &cobra.Command{
+	Use:   "drill",
+	Short: "generate drilling gcode from a hole list or pattern",
+	Long: `Drills holes read from an Excellon drill file, a CSV file (x,y[,diameter]) or the circles
+of a DXF file, or generated from a pattern. Zero Z on the stock top.
+
+Patterns:
+  grid    --count cols,rows --spacing dx,dy --origin x,y
+  circle  --count n --radius r --origin cx,cy --angle start
+  line    --count n --spacing d --origin x,y --angle direction
+
+Holes are grouped by diameter with a pause for a tool change between groups, and the order
+within each group is optimized to shorten travel. Controllers without canned cycles, like
+GRBL, get them as plain moves from their --controller dialect. --expand writes the same plain
+moves for every controller.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		pattern, _ := cmd.Flags().GetString("pattern")
+		count, _ := cmd.Flags().GetIntSlice("count")
+		spacing, _ := cmd.Flags().GetFloat64Slice("spacing")
+		origin, _ := cmd.Flags().GetFloat64Slice("origin")
+		radius, _ := cmd.Flags().GetFloat64("radius")
+		angle, _ := cmd.Flags().GetFloat64("angle")
+		dia, _ := cmd.Flags().GetFloat64("diameter")
+		noOptimize, _ := cmd.Flags().GetBool("no-optimize")
+
+		p := drill.Params{}
+		p.Cycle, _ = cmd.Flags().GetString("cycle")
+		p.Depth, _ = cmd.Flags().GetFloat64("depth")
+		p.Retract, _ = cmd.Flags().GetFloat64("retract")
+		p.SafeZ, _ = cmd.Flags().GetFloat64("safe-height")
+		p.Peck, _ = cmd.Flags().GetFloat64("peck")
+		p.Dwell, _ = cmd.Flags().GetFloat64("dwell")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed-rate")
+		p.Spindle, _ = cmd.Flags().GetFloat64("spindle")
+
+		holes, err := loadHoles(file, pattern, count, spacing, origin, radius, angle, dia)
+		if err != nil {
+			log.Fatal(err)
+		}
+		groups := drill.GroupByDiameter(holes)
+		if !noOptimize {
+			start := geom.Point{}
+			for i := range groups {
+				groups[i] = drill.Optimize(groups[i], start)
+				start = geom.Point{X: groups[i][len(groups[i])-1].X, Y: groups[i][len(groups[i])-1].Y}
+			}
+		}
+		g, err := drill.Generate(groups, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if expand, _ := cmd.Flags().GetBool("expand"); expand {
+			blocks, err := gcode.ParseString(string(g))
+			if err != nil {
+				log.Fatal(err)
+			}
+			if blocks, err = dialect.Expand(blocks); err != nil {
+				log.Fatal(err)
+			}
+			writeBlocks(cmd, blocks)
+			return
+		}
+		write(cmd, string(g))
+	},
+}
+
+func loadHoles(file, pattern string, count []int, spacing, origin []float64, radius, angle, dia float64) ([]drill.Hole, error) {
+	if file != "" {
+		return drill.ReadFile(file)
+	}
+	at := func(s []float64, i int) float64 {
+		if i < len(s) {
+			return s[i]
+		}
+		if len(s) > 0 {
+			return s[0]
+		}
+		return 0
+	}
+	o := geom.Point{X: at(origin, 0), Y: at(origin, 1)}
+	n := func(i int) int {
+		if i < len(count) {
+			return count[i]
+		}
+		return count[0]
+	}
+	if len(count) == 0 || n(0) < 1 || n(1) < 1 {
+		return nil, fmt.Errorf("count must be at least 1")
+	}
+	switch pattern {
+	case "grid":
+		return drill.Grid(o, n(0), n(1), at(spacing, 0), at(spacing, 1), dia), nil
+	case "circle":
+		if radius <= 0 {
+			return nil, fmt.Errorf("bolt circle needs a radius")
+		}
+		return drill.BoltCircle(o, radius, n(0), angle, dia), nil
+	case "line":
+		return drill.Line(o, n(0), at(spacing, 0), angle, dia), nil
+	case "":
+		return nil, fmt.Errorf("either --file or --pattern is required")
+	}
+	return nil, fmt.Errorf("unknown pattern %q", pattern)
+}
+
+func init() {
+	rootCmd.AddCommand(drillCmd)
+	drillCmd.Flags().StringP("file", "i", "", "Excellon, CSV or DXF file with the holes")
+	drillCmd.Flags().StringP("pattern", "P", "", "generate holes: grid, circle or line")
+	drillCmd.Flags().IntSliceP("count", "n", []int{1}, "number of holes, cols,rows for a grid")
+	drillCmd.Flags().Float64SliceP("spacing", "s", []float64{10}, "hole spacing, dx,dy for a grid")
+	drillCmd.Flags().Float64SliceP("origin", "o", []float64{0, 0}, "pattern origin or bolt circle centre")
+	drillCmd.Flags().Float64P("radius", "r", 0, "bolt circle radius")
+	drillCmd.Flags().Float64P("angle", "a", 0, "bolt circle start angle or line direction in degrees")
+	drillCmd.Flags().Float64("diameter", 0, "hole diameter for generated patterns")
+	drillCmd.Flags().StringP("cycle", "c", drill.Simple, "cycle: drill (G81), dwell (G82), peck (G83) or chipbreak (G73)")
+	drillCmd.Flags().Float64P("depth", "d", 2, "hole depth")
+	drillCmd.Flags().Float64P("retract", "R", 2, "retract plane")
+	drillCmd.Flags().Float64("safe-height", 5, "safe Z height for travel between holes")
+	drillCmd.Flags().Float64P("peck", "q", 1, "peck depth")
+	drillCmd.Flags().Float64("dwell", 0.5, "dwell at the bottom in seconds")
+	drillCmd.Flags().Float64P("feed-rate", "f", 100, "plunge feed rate")
+	drillCmd.Flags().Float64("spindle", 10000, "spindle speed")
+	drillCmd.Flags().BoolP("expand", "e", false, "expand cycles into plain moves for controllers without canned cycles")
+	drillCmd.Flags().Bool("no-optimize", false, "keep the input hole order")
+}
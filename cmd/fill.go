@@ -0,0 +1,80 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/redt1de/cnctools/fill"
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/laser"
+	"github.com/redt1de/cnctools/profile"
+	"github.com/spf13/cobra"
+)
+
+// fillCmd represents the laser fill command
+var fillCmd = &cobra.Command{
+	Use:   "fill",
+	Short: "engrave the closed shapes of a DXF or SVG file with a fill pattern",
+	Long: `Fills every closed shape of a DXF or SVG drawing, contours nested inside another are holes.
+The line interval defaults to the beam diameter in the machine profile.
+
+Patterns: ` + strings.Join(fill.Patterns, ", ") + `
+
+The laser runs in dynamic power mode (M4) with the power set on each move, so enable laser
+mode on the controller ($32=1 on GRBL). Straight strokes are run up to and past by the
+overscan with the laser at S0 so the head is at speed when it burns.
+
+  cnctools laser fill -i logo.svg --pattern crosshatch --angle 45 --power 400`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("profile")
+		prof, err := profile.Load(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		p := laser.DefaultFillParams()
+		p.Fill.Pattern, _ = cmd.Flags().GetString("pattern")
+		p.Fill.Interval = prof.Laser.Beam()
+		if cmd.Flags().Changed("interval") {
+			p.Fill.Interval, _ = cmd.Flags().GetFloat64("interval")
+		}
+		p.Fill.Angle, _ = cmd.Flags().GetFloat64("angle")
+		p.Fill.Overscan, _ = cmd.Flags().GetFloat64("overscan")
+		oneWay, _ := cmd.Flags().GetBool("one-way")
+		p.Fill.Bidirectional = !oneWay
+		p.Fill.Resolution, _ = cmd.Flags().GetFloat64("resolution")
+		p.Power, _ = cmd.Flags().GetFloat64("power")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed")
+		p.FocusZ = prof.Laser.FocusZ
+
+		file, _ := cmd.Flags().GetString("file")
+		if file == "" {
+			log.Fatal("no input file, use -i")
+		}
+		d, err := geom.ReadDrawing(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g, err := laser.Fill(geom.Nest(d.Loops), p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeLaser(cmd, string(g))
+	},
+}
+
+func init() {
+	laserCmd.AddCommand(fillCmd)
+	d := laser.DefaultFillParams()
+	fillCmd.Flags().StringP("file", "i", "", "DXF or SVG file to fill")
+	fillCmd.Flags().StringP("pattern", "P", d.Fill.Pattern, "fill pattern")
+	fillCmd.Flags().Float64P("interval", "l", d.Fill.Interval, "line interval (default the profile beam diameter)")
+	fillCmd.Flags().Float64P("angle", "a", d.Fill.Angle, "line angle in degrees")
+	fillCmd.Flags().Float64P("overscan", "o", d.Fill.Overscan, "run up and run out of straight strokes")
+	fillCmd.Flags().Bool("one-way", false, "burn every line in the same direction")
+	fillCmd.Flags().Float64("resolution", 0, "grid spacing for concentric and spiral offsets (default half the interval)")
+	fillCmd.Flags().Float64P("power", "p", d.Power, "laser power")
+	fillCmd.Flags().Float64P("feed", "f", d.Feed, "feed rate")
+}
@@ -5,81 +5,71 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 
-	"github.com/redt1de/cnctools/util"
+	"github.com/redt1de/cnctools/laser"
+	"github.com/redt1de/cnctools/profile"
 	"github.com/spf13/cobra"
 )
 
-// 2X2 L
-/*
-G21
-G91
-;
-M3 S100
-G01 Y2 F100
-G01 X2 F100
-G01 X-2 Y-2 F100
-M5
-*/
-
 // focusCmd represents the focus command
 var focusCmd = &cobra.Command{
 	Use:   "focus",
-	Short: "A brief description of your command",
+	Short: "generate a focus test ramp and find the focal height",
 	Long: `
-1. touch off the laser and zero
-2. run focus command
-3. turn on laser to lowest power and jog X until its over the cleanest point on the line. 
-4. run the focus command again with the --calculate [X] flag
+1. touch off the laser on the work surface and zero X, Y and Z
+2. run the focus command and burn the test, ticks are labelled with their Z
+3. find the thinnest point on the line and read its X, by jogging the laser over it or measuring
+4. run the focus command again with the same settings and --calculate [X] to get the best Z,
+   add --save to store it in the machine profile
+
+Modes:
+  ramp       one line climbing steadily in Z
+  staircase  flat segments at one Z each, easier to compare side by side
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		Zmin, _ := cmd.Flags().GetFloat64("z-min")
-		Zmax, _ := cmd.Flags().GetFloat64("z-max")
+		p := laser.DefaultFocusParams()
+		p.Mode, _ = cmd.Flags().GetString("mode")
+		p.Length, _ = cmd.Flags().GetFloat64("length")
+		p.Steps, _ = cmd.Flags().GetInt("steps")
+		p.Focal, _ = cmd.Flags().GetFloat64("focal-length")
+		p.ZMin, _ = cmd.Flags().GetFloat64("z-min")
+		p.ZMax, _ = cmd.Flags().GetFloat64("z-max")
+		p.LabelSize, _ = cmd.Flags().GetFloat64("label-size")
 		power, _ := cmd.Flags().GetInt("power")
 		feed, _ := cmd.Flags().GetInt("feed")
-		focal, _ := cmd.Flags().GetFloat64("focal-length")
-		totalZtravel := Zmax - Zmin
-		xtravel := float64(50)
-		// slope := totalZtravel / xtravel
-		g := util.Gcode("")
-
-		// xtmp := 25.0
-		// z := util.CalculateRise(slope, xtmp)
-		// fmt.Println(Zmin + z)
-		// out := util.G90Preamble()
-
-		g.G91Preamble()
-		g.Add("G0 Z%.2f ; Move to focal", focal)
-		g.Add("G0 Z%.2f ; Move down", Zmin)
-
-		g.Add("M3 S%d ; Set spindle", power)
-		g.Add("G01 X%.2f Z%.2f F%d ; Move right and up\n", xtravel, totalZtravel, feed)
-		g.Add(`M5; Turn off spindle`)
-
-		g.Add("G0 X-%.2f Y-1 Z-%.2f ; return to start\n", xtravel, totalZtravel)
-		g.Add("M3 S%d ; Set spindle", power)
-		g.Add("G01 Y2 F%d ; draw tick", feed)
-		g.Add("M5 ; Set spindle")
-		g.Add("G0 Y-1 ")
-
-		zCur := focal + Zmin
-		chart := ""
-
-		for i := 0; i < 10; i++ {
-
-			g.Add("G0 X%.2f Y-1 Z%.2f; Move right\n", xtravel/10.0, totalZtravel/10.0)
-			g.Add("M3 S%d ; Set spindle", power)
-			g.Add("G01 Y2 F%d ; draw tick", feed)
-			g.Add("M5 ; Set spindle")
-			g.Add("G0 Y-1 ")
-			chart += fmt.Sprintf("; %d: %.2f\n", i+1, zCur)
-			zCur += totalZtravel / 10.0
-
+		p.Power, p.Feed = float64(power), float64(feed)
+		if err := p.Validate(); err != nil {
+			log.Fatal(err)
 		}
 
-		g.Print()
+		if cmd.Flags().Changed("calculate") {
+			x, _ := cmd.Flags().GetFloat64("calculate")
+			z, err := p.ZAt(x)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("X%.3f on the test line was burnt at Z%.3f\n", x, z)
+			if save, _ := cmd.Flags().GetBool("save"); save {
+				name, _ := cmd.Flags().GetString("profile")
+				prof, err := profile.Load(name)
+				if err != nil {
+					log.Fatal(err)
+				}
+				prof.Laser.FocusZ = z
+				if err := prof.Save(); err != nil {
+					log.Fatal(err)
+				}
+				fmt.Printf("focus Z saved to profile %s\n", name)
+			}
+			return
+		}
 
-		fmt.Println(chart)
+		g, err := laser.Focus(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeLaser(cmd, string(g))
 	},
 }
 
@@ -90,4 +80,10 @@ func init() {
 	focusCmd.Flags().Float64P("focal-length", "F", 40, "rough focal length")
 	focusCmd.Flags().Float64P("z-min", "z", -5, "lowest Z value")
 	focusCmd.Flags().Float64P("z-max", "Z", 5, "highest Z value")
+	focusCmd.Flags().StringP("mode", "m", laser.Ramp, "ramp or staircase")
+	focusCmd.Flags().Float64P("length", "l", 50, "length of the test line")
+	focusCmd.Flags().IntP("steps", "n", 10, "ramp divisions or staircase segments")
+	focusCmd.Flags().Float64("label-size", 2, "tick label height, 0 for no labels")
+	focusCmd.Flags().Float64P("calculate", "c", 0, "X of the best point on the burnt line, prints its Z instead of generating the test")
+	focusCmd.Flags().Bool("save", false, "store the calculated Z in the machine profile")
 }
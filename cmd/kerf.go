@@ -0,0 +1,91 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/redt1de/cnctools/laser"
+	"github.com/redt1de/cnctools/profile"
+	"github.com/spf13/cobra"
+)
+
+// kerfCmd represents the kerf command
+var kerfCmd = &cobra.Command{
+	Use:   "kerf",
+	Short: "generate a kerf and beam diameter test and store the results",
+	Long: `Cuts a comb of square pieces of known nominal size and engraves a ladder of filled squares
+with growing line intervals above it. The focus Z is taken from the machine profile when set.
+
+1. zero X and Y at the bottom left of the test, run the program
+2. push the cut pieces together in a row and measure their total length
+3. find the widest ladder interval whose square still shows no gaps between the lines
+4. run kerf again with --measured [length] and --beam [interval], add --save to store the kerf
+   and beam diameter in the machine profile for fills and cut compensation
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := laser.DefaultKerfParams()
+		p.Pieces, _ = cmd.Flags().GetInt("pieces")
+		p.Size, _ = cmd.Flags().GetFloat64("size")
+		p.Passes, _ = cmd.Flags().GetInt("passes")
+		p.Power, _ = cmd.Flags().GetFloat64("power")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed")
+		p.Intervals, _ = cmd.Flags().GetFloat64Slice("intervals")
+		p.Engrave, _ = cmd.Flags().GetFloat64("engrave-power")
+		p.Speed, _ = cmd.Flags().GetFloat64("engrave-feed")
+		name, _ := cmd.Flags().GetString("profile")
+		prof, err := profile.Load(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		measured, _ := cmd.Flags().GetFloat64("measured")
+		beam, _ := cmd.Flags().GetFloat64("beam")
+		if measured > 0 || beam > 0 {
+			if measured > 0 {
+				kerf, err := laser.KerfFromPieces(p.Size, p.Pieces, measured)
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Printf("kerf %.3fmm, each piece comes out %.3fmm\n", kerf, p.Size-kerf)
+				prof.Laser.Kerf = kerf
+			}
+			if beam > 0 {
+				fmt.Printf("beam diameter %.3fmm\n", beam)
+				prof.Laser.BeamDiameter = beam
+			}
+			if save, _ := cmd.Flags().GetBool("save"); save {
+				if err := prof.Save(); err != nil {
+					log.Fatal(err)
+				}
+				fmt.Printf("saved to profile %s\n", name)
+			}
+			return
+		}
+
+		p.FocusZ = prof.Laser.FocusZ
+		g, err := laser.Kerf(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeLaser(cmd, string(g))
+	},
+}
+
+func init() {
+	laserCmd.AddCommand(kerfCmd)
+	d := laser.DefaultKerfParams()
+	kerfCmd.Flags().IntP("pieces", "n", d.Pieces, "number of pieces in the comb")
+	kerfCmd.Flags().Float64P("size", "s", d.Size, "nominal piece size")
+	kerfCmd.Flags().Int("passes", d.Passes, "cutting passes")
+	kerfCmd.Flags().Float64P("power", "p", d.Power, "cutting power")
+	kerfCmd.Flags().Float64P("feed", "f", d.Feed, "cutting feed rate")
+	kerfCmd.Flags().Float64Slice("intervals", d.Intervals, "ladder line intervals")
+	kerfCmd.Flags().Float64("engrave-power", d.Engrave, "ladder power")
+	kerfCmd.Flags().Float64("engrave-feed", d.Speed, "ladder feed rate")
+	kerfCmd.Flags().Float64P("measured", "m", 0, "measured length of the pieces pushed together")
+	kerfCmd.Flags().Float64P("beam", "b", 0, "widest ladder interval without gaps")
+	kerfCmd.Flags().Bool("save", false, "store the results in the machine profile")
+}
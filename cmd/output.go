@@ -0,0 +1,73 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/redt1de/cnctools/dialect"
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/profile"
+	"github.com/spf13/cobra"
+)
+
+// outputDialect returns the controller dialect picked with --controller, or the one saved in
+// the profile, or GRBL
+func outputDialect(cmd *cobra.Command) (dialect.Controller, error) {
+	name, _ := cmd.Flags().GetString("controller")
+	if name == "" {
+		pname, _ := cmd.Flags().GetString("profile")
+		prof, err := profile.Load(pname)
+		if err != nil {
+			return dialect.Controller{}, err
+		}
+		name = prof.Machine.Controller
+	}
+	if name == "" {
+		name = dialect.Default
+	}
+	c, err := dialect.Get(name)
+	if numbers, _ := cmd.Flags().GetBool("line-numbers"); numbers {
+		c.LineNumbers = true
+	}
+	return c, err
+}
+
+// write prints a generated program in the dialect of the controller
+func write(cmd *cobra.Command, program string) {
+	blocks, err := gcode.ParseString(program)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writeBlocks(cmd, blocks)
+}
+
+// writeLaser is write for a laser program, where M4 is dynamic laser power
+func writeLaser(cmd *cobra.Command, program string) {
+	blocks, err := gcode.ParseString(program)
+	if err != nil {
+		log.Fatal(err)
+	}
+	output(cmd, blocks, true)
+}
+
+// writeBlocks is write for a parsed program
+func writeBlocks(cmd *cobra.Command, blocks []gcode.Block) {
+	output(cmd, blocks, false)
+}
+
+// output prints blocks in the dialect of the controller
+func output(cmd *cobra.Command, blocks []gcode.Block, laser bool) {
+	d, err := outputDialect(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	d.Laser = laser
+	out, err := dialect.WriteBlocks(d, blocks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(out)
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/redt1de/cnctools/autolevel"
+	"github.com/redt1de/cnctools/gerber"
+	"github.com/spf13/cobra"
+)
+
+// pcbCmd represents the pcb command
+var pcbCmd = &cobra.Command{
+	Use:   "pcb",
+	Short: "generate isolation routing gcode from a gerber file",
+	Long: `Reads a Gerber RS-274X copper layer and cuts isolation passes around the copper. Zero Z on
+the copper surface. Pass a height map from the autolevel command with --map to level the
+output in the same step.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		mapFile, _ := cmd.Flags().GetString("map")
+		seg, _ := cmd.Flags().GetFloat64("segment")
+		conventional, _ := cmd.Flags().GetBool("conventional")
+
+		p := gerber.DefaultIsolateParams()
+		p.ToolWidth, _ = cmd.Flags().GetFloat64("tool-width")
+		p.Passes, _ = cmd.Flags().GetInt("passes")
+		p.Overlap, _ = cmd.Flags().GetFloat64("overlap")
+		p.Depth, _ = cmd.Flags().GetFloat64("depth")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed-rate")
+		p.PlungeFeed, _ = cmd.Flags().GetFloat64("plunge-rate")
+		p.Spindle, _ = cmd.Flags().GetFloat64("spindle")
+		p.SafeZ, _ = cmd.Flags().GetFloat64("safe-height")
+		p.Resolution, _ = cmd.Flags().GetFloat64("resolution")
+		p.Climb = !conventional
+
+		img, err := gerber.ParseFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g, err := gerber.Isolate(img, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if mapFile == "" {
+			write(cmd, string(g))
+			return
+		}
+
+		hm, err := autolevel.LoadHeightMap(mapFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := autolevel.ApplyHeightMapLines(strings.Split(strings.TrimSuffix(string(g), "\n"), "\n"), hm, seg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(cmd, strings.Join(out, "\n"))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pcbCmd)
+	pcbCmd.Flags().StringP("file", "i", "", "gerber copper layer")
+	pcbCmd.Flags().Float64P("tool-width", "t", 0.2, "width of the cut at depth")
+	pcbCmd.Flags().IntP("passes", "n", 2, "number of isolation passes")
+	pcbCmd.Flags().Float64P("overlap", "o", 25, "overlap between passes in percent of the tool width")
+	pcbCmd.Flags().Float64P("depth", "d", 0.05, "cut depth")
+	pcbCmd.Flags().Float64P("feed-rate", "f", 200, "feed rate")
+	pcbCmd.Flags().Float64P("plunge-rate", "p", 50, "plunge feed rate")
+	pcbCmd.Flags().Float64("spindle", 12000, "spindle speed")
+	pcbCmd.Flags().Float64("safe-height", 2, "safe Z height")
+	pcbCmd.Flags().Float64("resolution", 0.02, "grid resolution used to offset the copper")
+	pcbCmd.Flags().Bool("conventional", false, "conventional instead of climb milling")
+	pcbCmd.Flags().StringP("map", "m", "", "height map to apply to the output, see autolevel")
+	pcbCmd.Flags().Float64P("segment", "s", autolevel.DefaultSegmentLength, "split moves longer than this when leveling")
+	pcbCmd.MarkFlagRequired("file")
+}
+
+// readLines reads a text file into lines
+func readLines(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return lines, nil
+}
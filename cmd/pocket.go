@@ -0,0 +1,76 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/pocket"
+	"github.com/spf13/cobra"
+)
+
+// pocketCmd represents the pocket command
+var pocketCmd = &cobra.Command{
+	Use:   "pocket",
+	Short: "generate pocketing gcode for closed contours",
+	Long: `Clears closed contours from a DXF file to depth. Contours nested inside another contour
+are treated as islands and left standing. Zero Z on the stock top.
+
+Strategies:
+  offset  contour parallel loops, cut from the centre outwards
+  zigzag  raster rows along X followed by a contour cleanup
+
+Roughing leaves --finish on the walls, the finishing pass then follows the walls once at full
+depth after the last roughing pass.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		p := pocket.DefaultParams()
+		p.ToolDiameter, _ = cmd.Flags().GetFloat64("tool")
+		p.StepOver, _ = cmd.Flags().GetFloat64("step-over")
+		p.StepDown, _ = cmd.Flags().GetFloat64("step-down")
+		p.Depth, _ = cmd.Flags().GetFloat64("depth")
+		p.Strategy, _ = cmd.Flags().GetString("strategy")
+		p.Finish, _ = cmd.Flags().GetFloat64("finish")
+		noFinish, _ := cmd.Flags().GetBool("no-finish")
+		p.FinishPass = !noFinish
+		p.RampAngle, _ = cmd.Flags().GetFloat64("ramp-angle")
+		p.HelixDiameter, _ = cmd.Flags().GetFloat64("helix-dia")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed-rate")
+		p.PlungeFeed, _ = cmd.Flags().GetFloat64("plunge-rate")
+		p.Spindle, _ = cmd.Flags().GetFloat64("spindle")
+		p.SafeZ, _ = cmd.Flags().GetFloat64("safe-height")
+		p.Resolution, _ = cmd.Flags().GetFloat64("resolution")
+
+		drawing, err := geom.ReadDXFFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g, err := pocket.Generate(drawing.Shapes(), p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(cmd, string(g))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pocketCmd)
+	pocketCmd.Flags().StringP("file", "i", "", "DXF file with the pocket contours")
+	pocketCmd.Flags().Float64P("tool", "t", 6, "tool diameter")
+	pocketCmd.Flags().Float64P("step-over", "s", 40, "step over in percent of the tool diameter")
+	pocketCmd.Flags().Float64P("step-down", "z", 1, "max depth per pass")
+	pocketCmd.Flags().Float64P("depth", "d", 3, "total pocket depth")
+	pocketCmd.Flags().StringP("strategy", "S", pocket.Offset, "clearing strategy, offset or zigzag")
+	pocketCmd.Flags().Float64("finish", 0, "radial stock to leave for the finishing pass")
+	pocketCmd.Flags().Bool("no-finish", false, "skip the finishing pass")
+	pocketCmd.Flags().Float64("ramp-angle", 3, "helix and ramp entry angle in degrees")
+	pocketCmd.Flags().Float64("helix-dia", 0, "helix entry diameter, defaults to half the tool diameter")
+	pocketCmd.Flags().Float64P("feed-rate", "f", 800, "feed rate")
+	pocketCmd.Flags().Float64P("plunge-rate", "p", 200, "plunge and ramp feed rate")
+	pocketCmd.Flags().Float64("spindle", 10000, "spindle speed")
+	pocketCmd.Flags().Float64("safe-height", 5, "safe Z height")
+	pocketCmd.Flags().Float64("resolution", 0, "offset grid resolution, defaults to 1/25 of the tool diameter")
+	pocketCmd.MarkFlagRequired("file")
+}
@@ -4,18 +4,13 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
+	"log"
 
+	"github.com/redt1de/cnctools/profile"
 	"github.com/redt1de/cnctools/util"
 	"github.com/spf13/cobra"
 )
 
-const (
-	beamDia = 0.2
-	overlap = 0.5
-	boxSize = 2
-)
-
 // powerCmd represents the power command
 var powerCmd = &cobra.Command{
 	Use:   "power",
@@ -24,13 +19,18 @@ var powerCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		boxSize := 5.0
 		power := 1000.0
-		beamDiameter := 0.2
+		name, _ := cmd.Flags().GetString("profile")
+		prof, err := profile.Load(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		beamDiameter := prof.Laser.Beam()
 		overlap := 0.5
 		feedrate := 500.0
 
-		gcode := `G21\nG91\n`
+		gcode := util.G91Preamble()
 		gcode += util.G91SpiralFill(boxSize, power, beamDiameter, overlap, feedrate)
-		fmt.Println(gcode)
+		writeLaser(cmd, gcode)
 	},
 }
 
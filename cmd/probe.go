@@ -4,9 +4,7 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-	"strings"
-
+	"github.com/redt1de/cnctools/util"
 	"github.com/spf13/cobra"
 )
 
@@ -35,22 +33,23 @@ var probeCmd = &cobra.Command{
 		curX := xStart
 		curY := yStart
 
-		//
-		p("G21\nG90")
-		p("G0 Z%.1f", safe)
-		// p("G90 G0 X%.3f Y%.3f", curX, curY)
+		g := util.Gcode("")
+		g.G90Preamble()
+		g.Add("G0 Z%.1f", safe)
+		// g.Add("G90 G0 X%.3f Y%.3f", curX, curY)
 
 		for i := 0; i < gridSizeX; i++ {
 			for j := 0; j < gridSizeY; j++ {
-				p("\nG90 G0 X%.3f Y%.3f", curX, curY)
-				p("G38.2 Z%.1f F%d", depth, feedZ)
-				p("G0 Z%.1f", safe)
+				g.Add("\nG90 G0 X%.3f Y%.3f", curX, curY)
+				g.Add("G38.2 Z%.1f F%d", depth, feedZ)
+				g.Add("G0 Z%.1f", safe)
 
 				curX += xInterval
 			}
 			curX = xStart
 			curY += yInterval
 		}
+		write(cmd, string(g))
 
 	},
 }
@@ -97,10 +96,3 @@ func init() {
 // G90 G0 X10.000 Y10.000 F600
 // G38.2 Z-5 F50
 // G0 Z3
-
-func p(format string, args ...interface{}) {
-	if !strings.HasSuffix(format, "\n") {
-		format += "\n"
-	}
-	fmt.Printf(format, args...)
-}
@@ -42,6 +42,9 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cnctools.yaml)")
+	rootCmd.PersistentFlags().String("profile", "default", "machine profile holding calibration results, a name or a .json file")
+	rootCmd.PersistentFlags().String("controller", "", "controller dialect to write programs in (default from the profile, else grbl)")
+	rootCmd.PersistentFlags().Bool("line-numbers", false, "number the lines of generated programs")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -0,0 +1,71 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/post"
+	"github.com/spf13/cobra"
+)
+
+// rotaryCmd represents the rotary command
+var rotaryCmd = &cobra.Command{
+	Use:   "rotary",
+	Short: "wrap the Y axis of a gcode file around a rotary",
+	Long: `Rewrites a flat program, laser or engraving output, for a cylinder on a rotary. Y0 of the
+program lands where the rotary starts.
+
+With a chuck rotary on the A axis, Y becomes A degrees around an object of --diameter. With a
+roller rotary wired to the Y motor, Y is rescaled so the surface moves the programmed distance,
+give --scale or --roller-dia, --steps-per-rev and --y-steps to work it out. Arcs through Y are
+broken into lines and feed rates are corrected so the surface speed matches the program.
+
+  cnctools laser fill -i logo.svg | cnctools rotary -i - --diameter 82`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := post.DefaultRotaryParams()
+		p.Diameter, _ = cmd.Flags().GetFloat64("diameter")
+		p.Tolerance, _ = cmd.Flags().GetFloat64("tolerance")
+		if roller, _ := cmd.Flags().GetBool("roller"); roller {
+			p.Mode = post.Roller
+			p.Scale, _ = cmd.Flags().GetFloat64("scale")
+			if cmd.Flags().Changed("roller-dia") {
+				dia, _ := cmd.Flags().GetFloat64("roller-dia")
+				rev, _ := cmd.Flags().GetFloat64("steps-per-rev")
+				steps, _ := cmd.Flags().GetFloat64("y-steps")
+				scale, err := post.RollerScale(dia, rev, steps)
+				if err != nil {
+					log.Fatal(err)
+				}
+				p.Scale = scale
+			}
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		blocks, err := gcode.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := post.Rotary(blocks, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeBlocks(cmd, out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotaryCmd)
+	d := post.DefaultRotaryParams()
+	rotaryCmd.Flags().StringP("file", "i", "", "gcode file, - for standard input")
+	rotaryCmd.Flags().Float64P("diameter", "d", d.Diameter, "object diameter on a chuck rotary")
+	rotaryCmd.Flags().Bool("roller", false, "roller rotary on the Y motor instead of a chuck on A")
+	rotaryCmd.Flags().Float64P("scale", "s", d.Scale, "commanded Y per mm of surface on a roller rotary")
+	rotaryCmd.Flags().Float64("roller-dia", 0, "roller diameter, works out the scale")
+	rotaryCmd.Flags().Float64("steps-per-rev", 3200, "motor steps per roller revolution including microstepping")
+	rotaryCmd.Flags().Float64("y-steps", 80, "Y steps per mm set on the controller ($101)")
+	rotaryCmd.Flags().Float64("tolerance", d.Tolerance, "chord error when breaking arcs into lines")
+	rotaryCmd.MarkFlagRequired("file")
+}
@@ -4,104 +4,132 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
+	"log"
 
+	"github.com/redt1de/cnctools/autolevel"
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/surface"
 	"github.com/spf13/cobra"
 )
 
-const (
-	spindleSpeed = 10000
-	cornerSize   = 10
-	Conventional = 0
-	Climb        = 1
-)
-
-var (
-	xMax     float64
-	yMax     float64
-	cutDepth float64
-	stepOver float64
-	feedRate float64
-	climb    bool
-	corner   bool
-)
-
 // spoilboardCmd represents the spoilboard command
 var spoilboardCmd = &cobra.Command{
 	Use:     "spoilboard",
 	Aliases: []string{"spoil"},
 	Short:   "generate surfacing gcode",
-	Long:    `Zero on corner and define X and Y limits, optionally set cut depth, step over and feed rate.`,
+	Long: `Zero on corner and define X and Y limits, optionally set cut depth, step over and feed rate.
+The area can be moved with --origin, taken from the extents of a G-code file with --bounds, or
+replaced by the closed contours of a DXF or SVG file with --region to resurface just one damaged
+patch. The outer pass hangs --overhang percent of the cutter past the board edges so they are fully faced.
+
+Strategies:
+  spiral    rectangular loops from the edges inwards, finishing along the middle
+  raster-x  rows along X
+  raster-y  rows along Y
+
+Cutting is conventional by default. Climb and conventional depend on the spindle direction, the
+winding and row direction follow --m4. With one way raster rows the tool rapids back along the
+row it just cut before stepping over.
+
+A registration corner gives stock a square stop at a known position. --register fence leaves
+an L shaped fence standing along the two edges at --corner, --register pocket cuts a square
+recess open to those edges, and --dowels drills pin holes along them after a drill change.
+
+  cnctools spoilboard -x 600 -y 400 --register fence --corner tl --corner-size 150
+  cnctools spoilboard -x 600 -y 400 --dowels 3 --dowel-dia 6 --dowel-spacing 80`,
 	Run: func(cmd *cobra.Command, args []string) {
-		startX, startY := 0.0, 0.0
-		xMax, _ = cmd.Flags().GetFloat64("x-max")
-		yMax, _ = cmd.Flags().GetFloat64("y-max")
-		cutDepth, _ = cmd.Flags().GetFloat64("depth")
-		stepOver, _ = cmd.Flags().GetFloat64("step-over")
-		feedRate, _ = cmd.Flags().GetFloat64("feed-rate")
-		corner, _ = cmd.Flags().GetBool("corner")
-		mode := Conventional
-		if climb {
-			mode = Climb
+		p := surface.DefaultParams()
+		p.Width, _ = cmd.Flags().GetFloat64("x-max")
+		p.Height, _ = cmd.Flags().GetFloat64("y-max")
+		p.ToolDiameter, _ = cmd.Flags().GetFloat64("tool")
+		p.Depth, _ = cmd.Flags().GetFloat64("depth")
+		p.StepDown, _ = cmd.Flags().GetFloat64("step-down")
+		p.StepOver, _ = cmd.Flags().GetFloat64("step-over")
+		p.Overhang, _ = cmd.Flags().GetFloat64("overhang")
+		p.Strategy, _ = cmd.Flags().GetString("strategy")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed-rate")
+		p.PlungeFeed, _ = cmd.Flags().GetFloat64("plunge-rate")
+		p.Spindle, _ = cmd.Flags().GetFloat64("spindle")
+		p.SafeZ, _ = cmd.Flags().GetFloat64("safe-height")
+		p.SpindleCCW, _ = cmd.Flags().GetBool("m4")
+		climb, _ := cmd.Flags().GetBool("climb")
+		mixed, _ := cmd.Flags().GetBool("mixed")
+		switch {
+		case climb && mixed:
+			log.Fatal("--climb and --mixed can not be used together")
+		case climb:
+			p.Direction = surface.Climb
+		case mixed:
+			p.Direction = surface.Mixed
 		}
-		gcode := GenerateRectangularSpiralSurfacing(startX, startY, xMax, yMax, cutDepth, feedRate, stepOver, mode)
-		fmt.Println(gcode)
-
+		r := &p.Registration
+		r.Style, _ = cmd.Flags().GetString("register")
+		r.Corner, _ = cmd.Flags().GetString("corner")
+		r.Size, _ = cmd.Flags().GetFloat64("corner-size")
+		r.Width, _ = cmd.Flags().GetFloat64("fence-width")
+		r.Depth, _ = cmd.Flags().GetFloat64("pocket-depth")
+		r.Dowels, _ = cmd.Flags().GetInt("dowels")
+		r.DowelDiameter, _ = cmd.Flags().GetFloat64("dowel-dia")
+		r.DowelSpacing, _ = cmd.Flags().GetFloat64("dowel-spacing")
+		r.DowelInset, _ = cmd.Flags().GetFloat64("dowel-inset")
+		r.DowelDepth, _ = cmd.Flags().GetFloat64("dowel-depth")
+		if origin, _ := cmd.Flags().GetFloat64Slice("origin"); len(origin) > 1 {
+			p.Origin = geom.Point{X: origin[0], Y: origin[1]}
+		}
+		if file, _ := cmd.Flags().GetString("bounds"); file != "" {
+			b, err := autolevel.ParseGcodeBoundaries(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if b.MinX > b.MaxX || b.MinY > b.MaxY {
+				log.Fatalf("no XY moves in %s", file)
+			}
+			p.Origin = geom.Point{X: b.MinX, Y: b.MinY}
+			p.Width, p.Height = b.MaxX-b.MinX, b.MaxY-b.MinY
+		}
+		if file, _ := cmd.Flags().GetString("region"); file != "" {
+			drawing, err := geom.ReadDrawing(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			p.Region = drawing.Shapes()
+		}
+		g, err := surface.Generate(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(cmd, string(g))
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(spoilboardCmd)
-	spoilboardCmd.Flags().Float64P("x-max", "x", 200, "X max position")
-	spoilboardCmd.Flags().Float64P("y-max", "y", 150, "Y max position")
-	spoilboardCmd.Flags().Float64P("depth", "d", 2, "depth of cut")
+	spoilboardCmd.Flags().Float64P("x-max", "x", 200, "X size from the origin")
+	spoilboardCmd.Flags().Float64P("y-max", "y", 150, "Y size from the origin")
+	spoilboardCmd.Flags().Float64Slice("origin", []float64{0, 0}, "corner of the area to surface x,y")
+	spoilboardCmd.Flags().String("bounds", "", "surface the extents of the moves in this G-code file")
+	spoilboardCmd.Flags().StringP("region", "r", "", "surface inside the closed contours of this DXF or SVG file")
+	spoilboardCmd.Flags().Float64P("tool", "t", 16, "tool diameter")
+	spoilboardCmd.Flags().Float64P("depth", "d", 2, "total depth of cut")
+	spoilboardCmd.Flags().Float64P("step-down", "z", 2, "max depth per pass")
 	spoilboardCmd.Flags().Float64P("step-over", "s", 8, "stepover, should be roughly half of the tool diameter")
+	spoilboardCmd.Flags().Float64("overhang", 60, "percent of the tool diameter hanging past the board edges")
+	spoilboardCmd.Flags().StringP("strategy", "S", surface.Spiral, "spiral, raster-x or raster-y")
 	spoilboardCmd.Flags().Float64P("feed-rate", "f", 100, "feed rate")
-	spoilboardCmd.Flags().BoolP("corner", "c", false, "leave an alignement corner")
-}
-
-// GenerateRectangularSpiralSurfacing generates G-code for a rectangular spiral surfacing operation.
-// Arguments: xMax, yMax -> size of the spoilboard; cutDepth -> depth of the cut; feedRate -> feed rate in units/min; stepover -> distance between successive spiral loops; cuttingMode -> conventional or climb cutting.
-func GenerateRectangularSpiralSurfacing(startX, startY, xMax, yMax, cutDepth, feedRate, stepover float64, cuttingMode int) string {
-	z := -cutDepth
-	gcode := ""
-
-	gcode += "G21 ; Set units to mm\n"
-	gcode += "G90 ; Absolute positioning\n"
-
-	gcode += fmt.Sprintf("G0 X%.2f Y%.2f ; Move to starting corner\n", startX, startY)
-	gcode += fmt.Sprintf("M3 S%d ; Start spindle\n", spindleSpeed)
-	gcode += fmt.Sprintf("G1 Z%.2f F25 ; Move down to fixed cutting depth\n", z)
-
-	if corner {
-		gcode += fmt.Sprintf("G1 X%.2f Y%.2f F%.2f\n", startX+cornerSize, startY+cornerSize, feedRate)
-		startX += cornerSize
-		startY += cornerSize
-		gcode += fmt.Sprintf("G1 Y%.2fF%.2f\n", yMax, feedRate)
-		gcode += fmt.Sprintf("G1 Y%.2fF%.2f\n", startY, feedRate)
-
-	}
-
-	gcode += fmt.Sprintf("G1 F%.2f ; Set feed rate\n", feedRate)
-	xMin, yMin := startX, startY
-	xMaxCurrent, yMaxCurrent := xMax, yMax
-
-	// Loop to generate rectangular spiral moves
-	for xMin < xMaxCurrent && yMin < yMaxCurrent {
-		gcode += fmt.Sprintf("G1 X%.2f Y%.2f\n", xMaxCurrent, yMin)
-		gcode += fmt.Sprintf("G1 X%.2f Y%.2f\n", xMaxCurrent, yMaxCurrent)
-		gcode += fmt.Sprintf("G1 X%.2f Y%.2f\n", xMin, yMaxCurrent)
-		gcode += fmt.Sprintf("G1 X%.2f Y%.2f\n", xMin, yMin+stepover)
-
-		xMin += stepover
-		yMin += stepover
-		xMaxCurrent -= stepover
-		yMaxCurrent -= stepover
-	}
-
-	gcode += "G0 Z5.00 ; Retract tool\n"
-	gcode += "M5 ; Stop spindle\n"
-	gcode += "M30 ; End program\n"
-
-	return gcode
+	spoilboardCmd.Flags().Float64P("plunge-rate", "p", 25, "plunge feed rate")
+	spoilboardCmd.Flags().Float64("spindle", 10000, "spindle speed")
+	spoilboardCmd.Flags().Float64("safe-height", 5, "safe Z height")
+	spoilboardCmd.Flags().Bool("climb", false, "climb mill, the default is conventional")
+	spoilboardCmd.Flags().Bool("mixed", false, "zig-zag raster rows, or alternate the spiral winding on each pass")
+	spoilboardCmd.Flags().Bool("m4", false, "spindle turns counter clockwise (M4), swapping climb and conventional")
+	spoilboardCmd.Flags().String("register", "", "registration feature at the corner, fence or pocket")
+	spoilboardCmd.Flags().StringP("corner", "c", "bl", "registration corner, bl, br, tl or tr")
+	spoilboardCmd.Flags().Float64("corner-size", 0, "fence arm length (0 for the full edges) or pocket side")
+	spoilboardCmd.Flags().Float64("fence-width", 10, "registration fence width")
+	spoilboardCmd.Flags().Float64("pocket-depth", 3, "registration pocket depth below the surface")
+	spoilboardCmd.Flags().Int("dowels", 0, "dowel holes along each edge at the corner")
+	spoilboardCmd.Flags().Float64("dowel-dia", 6, "dowel hole diameter")
+	spoilboardCmd.Flags().Float64("dowel-spacing", 50, "distance between dowel holes")
+	spoilboardCmd.Flags().Float64("dowel-inset", 10, "distance from the board edges to the dowel holes")
+	spoilboardCmd.Flags().Float64("dowel-depth", 10, "dowel hole depth below the surface")
 }
@@ -0,0 +1,137 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/redt1de/cnctools/calibrate"
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/post"
+	"github.com/redt1de/cnctools/profile"
+	"github.com/spf13/cobra"
+)
+
+// squareCmd represents the calibrate square command
+var squareCmd = &cobra.Command{
+	Use:   "square",
+	Short: "measure how far the gantry is out of square",
+	Long: `Draws or cuts a rectangle with both diagonals from X0 Y0, --test prints the program. Make it
+as large as the machine allows. Measure diagonal 1, from the origin corner to the far corner,
+and diagonal 2, between the other two corners, and pass them with --diagonals to get the angle
+the Y axis leans towards +X. --save stores it in the machine profile for the skew command.
+
+  cnctools calibrate square --test -W 400 -H 300 > square.nc
+  cnctools calibrate square -W 400 -H 300 --diagonals 500.62,499.41 --save`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := calibrate.DefaultSquareParams()
+		p.Width, _ = cmd.Flags().GetFloat64("width")
+		p.Height, _ = cmd.Flags().GetFloat64("height")
+		mill, _ := cmd.Flags().GetBool("mill")
+		p.Draw.Laser = !mill
+		p.Draw.Power, _ = cmd.Flags().GetFloat64("power")
+		p.Draw.Spindle, _ = cmd.Flags().GetFloat64("spindle")
+		p.Draw.Depth, _ = cmd.Flags().GetFloat64("depth")
+		p.Draw.SafeZ, _ = cmd.Flags().GetFloat64("safe-height")
+		p.Draw.Feed, _ = cmd.Flags().GetFloat64("feed-rate")
+		p.Draw.PlungeFeed, _ = cmd.Flags().GetFloat64("plunge-rate")
+		if err := p.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		if test, _ := cmd.Flags().GetBool("test"); test {
+			g, err := calibrate.SquareTest(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+			write(cmd, string(g))
+			return
+		}
+
+		d, _ := cmd.Flags().GetFloat64Slice("diagonals")
+		if len(d) != 2 {
+			log.Fatal("give both diagonals with --diagonals d1,d2, or --test for the program")
+		}
+		angle, err := calibrate.Skew(p.Width, p.Height, d[0], d[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		// how far the top edge sits off where it belongs
+		fmt.Printf("Y leans %.4f degrees towards +X, %.3fmm over %.0fmm of Y\n", angle, p.Height*math.Sin(angle*math.Pi/180), p.Height)
+
+		if save, _ := cmd.Flags().GetBool("save"); save {
+			name, _ := cmd.Flags().GetString("profile")
+			prof, err := profile.Load(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			prof.Machine.Skew = angle
+			if err := prof.Save(); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("saved to profile %s\n", name)
+		}
+	},
+}
+
+// skewCmd represents the skew post processor command
+var skewCmd = &cobra.Command{
+	Use:   "skew",
+	Short: "correct a gcode file for an out of square gantry",
+	Long: `Shears the X and Y of a program so it comes out square on a machine whose Y axis leans
+towards +X. The angle comes from the machine profile (see calibrate square) unless given with
+--angle. Arcs are broken into lines, a skewed circle is no longer a circle.
+
+  cnctools skew -i part.nc > part-square.nc`,
+	Run: func(cmd *cobra.Command, args []string) {
+		angle, _ := cmd.Flags().GetFloat64("angle")
+		if !cmd.Flags().Changed("angle") {
+			name, _ := cmd.Flags().GetString("profile")
+			prof, err := profile.Load(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if prof.Machine.Skew == 0 {
+				log.Fatal("no skew in the profile, run calibrate square --save or use --angle")
+			}
+			angle = prof.Machine.Skew
+		}
+		tol, _ := cmd.Flags().GetFloat64("tolerance")
+
+		file, _ := cmd.Flags().GetString("file")
+		blocks, err := gcode.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := post.Transform(blocks, post.Skew(angle), tol)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeBlocks(cmd, out)
+	},
+}
+
+func init() {
+	calibrateCmd.AddCommand(squareCmd)
+	d := calibrate.DefaultSquareParams()
+	squareCmd.Flags().Float64P("width", "W", d.Width, "rectangle width")
+	squareCmd.Flags().Float64P("height", "H", d.Height, "rectangle height")
+	squareCmd.Flags().Bool("test", false, "print the rectangle program")
+	squareCmd.Flags().Float64SliceP("diagonals", "m", nil, "measured diagonals 1 and 2 as d1,d2")
+	squareCmd.Flags().Bool("save", false, "store the skew in the machine profile")
+	squareCmd.Flags().Float64P("power", "p", d.Draw.Power, "laser power")
+	squareCmd.Flags().Bool("mill", false, "engrave with a spindle instead of a laser")
+	squareCmd.Flags().Float64("spindle", d.Draw.Spindle, "spindle speed")
+	squareCmd.Flags().Float64P("depth", "d", d.Draw.Depth, "spindle engraving depth")
+	squareCmd.Flags().Float64("safe-height", d.Draw.SafeZ, "safe Z height")
+	squareCmd.Flags().Float64P("feed-rate", "f", d.Draw.Feed, "feed rate")
+	squareCmd.Flags().Float64("plunge-rate", d.Draw.PlungeFeed, "plunge feed rate")
+
+	rootCmd.AddCommand(skewCmd)
+	skewCmd.Flags().StringP("file", "i", "", "gcode file, - for standard input")
+	skewCmd.Flags().Float64P("angle", "a", 0, "degrees the Y axis leans towards +X, overrides the profile")
+	skewCmd.Flags().Float64("tolerance", 0.01, "chord error when breaking arcs into lines")
+	skewCmd.MarkFlagRequired("file")
+}
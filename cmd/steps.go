@@ -5,7 +5,12 @@ package cmd
 
 import (
 	"fmt"
+	"log"
+	"os"
+	"strings"
 
+	"github.com/redt1de/cnctools/calibrate"
+	"github.com/redt1de/cnctools/grbl"
 	"github.com/spf13/cobra"
 )
 
@@ -13,19 +18,140 @@ import (
 var stepsCmd = &cobra.Command{
 	Use:   "steps",
 	Short: "calibrate steps per millimeter",
-	Long:  ``,
+	Long: `Works out the $100, $101 and $102 steps per mm settings from measured test moves.
+
+1. print the test program with --test and run it, it pauses before and after each move
+2. measure how far each axis travelled, repeat a few times for an average
+3. run steps again with the current settings and the measurements, the new $ lines are
+   printed ready to send, or sent straight away with --port and --send
+
+The current settings come from a $$ dump (--settings), a live controller (--port, a serial
+device or host:port) or --current.
+
+  cnctools calibrate steps --test -a XY -d 200
+  cnctools calibrate steps --settings dump.txt -d 200 -m x=199.2,199.4 -m y=200.6`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := calibrate.DefaultStepsParams()
+		p.Axes, _ = cmd.Flags().GetString("axes")
+		p.Distance, _ = cmd.Flags().GetFloat64("distance")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed")
+		if test, _ := cmd.Flags().GetBool("test"); test {
+			g, err := calibrate.StepsTest(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+			write(cmd, string(g))
+			return
+		}
+
+		entries, _ := cmd.Flags().GetStringArray("measured")
+		measured, err := parseAxisValues(entries)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(measured) == 0 {
+			log.Fatal("no measurements, use --measured axis=value or --test for the test program")
+		}
+		entries, _ = cmd.Flags().GetStringSlice("current")
+		current, err := parseAxisValues(entries)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		settings := grbl.Settings{}
+		if file, _ := cmd.Flags().GetString("settings"); file != "" {
+			if settings, err = grbl.LoadSettings(file); err != nil {
+				log.Fatal(err)
+			}
+		}
+		var conn *grbl.Conn
+		if port, _ := cmd.Flags().GetString("port"); port != "" {
+			baud, _ := cmd.Flags().GetInt("baud")
+			if conn, err = grbl.Dial(port, baud); err != nil {
+				log.Fatal(err)
+			}
+			defer conn.Close()
+			if settings, err = conn.Settings(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		for a, v := range current {
+			n, _ := grbl.AxisSetting(grbl.StepsX, a)
+			settings[n] = v[len(v)-1]
+		}
+
+		out := grbl.Settings{}
+		for _, a := range []byte("XYZABC") {
+			m, ok := measured[a]
+			if !ok {
+				continue
+			}
+			n, _ := grbl.AxisSetting(grbl.StepsX, a)
+			cur, ok := settings[n]
+			if !ok {
+				log.Fatalf("no current $%d for %c, give --settings, --port or --current", n, a)
+			}
+			steps, err := calibrate.Steps(cur, p.Distance, m)
+			if err != nil {
+				log.Fatalf("%c: %v", a, err)
+			}
+			avg := 0.0
+			for _, v := range m {
+				avg += v / float64(len(m))
+			}
+			fmt.Fprintf(os.Stderr, "%c: $%d was %.3f, %d measurement(s) average %.3f over %.3f\n", a, n, cur, len(m), avg, p.Distance)
+			out[n] = steps
+		}
+		lines := out.Lines()
+		fmt.Println(strings.Join(lines, "\n"))
+
+		if send, _ := cmd.Flags().GetBool("send"); send {
+			if conn == nil {
+				log.Fatal("--send needs --port")
+			}
+			for n, v := range out {
+				if err := conn.Set(n, v); err != nil {
+					log.Fatal(err)
+				}
+			}
+			fmt.Fprintln(os.Stderr, "sent to the controller")
+		}
+	},
+}
+
+// legacyStepsCmd keeps the old top level steps command and its flags working
+var legacyStepsCmd = &cobra.Command{
+	Use:        "steps",
+	Short:      "calibrate steps per millimeter, moved to calibrate steps",
+	Deprecated: "use cnctools calibrate steps",
 	Run: func(cmd *cobra.Command, args []string) {
 		current, _ := cmd.Flags().GetFloat64("current")
 		target, _ := cmd.Flags().GetFloat64("target")
 		actual, _ := cmd.Flags().GetFloat64("actual")
-		steps := current / actual * target
+		steps, err := calibrate.Steps(current, target, []float64{actual})
+		if err != nil {
+			log.Fatal(err)
+		}
 		fmt.Printf("New steps per mm: %.3f\n", steps)
 	},
 }
 
 func init() {
-	rootCmd.AddCommand(stepsCmd)
-	stepsCmd.Flags().Float64P("current", "c", 0.0, "current steps")
-	stepsCmd.Flags().Float64P("target", "t", 25.0, "target distance")
-	stepsCmd.Flags().Float64P("actual", "a", 0.0, "actual distance traveled")
+	rootCmd.AddCommand(legacyStepsCmd)
+	legacyStepsCmd.Flags().Float64P("current", "c", 0.0, "current steps")
+	legacyStepsCmd.Flags().Float64P("target", "t", 25.0, "target distance")
+	legacyStepsCmd.Flags().Float64P("actual", "a", 0.0, "actual distance traveled")
+
+	calibrateCmd.AddCommand(stepsCmd)
+	d := calibrate.DefaultStepsParams()
+	stepsCmd.Flags().StringP("axes", "a", d.Axes, "axes for the test program")
+	stepsCmd.Flags().Float64P("distance", "d", d.Distance, "commanded test distance")
+	stepsCmd.Flags().Float64P("feed", "f", d.Feed, "test move feed rate")
+	stepsCmd.Flags().Bool("test", false, "print the test move program")
+	stepsCmd.Flags().StringArrayP("measured", "m", nil, "measured travel as axis=value[,value...], repeatable")
+	stepsCmd.Flags().StringSliceP("current", "c", nil, "current steps per mm as axis=value")
+	stepsCmd.Flags().StringP("settings", "s", "", "GRBL $$ dump holding the current settings")
+	stepsCmd.Flags().StringP("port", "P", "", "controller serial device or host:port")
+	stepsCmd.Flags().Int("baud", 115200, "serial baud rate")
+	stepsCmd.Flags().Bool("send", false, "send the new settings to the controller")
 }
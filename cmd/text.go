@@ -0,0 +1,96 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/text"
+	"github.com/redt1de/cnctools/util"
+	"github.com/spf13/cobra"
+)
+
+// textCmd represents the text command
+var textCmd = &cobra.Command{
+	Use:   "text [text]",
+	Short: "generate gcode to engrave text with a single-line font",
+	Long: `Engraves text with an embedded Hershey single-stroke font, with a laser or a spindle.
+The anchor point sits on the baseline of the first line. Use \n in the text for new lines.
+
+  cnctools text "HELLO" --size 10 --align center --at 50,20
+  cnctools text "AROUND THE TOP" --arc-radius 40 --arc-angle 90 --align center --laser`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		at, _ := cmd.Flags().GetFloat64Slice("at")
+		align, _ := cmd.Flags().GetString("align")
+		o := text.DefaultOptions()
+		o.Font, _ = cmd.Flags().GetString("font")
+		o.Size, _ = cmd.Flags().GetFloat64("size")
+		o.Rotation, _ = cmd.Flags().GetFloat64("rotate")
+		o.Spacing, _ = cmd.Flags().GetFloat64("spacing")
+		o.LineSpacing, _ = cmd.Flags().GetFloat64("line-spacing")
+		o.ArcRadius, _ = cmd.Flags().GetFloat64("arc-radius")
+		o.ArcAngle, _ = cmd.Flags().GetFloat64("arc-angle")
+
+		p := text.EngraveParams{}
+		p.Laser, _ = cmd.Flags().GetBool("laser")
+		p.Power, _ = cmd.Flags().GetFloat64("power")
+		p.Spindle, _ = cmd.Flags().GetFloat64("spindle")
+		p.Depth, _ = cmd.Flags().GetFloat64("depth")
+		p.SafeZ, _ = cmd.Flags().GetFloat64("safe-height")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed-rate")
+		p.PlungeFeed, _ = cmd.Flags().GetFloat64("plunge-rate")
+
+		var err error
+		if o.Align, err = text.ParseAlign(align); err != nil {
+			log.Fatal(err)
+		}
+		if err := p.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		origin := geom.Point{}
+		if len(at) > 1 {
+			origin = geom.Point{X: at[0], Y: at[1]}
+		}
+		paths, err := text.Strokes(strings.ReplaceAll(args[0], `\n`, "\n"), origin, o)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		g := util.Gcode("")
+		g.G90Preamble()
+		if !p.Laser {
+			g.Add("G0 Z%.3f ; Safe height", p.SafeZ)
+		}
+		text.Engrave(&g, paths, p)
+		g.Add("M30 ; End program")
+		if p.Laser {
+			writeLaser(cmd, string(g))
+			return
+		}
+		write(cmd, string(g))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(textCmd)
+	textCmd.Flags().String("font", "simplex", "font name")
+	textCmd.Flags().Float64P("size", "s", 5, "capital letter height")
+	textCmd.Flags().Float64SliceP("at", "a", []float64{0, 0}, "anchor position x,y")
+	textCmd.Flags().String("align", "left", "left, center or right")
+	textCmd.Flags().Float64P("rotate", "r", 0, "rotation in degrees, or angle around the arc centre")
+	textCmd.Flags().Float64("spacing", 0, "extra space between characters")
+	textCmd.Flags().Float64("line-spacing", 1.6, "distance between lines as a multiple of the size")
+	textCmd.Flags().Float64("arc-radius", 0, "lay the baseline on an arc of this radius around the anchor, negative to read along the bottom")
+	textCmd.Flags().Float64("arc-angle", 90, "angle on the arc where the aligned point of the text sits")
+	textCmd.Flags().BoolP("laser", "l", false, "engrave with a laser instead of a spindle")
+	textCmd.Flags().Float64P("power", "p", 500, "laser power")
+	textCmd.Flags().Float64("spindle", 10000, "spindle speed")
+	textCmd.Flags().Float64P("depth", "d", 0.2, "spindle engraving depth")
+	textCmd.Flags().Float64("safe-height", 2, "safe Z height")
+	textCmd.Flags().Float64P("feed-rate", "f", 600, "feed rate")
+	textCmd.Flags().Float64("plunge-rate", 100, "plunge feed rate")
+}
@@ -0,0 +1,235 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/grbl"
+	"github.com/redt1de/cnctools/post"
+	"github.com/spf13/cobra"
+)
+
+// toolchangeCmd represents the toolchange command
+var toolchangeCmd = &cobra.Command{
+	Use:   "toolchange",
+	Short: "replace M6 tool changes with a manual change and tool setter probe",
+	Long: `Replaces every M6 with a manual tool change for machines without a tool changer. The
+spindle stops, the machine parks at --park, pauses with M0 for the swap, touches the new tool
+off on the tool setter at --setter with G38.2 and re-zeroes work Z with G10 L20 from
+--setter-z, the work Z of the setter top. Positions other than --setter-z are machine
+coordinates.
+
+With --port the program is sent to the controller instead, and tool changes are run from the
+terminal. The tool in the spindle when it starts, zeroed on the work, is touched off first as
+the reference. With --method tlo new tools get a G43.1 tool length offset against it, with g10
+work Z is re-zeroed and --setter-z is not needed.
+
+  cnctools toolchange -i job.nc --park 0,0 --setter -5,-300 --setter-z -42.5 > job-manual.nc
+  cnctools toolchange -i job.nc --setter -5,-300 --method tlo --port /dev/ttyUSB0`,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := post.DefaultToolChangeParams()
+		p.Method, _ = cmd.Flags().GetString("method")
+		park, _ := cmd.Flags().GetFloat64Slice("park")
+		setter, _ := cmd.Flags().GetFloat64Slice("setter")
+		if len(park) != 2 || len(setter) != 2 {
+			log.Fatal("--park and --setter take x,y")
+		}
+		p.ParkX, p.ParkY = park[0], park[1]
+		p.SetterX, p.SetterY = setter[0], setter[1]
+		p.SetterZ, _ = cmd.Flags().GetFloat64("setter-z")
+		p.ProbeZ, _ = cmd.Flags().GetFloat64("probe-z")
+		p.Depth, _ = cmd.Flags().GetFloat64("depth")
+		p.SeekFeed, _ = cmd.Flags().GetFloat64("seek")
+		p.LatchFeed, _ = cmd.Flags().GetFloat64("latch")
+		p.PullOff, _ = cmd.Flags().GetFloat64("pull-off")
+		if err := p.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		blocks, err := gcode.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		port, _ := cmd.Flags().GetString("port")
+		if port == "" {
+			if !cmd.Flags().Changed("setter-z") {
+				log.Fatal("--setter-z is needed to re-zero work Z without the live sender")
+			}
+			out, err := post.ToolChange(blocks, p)
+			if err != nil {
+				log.Fatal(err)
+			}
+			writeBlocks(cmd, out)
+			return
+		}
+
+		if file == "-" {
+			log.Fatal("the live sender reads answers from standard input, give the program as a file")
+		}
+		// long moves and probing hold the answer back
+		grbl.Timeout = 5 * time.Minute
+		baud, _ := cmd.Flags().GetInt("baud")
+		conn, err := grbl.Dial(port, baud)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Echo = os.Stderr
+		if err := sendWithToolChanges(conn, blocks, p); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// sendWithToolChanges streams a program to the controller and runs its tool changes from the
+// terminal
+func sendWithToolChanges(conn *grbl.Conn, blocks []gcode.Block, p post.ToolChangeParams) error {
+	in := bufio.NewReader(os.Stdin)
+	prompt := func(format string, a ...interface{}) error {
+		fmt.Fprintf(os.Stderr, format+", then press enter ", a...)
+		_, err := in.ReadString('\n')
+		return err
+	}
+	send := func(line string) ([]string, error) {
+		b, err := gcode.ParseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		b.Comment = ""
+		if b.Empty() {
+			return nil, nil
+		}
+		return conn.Command(b.String())
+	}
+	// touch returns the machine Z the tool touches the setter at
+	touch := func() (float64, error) {
+		z := 0.0
+		for _, l := range p.Probe() {
+			lines, err := send(l)
+			if err != nil {
+				return 0, err
+			}
+			if strings.HasPrefix(l, "G38.2") {
+				pos, err := grbl.ProbeResult(lines)
+				if err != nil {
+					return 0, err
+				}
+				if len(pos) < 3 {
+					return 0, fmt.Errorf("the controller does not report Z")
+				}
+				z = pos[2]
+			}
+		}
+		return z, nil
+	}
+
+	if err := prompt("Touching off the reference tool, the one work Z was zeroed with"); err != nil {
+		return err
+	}
+	for _, l := range []string{"G21", "G90", post.Retract} {
+		if _, err := send(l); err != nil {
+			return err
+		}
+	}
+	ref, err := touch()
+	if err != nil {
+		return err
+	}
+	setterZ := 0.0 // work Z of the setter top
+	if p.Method == post.WorkZ {
+		offsets, err := conn.Offsets()
+		if err != nil {
+			return err
+		}
+		cs, err := conn.CoordinateSystem()
+		if err != nil {
+			return err
+		}
+		wco, g92, tlo := offsets[cs], offsets["G92"], offsets["TLO"]
+		if len(wco) < 3 || len(g92) < 3 || len(tlo) < 1 {
+			return fmt.Errorf("the controller does not report its offsets")
+		}
+		setterZ = ref - wco[2] - g92[2] - tlo[0]
+		fmt.Fprintf(os.Stderr, "the setter is at work Z %.3f\n", setterZ)
+	}
+	if _, err := send(post.Retract); err != nil {
+		return err
+	}
+
+	s := gcode.NewState()
+	tool := 0
+	for n, b := range blocks {
+		if _, _, err := s.Apply(b); err != nil {
+			return fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if t, ok := b.Get('T'); ok {
+			tool = int(t)
+		}
+		if !b.HasCode('M', 6) {
+			if b.Raw == "%" {
+				continue
+			}
+			if _, err := send(b.String()); err != nil {
+				return fmt.Errorf("line %d: %v", n+1, err)
+			}
+			continue
+		}
+		b.RemoveCode('M', 6)
+		b.Remove('T')
+		if _, err := send(b.String()); err != nil {
+			return fmt.Errorf("line %d: %v", n+1, err)
+		}
+
+		// the macro runs in mm and G90, the dwell waits for the machine to park before asking
+		enter, leave := post.MacroModes(s)
+		for _, l := range append(append(enter, p.Park(tool)...), "G4 P0.1") {
+			if _, err := send(l); err != nil {
+				return err
+			}
+		}
+		if err := prompt("Change to tool %d", tool); err != nil {
+			return err
+		}
+		z, err := touch()
+		if err != nil {
+			return err
+		}
+		offset := fmt.Sprintf("G10 L20 P0 Z%.4f", setterZ)
+		if p.Method == post.TLO {
+			offset = fmt.Sprintf("G43.1 Z%.4f", z-ref)
+		}
+		for _, l := range append([]string{offset, post.Retract}, leave...) {
+			if _, err := send(l); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(toolchangeCmd)
+	d := post.DefaultToolChangeParams()
+	toolchangeCmd.Flags().StringP("file", "i", "", "gcode file, - for standard input")
+	toolchangeCmd.Flags().StringP("method", "M", d.Method, "g10 to re-zero work Z, tlo for G43.1 offsets with --port")
+	toolchangeCmd.Flags().Float64Slice("park", []float64{0, 0}, "machine x,y to change tools at")
+	toolchangeCmd.Flags().Float64Slice("setter", nil, "machine x,y of the tool setter")
+	toolchangeCmd.Flags().Float64("setter-z", 0, "work Z of the tool setter top")
+	toolchangeCmd.Flags().Float64("probe-z", 0, "machine Z to start probing from")
+	toolchangeCmd.Flags().Float64P("depth", "d", d.Depth, "furthest the probe travels down")
+	toolchangeCmd.Flags().Float64("seek", d.SeekFeed, "first probing feed rate")
+	toolchangeCmd.Flags().Float64("latch", d.LatchFeed, "slow second probing feed rate")
+	toolchangeCmd.Flags().Float64("pull-off", d.PullOff, "lift between the two touches")
+	toolchangeCmd.Flags().StringP("port", "P", "", "controller serial device or host:port to send the program to")
+	toolchangeCmd.Flags().Int("baud", 115200, "serial baud rate")
+	toolchangeCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/post"
+	"github.com/spf13/cobra"
+)
+
+// transformCmd represents the transform command
+var transformCmd = &cobra.Command{
+	Use:   "transform",
+	Short: "move, rotate, mirror, scale or tile a gcode file",
+	Long: `Transforms the X and Y of a program. The steps are applied in the order scale, mirror,
+rotate, translate, with scaling, mirroring and rotation about --about. Mirroring swaps G2 and G3.
+Scaling different in X and Y would turn arcs into ellipses, so it is refused for programs with
+arcs unless --linearize breaks them into lines.
+
+--array repeats the result on a grid, --spacing apart. Programs written relative to where they
+start, like laser power, take their start as X0 Y0 and return to it between copies.
+
+  cnctools transform -i part.nc -t 100,50
+  cnctools transform -i part.nc -r 90 --about 50,50
+  cnctools transform -i part.nc --mirror x --about 100,0
+  cnctools transform -i part.nc -s 2,1 --linearize
+  cnctools laser power > power.nc && cnctools transform -i power.nc --array 3,2 --spacing 60,60`,
+	Run: func(cmd *cobra.Command, args []string) {
+		about, _ := cmd.Flags().GetFloat64Slice("about")
+		if len(about) != 2 {
+			log.Fatal("--about takes x,y")
+		}
+		cx, cy := about[0], about[1]
+
+		m := post.Identity()
+		if scale, _ := cmd.Flags().GetFloat64Slice("scale"); len(scale) > 0 {
+			sx, sy := scale[0], scale[0]
+			if len(scale) == 2 {
+				sy = scale[1]
+			} else if len(scale) > 2 {
+				log.Fatal("--scale takes s or sx,sy")
+			}
+			if sx <= 0 || sy <= 0 {
+				log.Fatal("scale must be positive, use --mirror to flip")
+			}
+			m = m.Then(post.Scale(sx, sy, cx, cy))
+		}
+		if mirror, _ := cmd.Flags().GetString("mirror"); mirror != "" {
+			mirror = strings.ToLower(mirror)
+			if strings.Trim(mirror, "xy") != "" {
+				log.Fatalf("bad mirror %q, use x, y or xy", mirror)
+			}
+			m = m.Then(post.Mirror(strings.Contains(mirror, "x"), strings.Contains(mirror, "y"), cx, cy))
+		}
+		if angle, _ := cmd.Flags().GetFloat64("rotate"); angle != 0 {
+			m = m.Then(post.Rotate(angle, cx, cy))
+		}
+		if t, _ := cmd.Flags().GetFloat64Slice("translate"); len(t) > 0 {
+			if len(t) != 2 {
+				log.Fatal("--translate takes dx,dy")
+			}
+			m = m.Then(post.Translate(t[0], t[1]))
+		}
+
+		tol := 0.0
+		if linearize, _ := cmd.Flags().GetBool("linearize"); linearize {
+			tol, _ = cmd.Flags().GetFloat64("tolerance")
+			if tol <= 0 {
+				log.Fatal("tolerance must be positive")
+			}
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		blocks, err := gcode.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		array, _ := cmd.Flags().GetIntSlice("array")
+		var out []gcode.Block
+		if len(array) > 0 {
+			if len(array) != 2 {
+				log.Fatal("--array takes columns,rows")
+			}
+			spacing, _ := cmd.Flags().GetFloat64Slice("spacing")
+			if len(spacing) != 2 {
+				log.Fatal("--spacing takes dx,dy")
+			}
+			out, err = post.Tile(blocks, m, array[0], array[1], spacing[0], spacing[1], tol)
+		} else {
+			out, err = post.Transform(blocks, m, tol)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeBlocks(cmd, out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(transformCmd)
+	transformCmd.Flags().StringP("file", "i", "", "gcode file, - for standard input")
+	transformCmd.Flags().Float64SliceP("translate", "t", nil, "move by dx,dy")
+	transformCmd.Flags().Float64P("rotate", "r", 0, "rotate degrees counter clockwise")
+	transformCmd.Flags().StringP("mirror", "m", "", "flip x, y or xy")
+	transformCmd.Flags().Float64SliceP("scale", "s", nil, "scale by s, or sx,sy")
+	transformCmd.Flags().Float64Slice("about", []float64{0, 0}, "centre x,y of scaling, mirroring and rotation")
+	transformCmd.Flags().IntSlice("array", nil, "repeat on a grid of columns,rows")
+	transformCmd.Flags().Float64Slice("spacing", nil, "grid spacing dx,dy for --array")
+	transformCmd.Flags().Bool("linearize", false, "break arcs into lines where the transform needs it")
+	transformCmd.Flags().Float64("tolerance", 0.01, "chord error when breaking arcs into lines")
+	transformCmd.MarkFlagRequired("file")
+}
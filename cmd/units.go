@@ -0,0 +1,52 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/post"
+	"github.com/spf13/cobra"
+)
+
+// unitsCmd represents the units command
+var unitsCmd = &cobra.Command{
+	Use:   "units",
+	Short: "convert a gcode file between inches and millimetres",
+	Long: `Rewrites a program into G20 inches or G21 millimetres. Coordinates, arc offsets, radii,
+peck depths and feed rates are scaled, rotary axes, spindle speeds, dwells and other unitless
+words are left alone.
+
+  cnctools units -i part.nc --to in > part-inch.nc`,
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetString("to")
+		var inches bool
+		switch to {
+		case "in", "inch", "inches":
+			inches = true
+		case "mm":
+		default:
+			log.Fatalf("unknown units %q, use in or mm", to)
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		blocks, err := gcode.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := post.Units(blocks, inches)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeBlocks(cmd, out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unitsCmd)
+	unitsCmd.Flags().StringP("file", "i", "", "gcode file, - for standard input")
+	unitsCmd.Flags().StringP("to", "u", "mm", "units to convert to, in or mm")
+	unitsCmd.MarkFlagRequired("file")
+}
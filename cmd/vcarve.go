@@ -0,0 +1,100 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/pocket"
+	"github.com/redt1de/cnctools/vcarve"
+	"github.com/spf13/cobra"
+)
+
+// vcarveCmd represents the vcarve command
+var vcarveCmd = &cobra.Command{
+	Use:   "vcarve",
+	Short: "generate V-bit carving gcode for closed contours",
+	Long: `Carves closed contours from a DXF file with a V-bit. The tool follows the middle of each
+shape and sinks until the cone touches both walls, so narrow strokes are shallow and wide ones
+deep. Contours nested inside another contour are islands. Zero Z on the stock top.
+
+With --max-depth the carve is capped and wide areas get a flat floor. Give --clear-tool to
+clear those floors with an end mill first, the program pauses for the tool change.
+
+  cnctools vcarve -i sign.dxf --angle 60 --max-depth 3 --clear-tool 3 --preview sign.svg`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		preview, _ := cmd.Flags().GetString("preview")
+		p := vcarve.DefaultParams()
+		p.Angle, _ = cmd.Flags().GetFloat64("angle")
+		p.ToolDiameter, _ = cmd.Flags().GetFloat64("tool")
+		p.MaxDepth, _ = cmd.Flags().GetFloat64("max-depth")
+		p.StepDown, _ = cmd.Flags().GetFloat64("step-down")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed-rate")
+		p.PlungeFeed, _ = cmd.Flags().GetFloat64("plunge-rate")
+		p.Spindle, _ = cmd.Flags().GetFloat64("spindle")
+		p.SafeZ, _ = cmd.Flags().GetFloat64("safe-height")
+		p.Resolution, _ = cmd.Flags().GetFloat64("resolution")
+		if clear, _ := cmd.Flags().GetFloat64("clear-tool"); clear > 0 {
+			c := pocket.DefaultParams()
+			c.ToolDiameter = clear
+			c.StepOver, _ = cmd.Flags().GetFloat64("clear-step-over")
+			c.StepDown, _ = cmd.Flags().GetFloat64("clear-step-down")
+			c.Feed, c.PlungeFeed, c.Spindle = p.Feed, p.PlungeFeed, p.Spindle
+			p.Clearing = &c
+		}
+
+		drawing, err := geom.ReadDXFFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		shapes := drawing.Shapes()
+		if preview != "" {
+			cuts, flat, err := vcarve.Carve(shapes, p)
+			if err != nil {
+				log.Fatal(err)
+			}
+			f, err := os.Create(preview)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			if err := vcarve.Preview(f, shapes, cuts, flat, p); err != nil {
+				log.Fatal(err)
+			}
+			deepest := 0.0
+			for _, c := range cuts {
+				deepest = max(deepest, c.MaxDepth())
+			}
+			fmt.Fprintf(os.Stderr, "%d cuts, deepest %.3fmm, %d flat areas, preview written to %s\n", len(cuts), deepest, len(flat), preview)
+		}
+		g, err := vcarve.Generate(shapes, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(cmd, string(g))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(vcarveCmd)
+	vcarveCmd.Flags().StringP("file", "i", "", "DXF file with the contours to carve")
+	vcarveCmd.Flags().Float64P("angle", "a", 90, "included angle of the V-bit in degrees")
+	vcarveCmd.Flags().Float64P("tool", "t", 6.35, "V-bit diameter")
+	vcarveCmd.Flags().Float64P("max-depth", "d", 0, "depth cap, 0 for no cap other than the tool diameter")
+	vcarveCmd.Flags().Float64P("step-down", "z", 0, "max depth per pass, 0 for a single pass")
+	vcarveCmd.Flags().Float64("clear-tool", 0, "end mill diameter to clear flat floors with, 0 to skip")
+	vcarveCmd.Flags().Float64("clear-step-over", 40, "clearing step over in percent of the end mill diameter")
+	vcarveCmd.Flags().Float64("clear-step-down", 1, "clearing max depth per pass")
+	vcarveCmd.Flags().Float64P("feed-rate", "f", 800, "feed rate")
+	vcarveCmd.Flags().Float64P("plunge-rate", "p", 200, "plunge feed rate")
+	vcarveCmd.Flags().Float64("spindle", 16000, "spindle speed")
+	vcarveCmd.Flags().Float64("safe-height", 5, "safe Z height")
+	vcarveCmd.Flags().Float64("resolution", 0, "distance field grid resolution, defaults to 1/50 of the cut radius")
+	vcarveCmd.Flags().String("preview", "", "write an SVG preview of the carve to this file")
+	vcarveCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,121 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redt1de/cnctools/grbl"
+	"github.com/redt1de/cnctools/zero"
+	"github.com/spf13/cobra"
+)
+
+// zeroCmd represents the zero command
+var zeroCmd = &cobra.Command{
+	Use:   "zero z|edge|corner|bore|boss",
+	Short: "set work zero by probing a surface, edge, corner or centre",
+	Long: `Probes the stock with G38.2 and writes the result to a work coordinate system with G10 L20.
+Jog the tool to the start first:
+  z       over the touch plate, sets Z to the top of the stock under it
+  edge    beside the stock below its top, probing along --axis, sets that axis
+  corner  over an XYZ corner plate sat on the --corner of the stock, closer than --clearance
+          less the plate --wall and tool radius to both faces, sets X, Y and Z
+  bore    inside the hole below its top, sets X and Y to the centre
+  boss    over the middle of the boss, --depth above where its sides are probed, sets X and Y
+          to the centre
+
+Without --port the routine is printed as a program, the zero is set where the probe stops.
+With --port it runs on the controller and the zero comes from the reported probe positions.
+The bore and boss centres need those, they only run with --port.
+
+  cnctools zero corner --corner back-left -t 3.175 --plate 12 --wall 6 > zero.nc
+  cnctools zero bore --wcs G55 -t 2 --travel 40 --port /dev/ttyUSB0`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		p := zero.DefaultParams()
+		p.Routine = strings.ToLower(args[0])
+		wcs, _ := cmd.Flags().GetString("wcs")
+		n := 0
+		if _, err := fmt.Sscanf(strings.ToUpper(wcs), "G5%d", &n); err != nil || n < 4 || n > 9 {
+			log.Fatalf("unknown coordinate system %q, use G54 to G59", wcs)
+		}
+		p.System = n - 3
+		axis, _ := cmd.Flags().GetString("axis")
+		if len(axis) != 1 {
+			log.Fatal("--axis is x or y")
+		}
+		p.Axis = strings.ToUpper(axis)[0]
+		p.Negative, _ = cmd.Flags().GetBool("negative")
+		p.Corner, _ = cmd.Flags().GetString("corner")
+		p.Tool, _ = cmd.Flags().GetFloat64("tool")
+		p.Plate, _ = cmd.Flags().GetFloat64("plate")
+		p.Wall, _ = cmd.Flags().GetFloat64("wall")
+		p.Size, _ = cmd.Flags().GetFloat64("size")
+		p.Travel, _ = cmd.Flags().GetFloat64("travel")
+		p.Feed, _ = cmd.Flags().GetFloat64("feed")
+		p.LatchFeed, _ = cmd.Flags().GetFloat64("latch")
+		p.PullOff, _ = cmd.Flags().GetFloat64("pull-off")
+		p.Clearance, _ = cmd.Flags().GetFloat64("clearance")
+		p.Depth, _ = cmd.Flags().GetFloat64("depth")
+		if err := p.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		port, _ := cmd.Flags().GetString("port")
+		if port == "" {
+			g, err := zero.Program(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+			write(cmd, string(g))
+			return
+		}
+		// probing holds the answer back
+		grbl.Timeout = 2 * time.Minute
+		baud, _ := cmd.Flags().GetInt("baud")
+		conn, err := grbl.Dial(port, baud)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Echo = os.Stderr
+		res, err := zero.Run(conn, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, a := range []byte("XYZ") {
+			if v, ok := res.Zero[a]; ok {
+				fmt.Printf("%s %c0 at machine %c%.3f\n", strings.ToUpper(wcs), a, a, v)
+			}
+		}
+		if res.Diameter > 0 {
+			fmt.Printf("diameter %.3f\n", res.Diameter)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(zeroCmd)
+	d := zero.DefaultParams()
+	zeroCmd.Flags().String("wcs", "G54", "work coordinate system to set, G54 to G59")
+	zeroCmd.Flags().String("axis", "x", "axis an edge is probed along, x or y")
+	zeroCmd.Flags().Bool("negative", false, "probe the edge towards -axis")
+	zeroCmd.Flags().String("corner", d.Corner, "stock corner, front-left, front-right, back-left or back-right")
+	zeroCmd.Flags().Float64P("tool", "t", d.Tool, "tool or probe tip diameter")
+	zeroCmd.Flags().Float64("plate", d.Plate, "touch plate thickness")
+	zeroCmd.Flags().Float64("wall", d.Wall, "plate wall between the probed face and the stock, 0 to touch the stock")
+	zeroCmd.Flags().Float64("size", d.Size, "rough boss diameter")
+	zeroCmd.Flags().Float64("travel", d.Travel, "furthest each probe move goes")
+	zeroCmd.Flags().Float64P("feed", "f", d.Feed, "first probing feed rate")
+	zeroCmd.Flags().Float64("latch", d.LatchFeed, "slow second probing feed rate")
+	zeroCmd.Flags().Float64("pull-off", d.PullOff, "back off between the two touches")
+	zeroCmd.Flags().Float64("clearance", d.Clearance, "how far past a face the tool goes down")
+	zeroCmd.Flags().Float64P("depth", "d", d.Depth, "how far the tool goes down to probe a side")
+	zeroCmd.Flags().StringP("port", "P", "", "controller serial device or host:port to run the routine on")
+	zeroCmd.Flags().Int("baud", 115200, "serial baud rate")
+}
@@ -0,0 +1,151 @@
+package dialect
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/redt1de/cnctools/gcode"
+)
+
+// peckLift is how far G73 backs off between pecks, and how far above the last peck G83 comes
+// back down to, in mm
+const peckLift = 0.5
+
+// Expand replaces G73 and G81 to G83 drilling cycles with plain moves, for controllers without
+// canned cycles. G80, G98 and G99 go with them. Other cycles, cycles in relative mode or
+// outside the XY plane and repeats with L are refused.
+func Expand(blocks []gcode.Block) ([]gcode.Block, error) {
+	s := gcode.NewState()
+	out := []gcode.Block{}
+	var depth, retract, peck, dwell float64 // modal cycle words in mm and seconds
+	initial := 0.0                          // Z the cycle started from, G98 goes back to it
+	for n, b := range blocks {
+		before := *s
+		if _, _, err := s.Apply(b); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if b.Raw != "" {
+			out = append(out, b)
+			continue
+		}
+		had := len(b.Words) > 0
+		b.Words = append([]gcode.Word{}, b.Words...)
+		b.RemoveCode('G', 80)
+		b.RemoveCode('G', 98)
+		b.RemoveCode('G', 99)
+		if !s.Canned() || !hasAxis(b) {
+			// a line that only set cycle modes goes, with its comment
+			if !had || len(b.Words) > 0 {
+				out = append(out, b)
+			}
+			continue
+		}
+
+		switch {
+		case s.Motion != 73 && s.Motion > 83:
+			return nil, fmt.Errorf("line %d: G%d can not be expanded", n+1, s.Motion)
+		case !s.Absolute:
+			return nil, fmt.Errorf("line %d: canned cycles in G91 can not be expanded", n+1)
+		case s.Plane != 17:
+			return nil, fmt.Errorf("line %d: canned cycles outside G17 can not be expanded", n+1)
+		case b.Has('L'):
+			return nil, fmt.Errorf("line %d: canned cycle repeats can not be expanded", n+1)
+		case !before.Known[gcode.Z]:
+			return nil, fmt.Errorf("line %d: Z is unknown at the start of the canned cycle", n+1)
+		}
+		scale := s.Scale()
+		if !before.Canned() || before.Motion != s.Motion {
+			initial = before.Pos[gcode.Z]
+		}
+		if v, ok := b.Get('Z'); ok {
+			depth = v * scale
+		}
+		if v, ok := b.Get('R'); ok {
+			retract = v * scale
+		}
+		if v, ok := b.Get('Q'); ok {
+			peck = v * scale
+		}
+		if v, ok := b.Get('P'); ok {
+			dwell = v
+		}
+		if (s.Motion == 73 || s.Motion == 83) && peck <= 0 {
+			return nil, fmt.Errorf("line %d: pecking cycle without a Q", n+1)
+		}
+
+		// what else the block sets, like the feed, goes first
+		rest := gcode.Block{Comment: b.Comment}
+		for _, w := range b.Words {
+			if w.Letter == 'G' && w.Value == float64(s.Motion) || stripped(w.Letter) {
+				continue
+			}
+			rest.Words = append(rest.Words, w)
+		}
+		if len(rest.Words) > 0 || rest.Comment != "" {
+			out = append(out, rest)
+		}
+
+		move := func(motion int, axes ...float64) {
+			blk := gcode.Block{Words: []gcode.Word{{Letter: 'G', Value: float64(motion)}}}
+			for i := 0; i < len(axes); i += 2 {
+				blk.Words = append(blk.Words, gcode.Word{Letter: gcode.AxisLetters[int(axes[i])], Value: axes[i+1] / scale})
+			}
+			out = append(out, blk)
+		}
+		z := before.Pos[gcode.Z]
+		if z < retract {
+			move(0, gcode.Z, retract)
+		}
+		move(0, gcode.X, s.Pos[gcode.X], gcode.Y, s.Pos[gcode.Y])
+		move(0, gcode.Z, retract)
+		switch s.Motion {
+		case 81, 82:
+			move(1, gcode.Z, depth)
+			if s.Motion == 82 && dwell > 0 {
+				out = append(out, gcode.Block{Words: []gcode.Word{{Letter: 'G', Value: 4}, {Letter: 'P', Value: dwell}}})
+			}
+		case 73, 83:
+			at := retract
+			for at > depth+1e-9 {
+				next := math.Max(depth, at-peck)
+				if at < retract && s.Motion == 83 {
+					move(0, gcode.Z, at+peckLift)
+				}
+				move(1, gcode.Z, next)
+				at = next
+				if at > depth+1e-9 {
+					if s.Motion == 83 {
+						move(0, gcode.Z, retract)
+					} else {
+						move(0, gcode.Z, at+peckLift)
+					}
+				}
+			}
+		}
+		clear := retract
+		if !s.RetractR {
+			clear = math.Max(initial, retract)
+		}
+		move(0, gcode.Z, clear)
+	}
+	return out, nil
+}
+
+// stripped reports whether a letter belongs to the cycle and goes with it
+func stripped(letter byte) bool {
+	switch letter {
+	case 'X', 'Y', 'Z', 'R', 'Q', 'P', 'L':
+		return true
+	}
+	return false
+}
+
+// hasAxis reports whether a block has an axis word
+func hasAxis(b gcode.Block) bool {
+	for i := 0; i < len(gcode.AxisLetters); i++ {
+		if b.Has(gcode.AxisLetters[i]) {
+			return true
+		}
+	}
+	return false
+}
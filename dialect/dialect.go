@@ -0,0 +1,229 @@
+package dialect
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/redt1de/cnctools/gcode"
+)
+
+// Dialect is the gcode flavour of a controller. The generators write GRBL flavoured programs
+// and a dialect rewrites them on the way out.
+type Dialect interface {
+	Name() string
+	// Post rewrites the codes the controller does not have into ones it does
+	Post(blocks []gcode.Block) ([]gcode.Block, error)
+	// Format writes the program with the comments, numbers and line numbers of the controller
+	Format(blocks []gcode.Block) string
+}
+
+// probing codes
+const (
+	G38 = "G38.2" // straight probe towards a target on any axis
+	G31 = "G31"   // the same move under its Mach3 name
+	G30 = "G30"   // Z only probe of Marlin, down to the bed at its own feed
+)
+
+// Controller is a dialect described by what the controller supports
+type Controller struct {
+	ID           string
+	DynamicLaser bool   // M4 laser power that follows the speed, otherwise laser programs get M3
+	Probe        string // G38, G31 or G30
+	Parens       bool   // comments in brackets rather than after a ;
+	LineNumbers  bool   // N10, N20... on every line with words
+	Cycles       bool   // canned drilling cycles, otherwise G73 and G81 to G83 are expanded
+	Rotation     bool   // G68 coordinate rotation
+	Digits       int    // decimal places of numbers in mm, one more is written in inches
+	Laser        bool   // the program runs a laser, so M4 is dynamic power rather than a reversed spindle
+}
+
+// Controllers are the known dialects
+var Controllers = []Controller{
+	{ID: "grbl", DynamicLaser: true, Probe: G38, Digits: 3},
+	{ID: "grblhal", DynamicLaser: true, Probe: G38, Cycles: true, Digits: 4},
+	{ID: "fluidnc", DynamicLaser: true, Probe: G38, Digits: 3},
+	{ID: "marlin", Probe: G30, Digits: 3},
+	{ID: "smoothieware", Probe: G38, Digits: 4},
+	{ID: "linuxcnc", Probe: G38, Parens: true, Cycles: true, Digits: 4},
+	{ID: "mach3", Probe: G31, Parens: true, LineNumbers: true, Cycles: true, Rotation: true, Digits: 4},
+}
+
+// Default is the dialect the generators write
+const Default = "grbl"
+
+// Get returns the dialect of a controller by name
+func Get(name string) (Controller, error) {
+	for _, c := range Controllers {
+		if strings.EqualFold(c.ID, name) {
+			return c, nil
+		}
+	}
+	return Controller{}, fmt.Errorf("unknown controller %q, use one of %s", name, strings.Join(Names(), ", "))
+}
+
+// Names returns the names of the known dialects
+func Names() []string {
+	names := []string{}
+	for _, c := range Controllers {
+		names = append(names, c.ID)
+	}
+	return names
+}
+
+// Name returns the controller name
+func (c Controller) Name() string {
+	return c.ID
+}
+
+// Post rewrites a GRBL flavoured program for the controller. In laser programs M4 dynamic
+// power becomes M3 on controllers without it, a spindle M4 is left alone.
+func (c Controller) Post(blocks []gcode.Block) ([]gcode.Block, error) {
+	if !c.Cycles {
+		var err error
+		if blocks, err = Expand(blocks); err != nil {
+			return nil, fmt.Errorf("%s: %v", c.ID, err)
+		}
+	}
+	out := make([]gcode.Block, 0, len(blocks))
+	for n, b := range blocks {
+		if b.Raw != "" {
+			out = append(out, b)
+			continue
+		}
+		b.Words = append([]gcode.Word{}, b.Words...)
+		for i, w := range b.Words {
+			if c.Laser && !c.DynamicLaser && w.Letter == 'M' && w.Value == 4 {
+				b.Words[i].Value = 3
+			}
+		}
+		if err := c.probe(&b); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %v", c.ID, n+1, err)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// probe rewrites G38 probing moves for controllers that call them something else. G30 takes
+// no travel or feed, the Z and F words go.
+func (c Controller) probe(b *gcode.Block) error {
+	g30 := false
+	for i, w := range b.Words {
+		if w.Letter != 'G' || math.Round(w.Value) != 38 || c.Probe == G38 {
+			continue
+		}
+		code := math.Round(w.Value * 10)
+		if code != 382 && code != 383 {
+			return fmt.Errorf("G%s has no equivalent", gcode.FormatNumber(w.Value))
+		}
+		if c.Probe == G30 {
+			for _, l := range "XYABC" {
+				if b.Has(byte(l)) {
+					return fmt.Errorf("only Z can be probed")
+				}
+			}
+			if z, ok := b.Get('Z'); !ok || z >= 0 {
+				return fmt.Errorf("only downward Z probes can be done")
+			}
+			b.Words[i].Value = 30
+			g30 = true
+		} else {
+			b.Words[i].Value = 31
+		}
+	}
+	if g30 {
+		b.Remove('Z')
+		b.Remove('F')
+	}
+	return nil
+}
+
+// Format writes the program in the style of the controller
+func (c Controller) Format(blocks []gcode.Block) string {
+	var sb strings.Builder
+	n := 0
+	digits := c.Digits
+	for _, b := range blocks {
+		if b.Raw != "" {
+			sb.WriteString(b.Raw + "\n")
+			continue
+		}
+		if b.HasCode('G', 20) {
+			digits = c.Digits + 1
+		} else if b.HasCode('G', 21) {
+			digits = c.Digits
+		}
+		parts := []string{}
+		if c.LineNumbers && len(b.Words) > 0 {
+			n += 10
+			parts = append(parts, fmt.Sprintf("N%d", n))
+		}
+		for _, w := range b.Words {
+			if w.Letter == 'N' && c.LineNumbers {
+				continue
+			}
+			parts = append(parts, string(w.Letter)+number(w.Value, digits))
+		}
+		for _, text := range comments(b.Comment) {
+			if c.Parens {
+				text = "(" + strings.NewReplacer("(", "[", ")", "]").Replace(text) + ")"
+			} else {
+				text = "; " + text
+			}
+			parts = append(parts, text)
+		}
+		sb.WriteString(strings.Join(parts, " ") + "\n")
+	}
+	return sb.String()
+}
+
+// number formats a value to a number of decimal places without trailing zeros
+func number(v float64, digits int) string {
+	s := strconv.FormatFloat(v, 'f', digits, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+// comments splits a block comment into the text of each ; or bracketed comment
+func comments(c string) []string {
+	texts := []string{}
+	for c = strings.TrimSpace(c); c != ""; c = strings.TrimSpace(c) {
+		if c[0] == ';' {
+			texts = append(texts, strings.TrimSpace(c[1:]))
+			break
+		}
+		end := strings.IndexByte(c, ')')
+		if c[0] != '(' || end < 0 {
+			texts = append(texts, c)
+			break
+		}
+		texts = append(texts, strings.TrimSpace(c[1:end]))
+		c = c[end+1:]
+	}
+	return texts
+}
+
+// Write rewrites a GRBL flavoured program for a dialect and formats it
+func Write(d Dialect, program string) (string, error) {
+	blocks, err := gcode.ParseString(program)
+	if err != nil {
+		return "", err
+	}
+	return WriteBlocks(d, blocks)
+}
+
+// WriteBlocks is Write for a parsed program
+func WriteBlocks(d Dialect, blocks []gcode.Block) (string, error) {
+	blocks, err := d.Post(blocks)
+	if err != nil {
+		return "", err
+	}
+	return d.Format(blocks), nil
+}
@@ -0,0 +1,44 @@
+package dialect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		controller string
+		in         string
+		want       string // first probing line, empty when the program is refused
+	}{
+		{"grbl", "G38.2 Z-10 F50", "G38.2 Z-10 F50"},
+		{"smoothieware", "G38.2 Z-10 F50", "G38.2 Z-10 F50"},
+		{"smoothieware", "G38.2 X5 F50", "G38.2 X5 F50"},
+		{"mach3", "G38.2 Z-10 F50", "N10 G31 Z-10 F50"},
+		{"marlin", "G38.2 Z-10 F50", "G30"},
+		{"marlin", "G38.3 Z-10 F50 ; Touch off", "G30 ; Touch off"},
+		{"marlin", "G38.2 X5 F50", ""},
+		{"marlin", "G38.2 Z10 F50", ""},
+		{"marlin", "G38.4 Z-10 F50", ""},
+	}
+	for _, tt := range tests {
+		c, err := Get(tt.controller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Write(c, tt.in+"\n")
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: %q was accepted as %q", tt.controller, tt.in, out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %q: %v", tt.controller, tt.in, err)
+			continue
+		}
+		if got := strings.TrimSpace(out); got != tt.want {
+			t.Errorf("%s: %q written as %q, want %q", tt.controller, tt.in, got, tt.want)
+		}
+	}
+}
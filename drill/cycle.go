@@ -0,0 +1,103 @@
+package drill
+
+import (
+	"fmt"
+
+	"github.com/redt1de/cnctools/util"
+)
+
+// canned cycle names
+const (
+	Simple    = "drill"     // G81
+	Dwell     = "dwell"     // G82
+	Peck      = "peck"      // G83, full retract between pecks
+	ChipBreak = "chipbreak" // G73, short retract between pecks
+)
+
+var cycleCodes = map[string]string{Simple: "G81", Dwell: "G82", Peck: "G83", ChipBreak: "G73"}
+
+// Params configures the drilling cycle, the stock top is Z0
+type Params struct {
+	Cycle   string
+	Depth   float64 // positive depth below Z0
+	Retract float64 // R plane
+	SafeZ   float64 // initial level, travels between holes happen here
+	Peck    float64 // Q, depth per peck for Peck and ChipBreak
+	Dwell   float64 // seconds at the bottom for Dwell
+	Feed    float64
+	Spindle float64
+}
+
+// Validate checks the parameters
+func (p Params) Validate() error {
+	if _, ok := cycleCodes[p.Cycle]; !ok {
+		return fmt.Errorf("unknown cycle %q", p.Cycle)
+	}
+	switch {
+	case p.Depth <= 0:
+		return fmt.Errorf("depth must be positive")
+	case p.Retract < 0 || p.Retract > p.SafeZ:
+		return fmt.Errorf("retract plane must be between Z0 and the safe height")
+	case (p.Cycle == Peck || p.Cycle == ChipBreak) && p.Peck <= 0:
+		return fmt.Errorf("peck depth must be positive")
+	case p.Feed <= 0:
+		return fmt.Errorf("feed rate must be positive")
+	}
+	return nil
+}
+
+// Generate drills each group of holes, pausing for a manual tool change between groups.
+// Holes in a group are visited in the given order, see Optimize.
+func Generate(groups [][]Hole, p Params) (util.Gcode, error) {
+	g := util.Gcode("")
+	g.G90Preamble()
+	g.Add("G0 Z%.3f ; Safe height", p.SafeZ)
+	if err := Cut(&g, groups, p); err != nil {
+		return "", err
+	}
+	g.Add("M30 ; End program")
+	return g, nil
+}
+
+// Cut appends the drilling moves for the groups of holes, from spindle start to stop, so holes
+// can be part of a larger program. The tool must start at SafeZ.
+func Cut(g *util.Gcode, groups [][]Hole, p Params) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	for i, holes := range groups {
+		if len(holes) == 0 {
+			continue
+		}
+		if i > 0 {
+			g.Add("M5 ; Stop spindle")
+			g.Add("M0 ; Change tool to %.3fmm and resume", holes[0].Diameter)
+		} else if holes[0].Diameter > 0 {
+			g.Add("; Tool %.3fmm", holes[0].Diameter)
+		}
+		g.Add("M3 S%.0f ; Start spindle", p.Spindle)
+		p.canned(g, holes)
+	}
+	g.Add("G0 Z%.3f ; Retract", p.SafeZ)
+	g.Add("M5 ; Stop spindle")
+	return nil
+}
+
+// canned writes the holes as one modal canned cycle
+func (p Params) canned(g *util.Gcode, holes []Hole) {
+	z := -p.Depth
+	g.Add("G0 X%.3f Y%.3f", holes[0].X, holes[0].Y)
+	g.Add("G98 ; Return to the initial level between holes")
+	switch p.Cycle {
+	case Simple:
+		g.Add("G81 X%.3f Y%.3f Z%.3f R%.3f F%.0f", holes[0].X, holes[0].Y, z, p.Retract, p.Feed)
+	case Dwell:
+		g.Add("G82 X%.3f Y%.3f Z%.3f R%.3f P%.2f F%.0f", holes[0].X, holes[0].Y, z, p.Retract, p.Dwell, p.Feed)
+	default:
+		g.Add("%s X%.3f Y%.3f Z%.3f R%.3f Q%.3f F%.0f", cycleCodes[p.Cycle], holes[0].X, holes[0].Y, z, p.Retract, p.Peck, p.Feed)
+	}
+	for _, h := range holes[1:] {
+		g.Add("X%.3f Y%.3f", h.X, h.Y)
+	}
+	g.Add("G80 ; Cancel cycle")
+}
@@ -0,0 +1,152 @@
+package drill
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	reExcTool   = regexp.MustCompile(`^T(\d+)(?:F[\d.]+|S[\d.]+|B[\d.]+|H[\d.]+|Z[-\d.]+)*C([\d.]+)`)
+	reExcSelect = regexp.MustCompile(`^T(\d+)$`)
+	reExcCoord  = regexp.MustCompile(`([XY])([+-]?[\d.]+)`)
+	reExcFormat = regexp.MustCompile(`FILE_FORMAT=(\d+):(\d+)`)
+)
+
+// excellonFormat describes how to read coordinates that have no decimal point
+type excellonFormat struct {
+	inch          bool
+	integer, frac int
+	trailingZeros bool // TZ, leading zeros are suppressed
+}
+
+func (f excellonFormat) parse(s string) float64 {
+	if strings.Contains(s, ".") {
+		v, _ := strconv.ParseFloat(s, 64)
+		return f.mm(v)
+	}
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	if f.trailingZeros {
+		// leading zeros missing, the last frac digits are the fraction
+		for len(s) < f.frac {
+			s = "0" + s
+		}
+	} else {
+		// trailing zeros missing, pad on the right to the full width
+		for len(s) < f.integer+f.frac {
+			s += "0"
+		}
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	v /= math.Pow(10, float64(f.frac))
+	if neg {
+		v = -v
+	}
+	return f.mm(v)
+}
+
+func (f excellonFormat) mm(v float64) float64 {
+	if f.inch {
+		return v * 25.4
+	}
+	return v
+}
+
+// ReadExcellon reads an Excellon drill file, returning holes in mm with the tool diameter of each hole
+func ReadExcellon(r io.Reader) ([]Hole, error) {
+	format := excellonFormat{integer: 3, frac: 3}
+	tools := map[int]float64{}
+	holes := []Hole{}
+	tool := 0
+	x, y := 0.0, 0.0
+	header := false
+	inchTools := false
+	fixed := false // digit counts came from a FILE_FORMAT comment
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ";") {
+			if m := reExcFormat.FindStringSubmatch(line); m != nil {
+				format.integer, _ = strconv.Atoi(m[1])
+				format.frac, _ = strconv.Atoi(m[2])
+				fixed = true
+			}
+			continue
+		}
+		switch {
+		case line == "M48":
+			header = true
+			continue
+		case line == "%" || line == "M95":
+			header = false
+			continue
+		case strings.HasPrefix(line, "METRIC") || line == "M71":
+			format.inch, inchTools = false, false
+			if !fixed {
+				format.integer, format.frac = 3, 3
+			}
+		case strings.HasPrefix(line, "INCH") || line == "M72":
+			format.inch, inchTools = true, true
+			if !fixed {
+				format.integer, format.frac = 2, 4
+			}
+		case line == "M30" || line == "M00":
+			return holes, nil
+		}
+		if strings.Contains(line, ",TZ") {
+			format.trailingZeros = true
+		}
+		if strings.Contains(line, ",LZ") {
+			format.trailingZeros = false
+		}
+		// explicit width in the unit line, e.g. METRIC,LZ,000.000
+		if i := strings.LastIndex(line, ","); i >= 0 && strings.Contains(line[i:], ".") {
+			parts := strings.SplitN(line[i+1:], ".", 2)
+			format.integer, format.frac = len(parts[0]), len(parts[1])
+		}
+
+		if m := reExcTool.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			d, _ := strconv.ParseFloat(m[2], 64)
+			if inchTools {
+				d *= 25.4
+			}
+			tools[n] = d
+			if !header {
+				tool = n
+			}
+			continue
+		}
+		if m := reExcSelect.FindStringSubmatch(line); m != nil {
+			tool, _ = strconv.Atoi(m[1])
+			continue
+		}
+		if header || !(strings.HasPrefix(line, "X") || strings.HasPrefix(line, "Y")) {
+			continue
+		}
+		for _, m := range reExcCoord.FindAllStringSubmatch(line, -1) {
+			if m[1] == "X" {
+				x = format.parse(m[2])
+			} else {
+				y = format.parse(m[2])
+			}
+		}
+		if strings.Contains(line, "G85") {
+			return nil, fmt.Errorf("routed slots (G85) are not supported: %s", line)
+		}
+		holes = append(holes, Hole{X: x, Y: y, Diameter: tools[tool]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return holes, nil
+}
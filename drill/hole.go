@@ -0,0 +1,202 @@
+package drill
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// Hole is a single hole position with its finished diameter, 0 when unknown
+type Hole struct {
+	X, Y     float64
+	Diameter float64
+}
+
+func (h Hole) point() geom.Point { return geom.Point{X: h.X, Y: h.Y} }
+
+// ReadFile loads holes from an Excellon drill file, a CSV file or the circles of a DXF file,
+// picked by the file extension
+func ReadFile(filePath string) ([]Hole, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".dxf":
+		d, err := geom.ReadDXFFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		holes := []Hole{}
+		for _, c := range d.Circles {
+			holes = append(holes, Hole{X: c.Center.X, Y: c.Center.Y, Diameter: c.Radius * 2})
+		}
+		return holes, nil
+	case ".csv":
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %v", err)
+		}
+		defer file.Close()
+		return ReadCSV(file)
+	default:
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %v", err)
+		}
+		defer file.Close()
+		return ReadExcellon(file)
+	}
+}
+
+// ReadCSV reads x,y[,diameter] rows, a header row or rows that do not start with a number are skipped
+func ReadCSV(r io.Reader) ([]Hole, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	holes := []Hole{}
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading csv: %v", err)
+		}
+		if len(rec) < 2 {
+			continue
+		}
+		x, errX := strconv.ParseFloat(strings.TrimSpace(rec[0]), 64)
+		y, errY := strconv.ParseFloat(strings.TrimSpace(rec[1]), 64)
+		if errX != nil || errY != nil {
+			continue
+		}
+		h := Hole{X: x, Y: y}
+		if len(rec) > 2 {
+			h.Diameter, _ = strconv.ParseFloat(strings.TrimSpace(rec[2]), 64)
+		}
+		holes = append(holes, h)
+	}
+	return holes, nil
+}
+
+// Grid returns nx by ny holes starting at origin with dx,dy spacing
+func Grid(origin geom.Point, nx, ny int, dx, dy, dia float64) []Hole {
+	holes := []Hole{}
+	for j := 0; j < ny; j++ {
+		for i := 0; i < nx; i++ {
+			holes = append(holes, Hole{X: origin.X + float64(i)*dx, Y: origin.Y + float64(j)*dy, Diameter: dia})
+		}
+	}
+	return holes
+}
+
+// BoltCircle returns count holes evenly spaced on a circle, the first at startAngle degrees
+func BoltCircle(center geom.Point, radius float64, count int, startAngle, dia float64) []Hole {
+	holes := []Hole{}
+	for i := 0; i < count; i++ {
+		a := (startAngle + 360*float64(i)/float64(count)) * math.Pi / 180
+		holes = append(holes, Hole{X: center.X + radius*math.Cos(a), Y: center.Y + radius*math.Sin(a), Diameter: dia})
+	}
+	return holes
+}
+
+// Line returns count holes spaced apart along a line at angle degrees from start
+func Line(start geom.Point, count int, spacing, angle, dia float64) []Hole {
+	a := angle * math.Pi / 180
+	holes := []Hole{}
+	for i := 0; i < count; i++ {
+		d := spacing * float64(i)
+		holes = append(holes, Hole{X: start.X + d*math.Cos(a), Y: start.Y + d*math.Sin(a), Diameter: dia})
+	}
+	return holes
+}
+
+// GroupByDiameter splits holes into tool groups, smallest diameter first
+func GroupByDiameter(holes []Hole) [][]Hole {
+	groups := map[float64][]Hole{}
+	keys := []float64{}
+	for _, h := range holes {
+		k := math.Round(h.Diameter*1000) / 1000
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], h)
+	}
+	sort.Float64s(keys)
+	out := [][]Hole{}
+	for _, k := range keys {
+		out = append(out, groups[k])
+	}
+	return out
+}
+
+// Optimize orders holes to shorten travel, starting from the hole nearest to start. It builds a
+// nearest neighbour tour and improves it with 2-opt.
+func Optimize(holes []Hole, start geom.Point) []Hole {
+	if len(holes) < 3 {
+		return append([]Hole{}, holes...)
+	}
+	left := append([]Hole{}, holes...)
+	tour := make([]Hole, 0, len(holes))
+	cur := start
+	for len(left) > 0 {
+		bi, bd := 0, math.Inf(1)
+		for i, h := range left {
+			if d := cur.Dist(h.point()); d < bd {
+				bi, bd = i, d
+			}
+		}
+		tour = append(tour, left[bi])
+		cur = left[bi].point()
+		left = append(left[:bi], left[bi+1:]...)
+	}
+
+	// 2-opt on the open path from start, reversing tour[i..j] when it shortens the route
+	dist := func(a, b geom.Point) float64 { return a.Dist(b) }
+	at := func(i int) geom.Point {
+		if i < 0 {
+			return start
+		}
+		return tour[i].point()
+	}
+	for pass := 0; pass < 50; pass++ {
+		improved := false
+		for i := 0; i < len(tour)-1; i++ {
+			for j := i + 1; j < len(tour); j++ {
+				before := dist(at(i-1), at(i))
+				after := dist(at(i-1), at(j))
+				if j+1 < len(tour) {
+					before += dist(at(j), at(j+1))
+					after += dist(at(i), at(j+1))
+				}
+				if after < before-1e-9 {
+					for a, b := i, j; a < b; a, b = a+1, b-1 {
+						tour[a], tour[b] = tour[b], tour[a]
+					}
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return tour
+}
+
+// TravelLength returns the rapid distance to visit the holes in order from start
+func TravelLength(holes []Hole, start geom.Point) float64 {
+	l := 0.0
+	cur := start
+	for _, h := range holes {
+		l += cur.Dist(h.point())
+		cur = h.point()
+	}
+	return l
+}
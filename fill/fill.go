@@ -0,0 +1,312 @@
+package fill
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// fill patterns
+const (
+	Scanline   = "scanline"   // parallel lines at an angle
+	Crosshatch = "crosshatch" // scanlines at the angle and at right angles to it
+	Serpentine = "serpentine" // zig-zag scanlines linked into continuous strokes where they can be
+	Concentric = "concentric" // loops offset inwards from the outline
+	Spiral     = "spiral"     // concentric loops linked into continuous strokes
+	Hilbert    = "hilbert"    // Hilbert curve, spreads the heat over the area
+)
+
+// Patterns lists the fill patterns
+var Patterns = []string{Scanline, Crosshatch, Serpentine, Concentric, Spiral, Hilbert}
+
+// maxHilbertCells caps the number of cells a Hilbert fill may visit
+const maxHilbertCells = 1 << 22
+
+// Params configures a fill
+type Params struct {
+	Pattern       string
+	Interval      float64 // distance between neighbouring lines, usually the beam diameter
+	Angle         float64 // degrees counter clockwise from X for the line patterns
+	Overscan      float64 // distance open strokes are run up to and past with the laser off
+	Bidirectional bool    // line patterns alternate direction, loops alternate winding
+	Resolution    float64 // grid spacing used for offsetting, 0 uses half the interval
+}
+
+// DefaultParams returns a bidirectional horizontal scanline fill at 0.1mm
+func DefaultParams() Params {
+	return Params{
+		Pattern:       Scanline,
+		Interval:      0.1,
+		Overscan:      2,
+		Bidirectional: true,
+	}
+}
+
+// Validate checks the parameters
+func (p Params) Validate() error {
+	switch {
+	case p.Interval <= 0:
+		return fmt.Errorf("line interval must be positive")
+	case p.Overscan < 0:
+		return fmt.Errorf("overscan can not be negative")
+	case p.Resolution < 0:
+		return fmt.Errorf("resolution can not be negative")
+	}
+	for _, n := range Patterns {
+		if n == p.Pattern {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown fill pattern %q", p.Pattern)
+}
+
+func (p Params) res() float64 {
+	if p.Resolution > 0 {
+		return p.Resolution
+	}
+	return p.Interval / 2
+}
+
+// Fill returns the strokes that cover shapes with the pattern, in burning order. Closed loops
+// repeat their first point at the end, every other stroke is open and may be overscanned.
+func Fill(shapes []geom.Shape, p Params) ([]geom.Path, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if len(shapes) == 0 {
+		return nil, fmt.Errorf("no closed shapes to fill")
+	}
+	var strokes []geom.Path
+	switch p.Pattern {
+	case Scanline:
+		strokes = lines(shapes, p.Interval, p.Angle, p.Bidirectional, false)
+	case Crosshatch:
+		strokes = append(lines(shapes, p.Interval, p.Angle, p.Bidirectional, false),
+			lines(shapes, p.Interval, p.Angle+90, p.Bidirectional, false)...)
+	case Serpentine:
+		strokes = lines(shapes, p.Interval, p.Angle, true, true)
+	case Concentric:
+		strokes = concentric(shapes, p)
+	case Spiral:
+		strokes = spiral(shapes, p)
+	case Hilbert:
+		var err error
+		if strokes, err = hilbert(shapes, p.Interval); err != nil {
+			return nil, err
+		}
+	}
+	if len(strokes) == 0 {
+		return nil, fmt.Errorf("the shapes are too small for a %.3fmm interval", p.Interval)
+	}
+	return strokes, nil
+}
+
+// lines fills shapes with rows at angle degrees. The shapes are turned so the rows run along X,
+// cut with scanlines and turned back. When link is set each row is joined to an overlapping
+// row segment above it wherever the step between them stays inside the shapes.
+func lines(shapes []geom.Shape, interval, angle float64, bidir, link bool) []geom.Path {
+	a := angle * math.Pi / 180
+	rings := []geom.Path{}
+	b := geom.EmptyRect()
+	for _, s := range shapes {
+		for _, r := range s.Rings() {
+			r = r.Transform(-a, geom.Point{})
+			rings = append(rings, r)
+			b = b.Union(r.Bounds())
+		}
+	}
+
+	type seg struct {
+		x0, x1 float64
+		used   bool
+	}
+	rows := [][]seg{}
+	ys := []float64{}
+	for y := b.Min.Y + interval/2; y < b.Max.Y; y += interval {
+		xs := geom.ScanLine(rings, y)
+		row := []seg{}
+		for i := 0; i+1 < len(xs); i += 2 {
+			if xs[i+1]-xs[i] > 1e-6 {
+				row = append(row, seg{x0: xs[i], x1: xs[i+1]})
+			}
+		}
+		rows = append(rows, row)
+		ys = append(ys, y)
+	}
+
+	out := []geom.Path{}
+	if !link {
+		for i, row := range rows {
+			back := bidir && i%2 == 1
+			for k := range row {
+				s := row[k]
+				if back {
+					s = row[len(row)-1-k]
+					out = append(out, geom.Path{{X: s.x1, Y: ys[i]}, {X: s.x0, Y: ys[i]}})
+					continue
+				}
+				out = append(out, geom.Path{{X: s.x0, Y: ys[i]}, {X: s.x1, Y: ys[i]}})
+			}
+		}
+	} else {
+		for i := range rows {
+			for k := range rows[i] {
+				if rows[i][k].used {
+					continue
+				}
+				// walk up the rows from this segment, zig-zagging while the steps stay inside
+				stroke := geom.Path{}
+				ri, si, fwd := i, k, true
+				for {
+					s := &rows[ri][si]
+					s.used = true
+					if fwd {
+						stroke = append(stroke, geom.Point{X: s.x0, Y: ys[ri]}, geom.Point{X: s.x1, Y: ys[ri]})
+					} else {
+						stroke = append(stroke, geom.Point{X: s.x1, Y: ys[ri]}, geom.Point{X: s.x0, Y: ys[ri]})
+					}
+					if ri+1 >= len(rows) {
+						break
+					}
+					next := -1
+					for n, o := range rows[ri+1] {
+						if !o.used && o.x0 < s.x1 && o.x1 > s.x0 {
+							next = n
+							break
+						}
+					}
+					if next < 0 {
+						break
+					}
+					o := rows[ri+1][next]
+					end := stroke[len(stroke)-1]
+					start := geom.Point{X: o.x1, Y: ys[ri+1]}
+					if !fwd {
+						start.X = o.x0
+					}
+					// both ends sit on the outline, test just inside the rows
+					mid := end.Lerp(start, 0.5)
+					if fwd {
+						mid.X -= interval * 1e-3
+					} else {
+						mid.X += interval * 1e-3
+					}
+					if !insideRings(rings, mid) {
+						break
+					}
+					ri, si, fwd = ri+1, next, !fwd
+				}
+				out = append(out, stroke)
+			}
+		}
+	}
+	for i := range out {
+		out[i] = out[i].Transform(a, geom.Point{})
+	}
+	return out
+}
+
+// insideRings reports whether pt is inside an odd number of rings
+func insideRings(rings []geom.Path, pt geom.Point) bool {
+	in := false
+	for _, r := range rings {
+		if r.Contains(pt) {
+			in = !in
+		}
+	}
+	return in
+}
+
+// loops returns the offset contours of shapes, half an interval in from the outline and then
+// every interval, grouped by offset level
+func loops(shapes []geom.Shape, p Params) ([][]geom.Path, *geom.DistanceField) {
+	field := geom.NewDistanceField(shapes, p.res(), 0)
+	levels := [][]geom.Path{}
+	for d := p.Interval / 2; ; d += p.Interval {
+		c := field.Contours(d)
+		if len(c) == 0 {
+			break
+		}
+		for i := range c {
+			c[i] = c[i].SimplifyClosed(field.Res / 4)
+		}
+		levels = append(levels, c)
+	}
+	return levels, field
+}
+
+// concentric burns every offset loop on its own, from the outline inwards
+func concentric(shapes []geom.Shape, p Params) []geom.Path {
+	levels, _ := loops(shapes, p)
+	out := []geom.Path{}
+	pos := geom.Point{}
+	for i, level := range levels {
+		for _, l := range geom.OrderPaths(level, true, pos) {
+			if p.Bidirectional && i%2 == 1 {
+				l = l.Reverse()
+			}
+			out = append(out, l.Closed())
+			pos = l[0]
+		}
+	}
+	return out
+}
+
+// spiral links each loop to the nearest loop one level in when the step between them stays
+// inside the shapes, so the laser keeps burning from the outline to the middle
+func spiral(shapes []geom.Shape, p Params) []geom.Path {
+	levels, field := loops(shapes, p)
+	used := make([][]bool, len(levels))
+	for i := range levels {
+		used[i] = make([]bool, len(levels[i]))
+	}
+	out := []geom.Path{}
+	pos := geom.Point{}
+	for i := range levels {
+		for {
+			// start a stroke on the nearest loop left at the outermost level
+			k := nearest(levels[i], used[i], pos, math.Inf(1))
+			if k < 0 {
+				break
+			}
+			stroke := geom.Path{}
+			for li, lk := i, k; ; {
+				used[li][lk] = true
+				l := levels[li][lk].RotateStart(pos)
+				stroke = append(stroke, l.Closed()...)
+				pos = l[0]
+				if li+1 >= len(levels) {
+					break
+				}
+				n := nearest(levels[li+1], used[li+1], pos, 2*p.Interval)
+				if n < 0 {
+					break
+				}
+				level := p.Interval/2 + float64(li)*p.Interval
+				if !field.SegmentInside(pos, levels[li+1][n].RotateStart(pos)[0], level-field.Res) {
+					break
+				}
+				li, lk = li+1, n
+			}
+			out = append(out, stroke)
+		}
+	}
+	return out
+}
+
+// nearest returns the unused loop with a vertex closest to pt within limit, or -1
+func nearest(loops []geom.Path, used []bool, pt geom.Point, limit float64) int {
+	best, bi := limit, -1
+	for i, l := range loops {
+		if used[i] {
+			continue
+		}
+		for _, v := range l {
+			if d := v.Dist(pt); d < best {
+				best, bi = d, i
+			}
+		}
+	}
+	return bi
+}
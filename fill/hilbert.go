@@ -0,0 +1,77 @@
+package fill
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// hilbert walks a Hilbert curve over cells of interval size covering the shapes and keeps the
+// runs of cells whose centres are inside
+func hilbert(shapes []geom.Shape, interval float64) ([]geom.Path, error) {
+	rings := []geom.Path{}
+	b := geom.EmptyRect()
+	for _, s := range shapes {
+		rings = append(rings, s.Rings()...)
+		b = b.Union(s.Bounds())
+	}
+	cells := int(math.Ceil(math.Max(b.Width(), b.Height()) / interval))
+	n := 1
+	for n < cells {
+		n *= 2
+	}
+	if n*n > maxHilbertCells {
+		return nil, fmt.Errorf("a hilbert fill this size needs a coarser interval than %.3fmm", interval)
+	}
+	centre := func(i, j int) geom.Point {
+		return geom.Point{X: b.Min.X + (float64(i)+0.5)*interval, Y: b.Min.Y + (float64(j)+0.5)*interval}
+	}
+	rows := make([][]float64, n)
+	for j := range rows {
+		rows[j] = geom.ScanLine(rings, centre(0, j).Y)
+	}
+	inside := func(i, j int) bool {
+		x := centre(i, j).X
+		return x <= b.Max.X && sort.SearchFloat64s(rows[j], x)%2 == 1
+	}
+
+	out := []geom.Path{}
+	stroke := geom.Path{}
+	flush := func() {
+		if len(stroke) > 1 {
+			out = append(out, stroke)
+		}
+		stroke = geom.Path{}
+	}
+	for d := 0; d < n*n; d++ {
+		i, j := hilbertCell(n, d)
+		if !inside(i, j) {
+			flush()
+			continue
+		}
+		stroke = append(stroke, centre(i, j))
+	}
+	flush()
+	return out, nil
+}
+
+// hilbertCell returns the cell at distance d along a Hilbert curve over an n by n grid
+func hilbertCell(n, d int) (int, int) {
+	x, y := 0, 0
+	for s := 1; s < n; s *= 2 {
+		rx := 1 & (d / 2)
+		ry := 1 & (d ^ rx)
+		if ry == 0 {
+			if rx == 1 {
+				x, y = s-1-x, s-1-y
+			}
+			x, y = y, x
+		}
+		x += s * rx
+		y += s * ry
+		d /= 4
+	}
+	return x, y
+}
@@ -0,0 +1,222 @@
+package gcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Word is a letter and its number, e.g. G1 or X10.5
+type Word struct {
+	Letter byte
+	Value  float64
+	raw    string // number as written, kept so untouched words print unchanged
+}
+
+// Block is one line of G-code. Lines that are not made of words, like GRBL $ commands and %
+// markers, are kept in Raw and passed through untouched.
+type Block struct {
+	Words   []Word
+	Comment string // comments as written, including the ; or brackets
+	Raw     string
+}
+
+// ParseLine splits a line into words and comments
+func ParseLine(line string) (Block, error) {
+	b := Block{}
+	s := strings.TrimSpace(line)
+	if strings.HasPrefix(s, "$") || strings.HasPrefix(s, "%") {
+		b.Raw = s
+		return b, nil
+	}
+	comments := []string{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == ';':
+			comments = append(comments, s[i:])
+			i = len(s)
+		case c == '(':
+			end := strings.IndexByte(s[i:], ')')
+			if end < 0 {
+				return b, fmt.Errorf("unclosed comment in %q", line)
+			}
+			comments = append(comments, s[i:i+end+1])
+			i += end + 1
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'):
+			j := i + 1
+			for j < len(s) && s[j] == ' ' {
+				j++
+			}
+			k := j
+			for k < len(s) && (s[k] == '-' || s[k] == '+' || s[k] == '.' || (s[k] >= '0' && s[k] <= '9')) {
+				k++
+			}
+			v, err := strconv.ParseFloat(s[j:k], 64)
+			if err != nil {
+				return b, fmt.Errorf("bad number after %c in %q", c, line)
+			}
+			b.Words = append(b.Words, Word{Letter: upper(c), Value: v, raw: s[j:k]})
+			i = k
+		default:
+			return b, fmt.Errorf("unexpected %q in %q", c, line)
+		}
+	}
+	b.Comment = strings.Join(comments, " ")
+	return b, nil
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// String formats the block back into a line
+func (b Block) String() string {
+	if b.Raw != "" {
+		return b.Raw
+	}
+	parts := make([]string, 0, len(b.Words)+1)
+	for _, w := range b.Words {
+		parts = append(parts, w.String())
+	}
+	if b.Comment != "" {
+		parts = append(parts, b.Comment)
+	}
+	return strings.Join(parts, " ")
+}
+
+// String formats the word, numbers that were changed are rounded to 4 decimals
+func (w Word) String() string {
+	if w.raw != "" {
+		return string(w.Letter) + w.raw
+	}
+	return string(w.Letter) + FormatNumber(w.Value)
+}
+
+// FormatNumber formats a value rounded to 4 decimals without trailing zeros
+func FormatNumber(v float64) string {
+	v = math.Round(v*1e4) / 1e4
+	if v == 0 {
+		v = 0 // no negative zero
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Get returns the value of the first word with the letter
+func (b Block) Get(letter byte) (float64, bool) {
+	for _, w := range b.Words {
+		if w.Letter == letter {
+			return w.Value, true
+		}
+	}
+	return 0, false
+}
+
+// Has reports whether the block has a word with the letter
+func (b Block) Has(letter byte) bool {
+	_, ok := b.Get(letter)
+	return ok
+}
+
+// HasCode reports whether the block has the word, e.g. HasCode('G', 91)
+func (b Block) HasCode(letter byte, code float64) bool {
+	for _, w := range b.Words {
+		if w.Letter == letter && math.Abs(w.Value-code) < 1e-6 {
+			return true
+		}
+	}
+	return false
+}
+
+// Set changes the value of the first word with the letter, adding the word when missing
+func (b *Block) Set(letter byte, v float64) {
+	for i, w := range b.Words {
+		if w.Letter == letter {
+			b.Words[i] = Word{Letter: letter, Value: v}
+			return
+		}
+	}
+	b.Words = append(b.Words, Word{Letter: letter, Value: v})
+}
+
+// Remove drops every word with the letter
+func (b *Block) Remove(letter byte) {
+	out := b.Words[:0]
+	for _, w := range b.Words {
+		if w.Letter != letter {
+			out = append(out, w)
+		}
+	}
+	b.Words = out
+}
+
+// RemoveCode drops the word, e.g. RemoveCode('G', 91)
+func (b *Block) RemoveCode(letter byte, code float64) {
+	out := b.Words[:0]
+	for _, w := range b.Words {
+		if w.Letter != letter || math.Abs(w.Value-code) > 1e-6 {
+			out = append(out, w)
+		}
+	}
+	b.Words = out
+}
+
+// Empty reports whether the block has neither words nor comments
+func (b Block) Empty() bool {
+	return b.Raw == "" && len(b.Words) == 0 && b.Comment == ""
+}
+
+// Read parses a program
+func Read(r io.Reader) ([]Block, error) {
+	blocks := []Block{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		b, err := ParseLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		blocks = append(blocks, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading gcode: %v", err)
+	}
+	return blocks, nil
+}
+
+// ReadFile parses a program file, - reads standard input
+func ReadFile(path string) ([]Block, error) {
+	if path == "-" {
+		return Read(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// ParseString parses a program held in a string
+func ParseString(s string) ([]Block, error) {
+	return Read(strings.NewReader(s))
+}
+
+// Format returns the program as text, one block per line
+func Format(blocks []Block) string {
+	var sb strings.Builder
+	for _, b := range blocks {
+		sb.WriteString(b.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
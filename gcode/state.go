@@ -0,0 +1,359 @@
+package gcode
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// AxisLetters are the axes a State tracks, in the order of Axes
+const AxisLetters = "XYZABC"
+
+// Axes is a position on every tracked axis, linear axes in mm and rotary axes in degrees
+type Axes [6]float64
+
+// axis indexes
+const (
+	X = iota
+	Y
+	Z
+	A
+	B
+	C
+)
+
+// mmPerInch converts G20 values
+const mmPerInch = 25.4
+
+// State follows the modal state of a program block by block
+type State struct {
+	Motion      int  // 0 to 3, 38 for probing, 73 and 81 to 89 for canned cycles, -1 after G80
+	Absolute    bool // G90
+	ArcAbsolute bool // G90.1, arc centres in absolute coordinates
+	Inches      bool // G20
+	Plane       int  // 17, 18 or 19
+	InverseTime bool // G93
+	RetractR    bool // G99, canned cycles retract to R rather than the start height
+	Feed        float64
+	Pos         Axes    // work position in mm
+	Known       [6]bool // whether each axis of Pos is known
+}
+
+// NewState returns the state a controller starts in, G0 G90 G21 G17 with the position unknown
+func NewState() *State {
+	return &State{Absolute: true, Plane: 17}
+}
+
+// Move is the motion a block makes
+type Move struct {
+	Motion   int // 0 rapid, 1 line, 2 clockwise arc, 3 counter clockwise arc
+	From, To Axes
+	Centre   [2]float64 // arc centre in the plane axes
+	Plane    int
+	Turns    int // extra full turns of an arc
+}
+
+// PlaneAxes returns the first and second axis of a plane and the axis normal to it
+func PlaneAxes(plane int) (int, int, int) {
+	switch plane {
+	case 18:
+		return Z, X, Y
+	case 19:
+		return Y, Z, X
+	}
+	return X, Y, Z
+}
+
+// offsetLetters returns the arc centre letters of the plane axes
+func offsetLetters(plane int) (byte, byte) {
+	switch plane {
+	case 18:
+		return 'K', 'I'
+	case 19:
+		return 'J', 'K'
+	}
+	return 'I', 'J'
+}
+
+// Scale returns the factor converting program values to mm
+func (s *State) Scale() float64 {
+	if s.Inches {
+		return mmPerInch
+	}
+	return 1
+}
+
+// axisWords reports whether a non modal code in the block uses the axis words for something
+// other than motion
+func axisWords(b Block) (bool, string) {
+	for _, w := range b.Words {
+		if w.Letter != 'G' {
+			continue
+		}
+		switch code := math.Round(w.Value * 10); code {
+		case 40, 100, 281, 301, 431, 921, 922, 923:
+			return true, ""
+		case 920:
+			return true, "G92"
+		case 280, 300:
+			return true, "home"
+		case 530:
+			return true, "machine"
+		}
+	}
+	return false, ""
+}
+
+// Apply updates the state with a block and returns the move it makes, if any. Moves that end
+// somewhere the program can not know, like homing and probing, mark the axes unknown.
+func (s *State) Apply(b Block) (Move, bool, error) {
+	if b.Raw != "" {
+		return Move{}, false, nil
+	}
+	for _, w := range b.Words {
+		switch {
+		case w.Letter == 'G':
+			switch code := math.Round(w.Value * 10); code {
+			case 0, 10, 20, 30:
+				s.Motion = int(code / 10)
+			case 382, 383, 384, 385:
+				s.Motion = 38
+			case 800:
+				s.Motion = -1
+			case 730, 810, 820, 830, 840, 850, 860, 870, 880, 890:
+				s.Motion = int(code / 10)
+			case 170, 180, 190:
+				s.Plane = int(code / 10)
+			case 200:
+				s.Inches = true
+			case 210:
+				s.Inches = false
+			case 900:
+				s.Absolute = true
+			case 910:
+				s.Absolute = false
+			case 901:
+				s.ArcAbsolute = true
+			case 911:
+				s.ArcAbsolute = false
+			case 930:
+				s.InverseTime = true
+			case 940:
+				s.InverseTime = false
+			case 980:
+				s.RetractR = false
+			case 990:
+				s.RetractR = true
+			}
+		case w.Letter == 'F':
+			s.Feed = w.Value * s.Scale()
+		}
+	}
+
+	has := false
+	for _, l := range AxisLetters {
+		if b.Has(byte(l)) {
+			has = true
+		}
+	}
+	if other, what := axisWords(b); other {
+		switch what {
+		case "G92":
+			for i, l := range AxisLetters {
+				if v, ok := b.Get(byte(l)); ok {
+					s.Pos[i], s.Known[i] = v*s.axisScale(i), true
+				}
+			}
+		case "home", "machine":
+			for i, l := range AxisLetters {
+				if what == "home" || b.Has(byte(l)) {
+					s.Known[i] = false
+				}
+			}
+		}
+		return Move{}, false, nil
+	}
+	if !has || s.Motion < 0 {
+		return Move{}, false, nil
+	}
+
+	m := Move{Motion: s.Motion, From: s.Pos, To: s.Pos, Plane: s.Plane}
+	for i, l := range AxisLetters {
+		v, ok := b.Get(byte(l))
+		if !ok {
+			continue
+		}
+		v *= s.axisScale(i)
+		if s.Absolute {
+			m.To[i], s.Known[i] = v, true
+		} else {
+			m.To[i] += v
+		}
+	}
+
+	switch {
+	case s.Motion == 38:
+		// probing stops wherever it touches
+		for i, l := range AxisLetters {
+			if b.Has(byte(l)) {
+				s.Known[i] = false
+			}
+		}
+		s.Pos = m.To
+		return Move{}, false, nil
+	case s.Canned():
+		// canned cycles end over the hole at the retract height
+		r, ok := b.Get('R')
+		z := m.From[Z]
+		if ok {
+			r *= s.Scale()
+			if !s.Absolute {
+				r += m.From[Z]
+			}
+			if s.RetractR {
+				z = r
+			} else {
+				z = math.Max(z, r)
+			}
+		}
+		m.To[Z] = z
+		m.Motion = 1
+		s.Pos = m.To
+		return m, true, nil
+	case s.Motion == 2 || s.Motion == 3:
+		if err := s.arcCentre(b, &m); err != nil {
+			return Move{}, false, err
+		}
+	}
+	s.Pos = m.To
+	return m, true, nil
+}
+
+// Canned reports whether a canned cycle is active
+func (s *State) Canned() bool {
+	return s.Motion == 73 || s.Motion >= 81
+}
+
+// axisScale converts linear axes from inches, rotary axes are always degrees
+func (s *State) axisScale(i int) float64 {
+	if i <= Z {
+		return s.Scale()
+	}
+	return 1
+}
+
+// arcCentre works out the centre of an arc from its offsets or radius
+func (s *State) arcCentre(b Block, m *Move) error {
+	a0, a1, _ := PlaneAxes(m.Plane)
+	l0, l1 := offsetLetters(m.Plane)
+	start := [2]float64{m.From[a0], m.From[a1]}
+	end := [2]float64{m.To[a0], m.To[a1]}
+	if p, ok := b.Get('P'); ok && p > 1 {
+		m.Turns = int(p) - 1
+	}
+	if r, ok := b.Get('R'); ok {
+		r *= s.Scale()
+		dx, dy := end[0]-start[0], end[1]-start[1]
+		d := math.Hypot(dx, dy)
+		if d < 1e-9 {
+			return fmt.Errorf("an R arc needs distinct start and end points")
+		}
+		h2 := r*r - d*d/4
+		if h2 < 0 {
+			if h2 < -1e-3*r*r {
+				return fmt.Errorf("arc radius %.4f is too small for its end points", math.Abs(r))
+			}
+			h2 = 0
+		}
+		// the centre is on the left of the chord for counter clockwise arcs under 180 degrees
+		h := math.Sqrt(h2) / d
+		if (m.Motion == 2) != (r < 0) {
+			h = -h
+		}
+		m.Centre = [2]float64{start[0] + dx/2 - h*dy, start[1] + dy/2 + h*dx}
+		return nil
+	}
+	i, iok := b.Get(l0)
+	j, jok := b.Get(l1)
+	if !iok && !jok {
+		return fmt.Errorf("arc without %c%c offsets or R", l0, l1)
+	}
+	i, j = i*s.Scale(), j*s.Scale()
+	if s.ArcAbsolute {
+		m.Centre = [2]float64{i, j}
+	} else {
+		m.Centre = [2]float64{start[0] + i, start[1] + j}
+	}
+	return nil
+}
+
+// Sweep returns the signed angle an arc turns through in radians, counter clockwise positive
+func (m Move) Sweep() float64 {
+	a0, a1, _ := PlaneAxes(m.Plane)
+	s := math.Atan2(m.From[a1]-m.Centre[1], m.From[a0]-m.Centre[0])
+	e := math.Atan2(m.To[a1]-m.Centre[1], m.To[a0]-m.Centre[0])
+	sweep := e - s
+	if m.Motion == 3 {
+		for sweep <= 1e-9 {
+			sweep += 2 * math.Pi
+		}
+		sweep += float64(m.Turns) * 2 * math.Pi
+	} else {
+		for sweep >= -1e-9 {
+			sweep -= 2 * math.Pi
+		}
+		sweep -= float64(m.Turns) * 2 * math.Pi
+	}
+	return sweep
+}
+
+// Points returns the positions a move passes through after its start, arcs broken into lines
+// within tol of the curve. Lines return only their end.
+func (m Move) Points(tol float64) []Axes {
+	if m.Motion != 2 && m.Motion != 3 {
+		return []Axes{m.To}
+	}
+	a0, a1, _ := PlaneAxes(m.Plane)
+	r := math.Hypot(m.From[a0]-m.Centre[0], m.From[a1]-m.Centre[1])
+	sweep := m.Sweep()
+	n := 1
+	if r > tol {
+		n = int(math.Ceil(math.Abs(sweep) / (2 * math.Acos(1-tol/r))))
+	}
+	start := math.Atan2(m.From[a1]-m.Centre[1], m.From[a0]-m.Centre[0])
+	out := make([]Axes, 0, n)
+	for k := 1; k <= n; k++ {
+		t := float64(k) / float64(n)
+		p := m.From
+		for i := range p {
+			p[i] += (m.To[i] - m.From[i]) * t
+		}
+		if k < n {
+			a := start + sweep*t
+			p[a0] = m.Centre[0] + r*math.Cos(a)
+			p[a1] = m.Centre[1] + r*math.Sin(a)
+		} else {
+			p = m.To
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// Length returns the distance along a move over the linear axes
+func (m Move) Length() float64 {
+	l := 0.0
+	prev := m.From
+	for _, p := range m.Points(0.01) {
+		l += math.Sqrt(sq(p[X]-prev[X]) + sq(p[Y]-prev[Y]) + sq(p[Z]-prev[Z]))
+		prev = p
+	}
+	return l
+}
+
+func sq(v float64) float64 { return v * v }
+
+// AxisIndex returns the index of an axis letter in Axes, or -1
+func AxisIndex(letter byte) int {
+	return strings.IndexByte(AxisLetters, upper(letter))
+}
@@ -0,0 +1,268 @@
+package geom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ArcTolerance is the max chord error used when flattening arcs and bulges
+var ArcTolerance = 0.01
+
+// joinTolerance is how close two endpoints must be to be chained into one contour
+const joinTolerance = 1e-3
+
+// Circle entity from a drawing
+type CircleEntity struct {
+	Center Point
+	Radius float64
+}
+
+// Drawing holds the flattened geometry read from a vector file
+type Drawing struct {
+	Loops   []Path // closed contours, circles included
+	Open    []Path // polylines that could not be closed
+	Circles []CircleEntity
+}
+
+// Bounds returns the bounding box of everything in the drawing
+func (d *Drawing) Bounds() Rect {
+	r := EmptyRect()
+	for _, p := range append(append([]Path{}, d.Loops...), d.Open...) {
+		r = r.Union(p.Bounds())
+	}
+	return r
+}
+
+// Shapes nests the closed contours of the drawing
+func (d *Drawing) Shapes() []Shape {
+	return Nest(d.Loops)
+}
+
+type dxfPair struct {
+	code  int
+	value string
+}
+
+type dxfEntity struct {
+	kind  string
+	pairs []dxfPair
+}
+
+func (e dxfEntity) float(code int) float64 {
+	for _, p := range e.pairs {
+		if p.code == code {
+			f, _ := strconv.ParseFloat(p.value, 64)
+			return f
+		}
+	}
+	return 0
+}
+
+func (e dxfEntity) int(code int) int {
+	return int(e.float(code))
+}
+
+// ReadDXFFile reads the ENTITIES section of an ASCII DXF file
+func ReadDXFFile(filePath string) (*Drawing, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	return ReadDXF(file)
+}
+
+// ReadDXF reads LINE, ARC, CIRCLE, LWPOLYLINE and POLYLINE entities. Lines, arcs and open
+// polylines whose ends meet are chained into closed contours.
+func ReadDXF(r io.Reader) (*Drawing, error) {
+	scanner := bufio.NewScanner(r)
+	pairs := []dxfPair{}
+	for scanner.Scan() {
+		code, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			return nil, fmt.Errorf("bad group code %q", scanner.Text())
+		}
+		if !scanner.Scan() {
+			break
+		}
+		pairs = append(pairs, dxfPair{code, strings.TrimSpace(scanner.Text())})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+
+	// collect the entities inside the ENTITIES section
+	entities := []dxfEntity{}
+	inEntities := false
+	for i := 0; i < len(pairs); i++ {
+		p := pairs[i]
+		if p.code == 2 && i > 0 && pairs[i-1].code == 0 && pairs[i-1].value == "SECTION" {
+			inEntities = p.value == "ENTITIES"
+			continue
+		}
+		if !inEntities || p.code != 0 {
+			continue
+		}
+		if p.value == "ENDSEC" {
+			inEntities = false
+			continue
+		}
+		e := dxfEntity{kind: p.value}
+		for i+1 < len(pairs) && pairs[i+1].code != 0 {
+			i++
+			e.pairs = append(e.pairs, pairs[i])
+		}
+		entities = append(entities, e)
+	}
+
+	d := &Drawing{}
+	open := []Path{}
+	for i := 0; i < len(entities); i++ {
+		e := entities[i]
+		switch e.kind {
+		case "LINE":
+			open = append(open, Path{{e.float(10), e.float(20)}, {e.float(11), e.float(21)}})
+		case "CIRCLE":
+			c := CircleEntity{Center: Point{e.float(10), e.float(20)}, Radius: e.float(40)}
+			d.Circles = append(d.Circles, c)
+			d.Loops = append(d.Loops, Circle(c.Center, c.Radius, ArcTolerance))
+		case "ARC":
+			a0 := e.float(50) * math.Pi / 180
+			a1 := e.float(51) * math.Pi / 180
+			for a1 <= a0 {
+				a1 += 2 * math.Pi
+			}
+			open = append(open, Arc(Point{e.float(10), e.float(20)}, e.float(40), a0, a1-a0, ArcTolerance))
+		case "LWPOLYLINE":
+			verts, bulges := []Point{}, []float64{}
+			for _, p := range e.pairs {
+				switch p.code {
+				case 10:
+					x, _ := strconv.ParseFloat(p.value, 64)
+					verts = append(verts, Point{X: x})
+					bulges = append(bulges, 0)
+				case 20:
+					verts[len(verts)-1].Y, _ = strconv.ParseFloat(p.value, 64)
+				case 42:
+					bulges[len(bulges)-1], _ = strconv.ParseFloat(p.value, 64)
+				}
+			}
+			d.addPolyline(&open, verts, bulges, e.int(70)&1 == 1)
+		case "POLYLINE":
+			closed := e.int(70)&1 == 1
+			verts, bulges := []Point{}, []float64{}
+			for i+1 < len(entities) && entities[i+1].kind == "VERTEX" {
+				i++
+				verts = append(verts, Point{entities[i].float(10), entities[i].float(20)})
+				bulges = append(bulges, entities[i].float(42))
+			}
+			d.addPolyline(&open, verts, bulges, closed)
+		}
+	}
+
+	loops, rest := Chain(open, joinTolerance)
+	d.Loops = append(d.Loops, loops...)
+	d.Open = rest
+	return d, nil
+}
+
+func (d *Drawing) addPolyline(open *[]Path, verts []Point, bulges []float64, closed bool) {
+	if len(verts) < 2 {
+		return
+	}
+	n := len(verts)
+	if !closed {
+		n--
+	}
+	out := Path{verts[0]}
+	for i := 0; i < n; i++ {
+		a, b := verts[i], verts[(i+1)%len(verts)]
+		if bulges[i] != 0 {
+			arc := BulgeArc(a, b, bulges[i], ArcTolerance)
+			out = append(out, arc[1:]...)
+		} else {
+			out = append(out, b)
+		}
+	}
+	if closed {
+		d.Loops = append(d.Loops, out[:len(out)-1])
+	} else {
+		*open = append(*open, out)
+	}
+}
+
+// BulgeArc flattens a DXF bulge segment, bulge is tan(sweep/4) and positive for counter clockwise
+func BulgeArc(a, b Point, bulge, tol float64) Path {
+	sweep := 4 * math.Atan(bulge)
+	chord := a.Dist(b)
+	r := chord / (2 * math.Sin(math.Abs(sweep)/2))
+	// centre sits on the perpendicular bisector of the chord
+	mid := a.Lerp(b, 0.5)
+	h := math.Sqrt(math.Max(0, r*r-chord*chord/4))
+	dir := b.Sub(a).Scale(1 / chord)
+	normal := Point{-dir.Y, dir.X}
+	if (bulge > 0) != (math.Abs(sweep) > math.Pi) {
+		normal = normal.Scale(-1)
+	}
+	c := mid.Sub(normal.Scale(h))
+	a0 := math.Atan2(a.Y-c.Y, a.X-c.X)
+	arc := Arc(c, r, a0, sweep, tol)
+	arc[len(arc)-1] = b
+	return arc
+}
+
+// Chain joins open paths whose endpoints meet within tol. Paths that close on themselves are
+// returned as loops (without the repeated end point), the rest are returned as open paths.
+func Chain(paths []Path, tol float64) ([]Path, []Path) {
+	loops, open := []Path{}, []Path{}
+	used := make([]bool, len(paths))
+	for i := range paths {
+		if used[i] || len(paths[i]) < 2 {
+			continue
+		}
+		used[i] = true
+		cur := append(Path{}, paths[i]...)
+		for {
+			if cur[0].Dist(cur[len(cur)-1]) <= tol && len(cur) > 2 {
+				break
+			}
+			found := false
+			for j := range paths {
+				if used[j] || len(paths[j]) < 2 {
+					continue
+				}
+				p := paths[j]
+				end := cur[len(cur)-1]
+				switch {
+				case end.Dist(p[0]) <= tol:
+					cur = append(cur, p[1:]...)
+				case end.Dist(p[len(p)-1]) <= tol:
+					cur = append(cur, p.Reverse()[1:]...)
+				case cur[0].Dist(p[len(p)-1]) <= tol:
+					cur = append(append(Path{}, p[:len(p)-1]...), cur...)
+				case cur[0].Dist(p[0]) <= tol:
+					cur = append(p.Reverse()[:len(p)-1], cur...)
+				default:
+					continue
+				}
+				used[j] = true
+				found = true
+				break
+			}
+			if !found {
+				break
+			}
+		}
+		if len(cur) > 3 && cur[0].Dist(cur[len(cur)-1]) <= tol {
+			loops = append(loops, cur[:len(cur)-1])
+		} else {
+			open = append(open, cur)
+		}
+	}
+	return loops, open
+}
@@ -0,0 +1,357 @@
+package geom
+
+import (
+	"math"
+	"sort"
+)
+
+// maxFieldCells caps the size of a distance field, the resolution is coarsened to stay under it
+const maxFieldCells = 2000000
+
+// DistanceField is a sampled signed distance to the boundary of a set of shapes.
+// Values are positive inside material to be cut and negative outside, so the contour at
+// level d is the boundary offset inwards by d.
+type DistanceField struct {
+	Origin Point
+	Res    float64
+	NX, NY int
+	V      []float64
+}
+
+// NewDistanceField samples the signed distance of shapes on a grid of spacing res. The grid is
+// padded by margin on every side so contours at negative levels down to -margin stay closed.
+func NewDistanceField(shapes []Shape, res, margin float64) *DistanceField {
+	b := EmptyRect()
+	rings := []Path{}
+	for _, s := range shapes {
+		b = b.Union(s.Bounds())
+		rings = append(rings, s.Rings()...)
+	}
+	pad := margin + 2*res
+	for {
+		nx := int(math.Ceil((b.Width()+2*pad)/res)) + 1
+		ny := int(math.Ceil((b.Height()+2*pad)/res)) + 1
+		if nx*ny <= maxFieldCells {
+			break
+		}
+		res *= 1.25
+		pad = margin + 2*res
+	}
+	f := &DistanceField{
+		Origin: Point{b.Min.X - pad, b.Min.Y - pad},
+		Res:    res,
+		NX:     int(math.Ceil((b.Width()+2*pad)/res)) + 1,
+		NY:     int(math.Ceil((b.Height()+2*pad)/res)) + 1,
+	}
+	f.V = make([]float64, f.NX*f.NY)
+
+	for j := 0; j < f.NY; j++ {
+		y := f.Origin.Y + float64(j)*res
+		// inside/outside for the whole row from the scanline crossings
+		xs := ScanLine(rings, y)
+		k := 0
+		for i := 0; i < f.NX; i++ {
+			pt := Point{f.Origin.X + float64(i)*res, y}
+			for k < len(xs) && xs[k] <= pt.X {
+				k++
+			}
+			d := math.Inf(1)
+			for _, r := range rings {
+				for a, c := 0, len(r)-1; a < len(r); c, a = a, a+1 {
+					if sd := SegmentDist(pt, r[c], r[a]); sd < d {
+						d = sd
+					}
+				}
+			}
+			if k%2 == 0 {
+				d = -d
+			}
+			f.V[j*f.NX+i] = d
+		}
+	}
+	return f
+}
+
+// NewBandedField is like NewDistanceField but only resolves distances up to reach from the
+// boundary, further samples are clamped to ±reach. The grid is padded by reach so grown
+// contours fit. Each segment only touches the samples near it, which is much faster for
+// drawings with many segments when only shallow levels are needed.
+func NewBandedField(shapes []Shape, res, reach float64) *DistanceField {
+	b := EmptyRect()
+	rings := []Path{}
+	for _, s := range shapes {
+		b = b.Union(s.Bounds())
+		rings = append(rings, s.Rings()...)
+	}
+	pad := reach + 2*res
+	for (math.Ceil((b.Width()+2*pad)/res)+1)*(math.Ceil((b.Height()+2*pad)/res)+1) > maxFieldCells {
+		res *= 1.25
+		pad = reach + 2*res
+	}
+	f := NewEmptyField(b, res, reach)
+	for i := range f.V {
+		f.V[i] = reach
+	}
+	for _, r := range rings {
+		for a, c := 0, len(r)-1; a < len(r); c, a = a, a+1 {
+			sb := EmptyRect().Extend(r[c]).Extend(r[a])
+			i0 := max(int(math.Floor((sb.Min.X-reach-f.Origin.X)/f.Res)), 0)
+			i1 := min(int(math.Ceil((sb.Max.X+reach-f.Origin.X)/f.Res)), f.NX-1)
+			j0 := max(int(math.Floor((sb.Min.Y-reach-f.Origin.Y)/f.Res)), 0)
+			j1 := min(int(math.Ceil((sb.Max.Y+reach-f.Origin.Y)/f.Res)), f.NY-1)
+			for j := j0; j <= j1; j++ {
+				for i := i0; i <= i1; i++ {
+					k := j*f.NX + i
+					f.V[k] = math.Min(f.V[k], SegmentDist(f.point(i, j), r[c], r[a]))
+				}
+			}
+		}
+	}
+	for j := 0; j < f.NY; j++ {
+		xs := ScanLine(rings, f.Origin.Y+float64(j)*f.Res)
+		k := 0
+		for i := 0; i < f.NX; i++ {
+			for k < len(xs) && xs[k] <= f.Origin.X+float64(i)*f.Res {
+				k++
+			}
+			if k%2 == 0 {
+				f.V[j*f.NX+i] = -f.V[j*f.NX+i]
+			}
+		}
+	}
+	return f
+}
+
+func (f *DistanceField) at(i, j int) float64 {
+	return f.V[j*f.NX+i]
+}
+
+func (f *DistanceField) point(i, j int) Point {
+	return Point{f.Origin.X + float64(i)*f.Res, f.Origin.Y + float64(j)*f.Res}
+}
+
+// At returns the bilinearly interpolated distance at pt, points off the grid are treated as far outside
+func (f *DistanceField) At(pt Point) float64 {
+	fx := (pt.X - f.Origin.X) / f.Res
+	fy := (pt.Y - f.Origin.Y) / f.Res
+	i, j := int(math.Floor(fx)), int(math.Floor(fy))
+	if i < 0 || j < 0 || i >= f.NX-1 || j >= f.NY-1 {
+		return math.Inf(-1)
+	}
+	tx, ty := fx-float64(i), fy-float64(j)
+	a := f.at(i, j)*(1-tx) + f.at(i+1, j)*tx
+	b := f.at(i, j+1)*(1-tx) + f.at(i+1, j+1)*tx
+	return a*(1-ty) + b*ty
+}
+
+// SegmentInside reports whether every sample along a-b is at or above level
+func (f *DistanceField) SegmentInside(a, b Point, level float64) bool {
+	n := int(math.Ceil(a.Dist(b)/(f.Res/2))) + 1
+	for i := 0; i <= n; i++ {
+		if f.At(a.Lerp(b, float64(i)/float64(n))) < level-f.Res*0.1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Max returns the sample with the largest distance inside region, which is the point with the most room
+func (f *DistanceField) Max(region Shape) (Point, float64) {
+	best, bp := math.Inf(-1), Point{}
+	rb := region.Bounds()
+	for j := 0; j < f.NY; j++ {
+		for i := 0; i < f.NX; i++ {
+			v := f.at(i, j)
+			if v <= best {
+				continue
+			}
+			pt := f.point(i, j)
+			if pt.X < rb.Min.X || pt.X > rb.Max.X || pt.Y < rb.Min.Y || pt.Y > rb.Max.Y || !region.Contains(pt) {
+				continue
+			}
+			best, bp = v, pt
+		}
+	}
+	return bp, best
+}
+
+// Contours extracts closed contours at the given level using marching squares. Contours are
+// oriented with the region above level on the left, so outer boundaries run counter clockwise.
+func (f *DistanceField) Contours(level float64) []Path {
+	type seg struct {
+		from, to int
+		a, b     Point
+	}
+	// edge ids: horizontal edge from (i,j) to (i+1,j) is even, vertical edge from (i,j) to (i,j+1) is odd
+	hEdge := func(i, j int) int { return (j*f.NX + i) * 2 }
+	vEdge := func(i, j int) int { return (j*f.NX+i)*2 + 1 }
+	cross := func(a, b Point, va, vb float64) Point {
+		t := (level - va) / (vb - va)
+		return a.Lerp(b, t)
+	}
+
+	next := map[int]seg{}
+	for j := 0; j < f.NY-1; j++ {
+		for i := 0; i < f.NX-1; i++ {
+			// corners counter clockwise: bl, br, tr, tl
+			ci := [4][2]int{{i, j}, {i + 1, j}, {i + 1, j + 1}, {i, j + 1}}
+			var v [4]float64
+			var in [4]bool
+			n := 0
+			for k, c := range ci {
+				v[k] = f.at(c[0], c[1])
+				in[k] = v[k] >= level
+				if in[k] {
+					n++
+				}
+			}
+			if n == 0 || n == 4 {
+				continue
+			}
+			// edges counter clockwise: bottom, right, top, left. edge k runs from corner k to corner k+1
+			ids := [4]int{hEdge(i, j), vEdge(i+1, j), hEdge(i, j+1), vEdge(i, j)}
+			var pts [4]Point
+			var has [4]bool
+			for k := 0; k < 4; k++ {
+				a, b := (k+1)%4, k
+				if in[k] != in[(k+1)%4] {
+					has[k] = true
+					pts[k] = cross(f.point(ci[b][0], ci[b][1]), f.point(ci[a][0], ci[a][1]), v[b], v[a])
+				}
+			}
+			add := func(p, q int) {
+				next[ids[p]] = seg{from: ids[p], to: ids[q], a: pts[p], b: pts[q]}
+			}
+			// cutCorner adds the segment that cuts off corner k, keeping the inside on the left
+			cutCorner := func(k int) {
+				e0, e1 := k, (k+3)%4
+				if in[k] {
+					add(e0, e1)
+				} else {
+					add(e1, e0)
+				}
+			}
+			switch {
+			case has[0] && has[2] && !has[1] && !has[3]:
+				if in[0] {
+					add(0, 2)
+				} else {
+					add(2, 0)
+				}
+			case has[1] && has[3] && !has[0] && !has[2]:
+				if in[0] {
+					add(1, 3)
+				} else {
+					add(3, 1)
+				}
+			case n == 2:
+				// saddle, decide on the cell centre which pair of corners is connected
+				center := (v[0] + v[1] + v[2] + v[3]) / 4
+				for k := 0; k < 4; k++ {
+					if in[k] != (center >= level) {
+						cutCorner(k)
+					}
+				}
+			default:
+				// a single corner differs from the other three
+				for k := 0; k < 4; k++ {
+					if (n == 1 && in[k]) || (n == 3 && !in[k]) {
+						cutCorner(k)
+					}
+				}
+			}
+		}
+	}
+
+	// walk the segments in edge order so the output does not depend on map iteration
+	keys := make([]int, 0, len(next))
+	for k := range next {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	out := []Path{}
+	for _, k := range keys {
+		cur, ok := next[k]
+		if !ok {
+			continue
+		}
+		loop := Path{}
+		for {
+			delete(next, cur.from)
+			loop = append(loop, cur.a)
+			n, ok := next[cur.to]
+			if !ok {
+				break
+			}
+			cur = n
+		}
+		if len(loop) >= 3 {
+			loop = loop.SimplifyClosed(f.Res * 0.05)
+			if len(loop) >= 3 {
+				out = append(out, loop)
+			}
+		}
+	}
+	return out
+}
+
+// Offset returns the shapes bounded by the contour at level, i.e. the input shapes shrunk by
+// level when positive or grown when negative
+func (f *DistanceField) Offset(level float64) []Shape {
+	return Nest(f.Contours(level))
+}
+
+// NewEmptyField returns a field covering b plus margin where every sample is -margin, ready to
+// have shapes painted onto it. Contours are only valid at levels above -margin.
+func NewEmptyField(b Rect, res, margin float64) *DistanceField {
+	pad := margin + 2*res
+	f := &DistanceField{
+		Origin: Point{b.Min.X - pad, b.Min.Y - pad},
+		Res:    res,
+		NX:     int(math.Ceil((b.Width()+2*pad)/res)) + 1,
+		NY:     int(math.Ceil((b.Height()+2*pad)/res)) + 1,
+	}
+	f.V = make([]float64, f.NX*f.NY)
+	for i := range f.V {
+		f.V[i] = -margin
+	}
+	return f
+}
+
+// Paint merges a shape given by its signed distance function sd (positive inside) and bounds b.
+// Dark shapes are unioned with the field, clear shapes are cut out of it. Only samples within
+// reach of b are touched, so reach should be the largest level that will be extracted.
+func (f *DistanceField) Paint(b Rect, reach float64, dark bool, sd func(Point) float64) {
+	i0 := int(math.Floor((b.Min.X - reach - f.Origin.X) / f.Res))
+	i1 := int(math.Ceil((b.Max.X + reach - f.Origin.X) / f.Res))
+	j0 := int(math.Floor((b.Min.Y - reach - f.Origin.Y) / f.Res))
+	j1 := int(math.Ceil((b.Max.Y + reach - f.Origin.Y) / f.Res))
+	for j := max(j0, 0); j <= min(j1, f.NY-1); j++ {
+		for i := max(i0, 0); i <= min(i1, f.NX-1); i++ {
+			d := sd(f.point(i, j))
+			k := j*f.NX + i
+			if dark {
+				f.V[k] = math.Max(f.V[k], d)
+			} else {
+				f.V[k] = math.Min(f.V[k], -d)
+			}
+		}
+	}
+}
+
+// CapsuleDist is the signed distance to a line segment a-b swept by a circle of radius r
+func CapsuleDist(pt, a, b Point, r float64) float64 {
+	return r - SegmentDist(pt, a, b)
+}
+
+// PolygonDist is the signed distance to a closed polygon, positive inside
+func PolygonDist(pt Point, poly Path) float64 {
+	d := math.Inf(1)
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		d = math.Min(d, SegmentDist(pt, poly[j], poly[i]))
+	}
+	if poly.Contains(pt) {
+		return d
+	}
+	return -d
+}
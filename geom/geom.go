@@ -0,0 +1,404 @@
+package geom
+
+import (
+	"math"
+	"sort"
+)
+
+// Point is a 2D point in the XY plane
+type Point struct {
+	X, Y float64
+}
+
+func (p Point) Add(q Point) Point     { return Point{p.X + q.X, p.Y + q.Y} }
+func (p Point) Sub(q Point) Point     { return Point{p.X - q.X, p.Y - q.Y} }
+func (p Point) Scale(s float64) Point { return Point{p.X * s, p.Y * s} }
+func (p Point) Dot(q Point) float64   { return p.X*q.X + p.Y*q.Y }
+func (p Point) Cross(q Point) float64 { return p.X*q.Y - p.Y*q.X }
+func (p Point) Len() float64          { return math.Hypot(p.X, p.Y) }
+func (p Point) Dist(q Point) float64  { return math.Hypot(p.X-q.X, p.Y-q.Y) }
+func (p Point) Lerp(q Point, t float64) Point {
+	return Point{p.X + (q.X-p.X)*t, p.Y + (q.Y-p.Y)*t}
+}
+
+// Rect is an axis aligned bounding box
+type Rect struct {
+	Min, Max Point
+}
+
+// EmptyRect returns a rect that any point will expand
+func EmptyRect() Rect {
+	return Rect{Min: Point{math.Inf(1), math.Inf(1)}, Max: Point{math.Inf(-1), math.Inf(-1)}}
+}
+
+// Extend grows the rect to include p
+func (r Rect) Extend(p Point) Rect {
+	r.Min.X = math.Min(r.Min.X, p.X)
+	r.Min.Y = math.Min(r.Min.Y, p.Y)
+	r.Max.X = math.Max(r.Max.X, p.X)
+	r.Max.Y = math.Max(r.Max.Y, p.Y)
+	return r
+}
+
+// Union returns the rect covering both r and o
+func (r Rect) Union(o Rect) Rect {
+	return r.Extend(o.Min).Extend(o.Max)
+}
+
+func (r Rect) Width() float64  { return r.Max.X - r.Min.X }
+func (r Rect) Height() float64 { return r.Max.Y - r.Min.Y }
+func (r Rect) Empty() bool     { return r.Min.X > r.Max.X || r.Min.Y > r.Max.Y }
+
+// Path is a polyline, when used as a closed contour the last point connects back to the first
+type Path []Point
+
+// Area returns the signed area of a closed path, positive for counter clockwise
+func (p Path) Area() float64 {
+	a := 0.0
+	for i := range p {
+		j := (i + 1) % len(p)
+		a += p[i].X*p[j].Y - p[j].X*p[i].Y
+	}
+	return a / 2
+}
+
+// Length returns the length of the path, closed adds the segment back to the start
+func (p Path) Length(closed bool) float64 {
+	l := 0.0
+	for i := 1; i < len(p); i++ {
+		l += p[i].Dist(p[i-1])
+	}
+	if closed && len(p) > 1 {
+		l += p[len(p)-1].Dist(p[0])
+	}
+	return l
+}
+
+// Reverse returns a reversed copy of the path
+func (p Path) Reverse() Path {
+	out := make(Path, len(p))
+	for i := range p {
+		out[len(p)-1-i] = p[i]
+	}
+	return out
+}
+
+// Bounds returns the bounding box of the path
+func (p Path) Bounds() Rect {
+	r := EmptyRect()
+	for _, pt := range p {
+		r = r.Extend(pt)
+	}
+	return r
+}
+
+// Contains reports whether pt is inside the closed path (even-odd rule)
+func (p Path) Contains(pt Point) bool {
+	in := false
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		a, b := p[i], p[j]
+		if (a.Y > pt.Y) != (b.Y > pt.Y) {
+			x := a.X + (pt.Y-a.Y)/(b.Y-a.Y)*(b.X-a.X)
+			if pt.X < x {
+				in = !in
+			}
+		}
+	}
+	return in
+}
+
+// Orient returns a copy of the closed path wound counter clockwise when ccw is true, clockwise otherwise
+func (p Path) Orient(ccw bool) Path {
+	if (p.Area() > 0) != ccw {
+		return p.Reverse()
+	}
+	return append(Path{}, p...)
+}
+
+// RotateStart returns a copy of the closed path starting at the vertex nearest to pt
+func (p Path) RotateStart(pt Point) Path {
+	best, bi := math.Inf(1), 0
+	for i, v := range p {
+		if d := v.Dist(pt); d < best {
+			best, bi = d, i
+		}
+	}
+	return append(append(Path{}, p[bi:]...), p[:bi]...)
+}
+
+// Closed returns a copy of the path with the first point appended so it can be walked as a loop
+func (p Path) Closed() Path {
+	if len(p) == 0 || p[0] == p[len(p)-1] {
+		return append(Path{}, p...)
+	}
+	return append(append(Path{}, p...), p[0])
+}
+
+// SegmentDist returns the distance from pt to the segment a-b
+func SegmentDist(pt, a, b Point) float64 {
+	ab := b.Sub(a)
+	l2 := ab.Dot(ab)
+	if l2 == 0 {
+		return pt.Dist(a)
+	}
+	t := math.Max(0, math.Min(1, pt.Sub(a).Dot(ab)/l2))
+	return pt.Dist(a.Add(ab.Scale(t)))
+}
+
+// Simplify reduces the number of points in an open path using Douglas-Peucker
+func (p Path) Simplify(tol float64) Path {
+	if len(p) < 3 {
+		return append(Path{}, p...)
+	}
+	keep := make([]bool, len(p))
+	keep[0], keep[len(p)-1] = true, true
+	var rec func(i, j int)
+	rec = func(i, j int) {
+		best, bi := 0.0, -1
+		for k := i + 1; k < j; k++ {
+			if d := SegmentDist(p[k], p[i], p[j]); d > best {
+				best, bi = d, k
+			}
+		}
+		if bi >= 0 && best > tol {
+			keep[bi] = true
+			rec(i, bi)
+			rec(bi, j)
+		}
+	}
+	rec(0, len(p)-1)
+	out := Path{}
+	for i, k := range keep {
+		if k {
+			out = append(out, p[i])
+		}
+	}
+	return out
+}
+
+// SimplifyClosed simplifies a closed contour, splitting it at its farthest vertex so the seam is not fixed
+func (p Path) SimplifyClosed(tol float64) Path {
+	if len(p) < 4 {
+		return append(Path{}, p...)
+	}
+	far, fi := 0.0, 0
+	for i, v := range p {
+		if d := v.Dist(p[0]); d > far {
+			far, fi = d, i
+		}
+	}
+	a := append(Path{}, p[:fi+1]...).Simplify(tol)
+	b := append(append(Path{}, p[fi:]...), p[0]).Simplify(tol)
+	return append(a, b[1:len(b)-1]...)
+}
+
+// Shape is a closed outer contour with zero or more holes (islands)
+type Shape struct {
+	Outer Path
+	Holes []Path
+}
+
+// Contains reports whether pt is inside the outer contour and not inside a hole
+func (s Shape) Contains(pt Point) bool {
+	if !s.Outer.Contains(pt) {
+		return false
+	}
+	for _, h := range s.Holes {
+		if h.Contains(pt) {
+			return false
+		}
+	}
+	return true
+}
+
+// Rings returns the outer contour followed by the holes
+func (s Shape) Rings() []Path {
+	return append([]Path{s.Outer}, s.Holes...)
+}
+
+// Bounds returns the bounding box of the outer contour
+func (s Shape) Bounds() Rect {
+	return s.Outer.Bounds()
+}
+
+// Nest groups closed contours into shapes, a contour nested at an odd depth becomes a hole of
+// its parent, at an even depth it starts a new shape. Outers are wound counter clockwise and holes clockwise.
+func Nest(loops []Path) []Shape {
+	type node struct {
+		path   Path
+		area   float64
+		parent int
+		depth  int
+	}
+	nodes := []node{}
+	for _, l := range loops {
+		if len(l) < 3 || math.Abs(l.Area()) < 1e-12 {
+			continue
+		}
+		nodes = append(nodes, node{path: l, area: math.Abs(l.Area()), parent: -1})
+	}
+	// sort largest first so parents are always resolved before children
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].area > nodes[j].area })
+	for i := range nodes {
+		for j := i - 1; j >= 0; j-- {
+			if nodes[j].path.Contains(nodes[i].path[0]) && nodes[j].area > nodes[i].area {
+				if nodes[i].parent < 0 || nodes[j].area < nodes[nodes[i].parent].area {
+					nodes[i].parent = j
+				}
+			}
+		}
+		if nodes[i].parent >= 0 {
+			nodes[i].depth = nodes[nodes[i].parent].depth + 1
+		}
+	}
+
+	shapes := []Shape{}
+	index := map[int]int{}
+	for i, n := range nodes {
+		if n.depth%2 == 0 {
+			index[i] = len(shapes)
+			shapes = append(shapes, Shape{Outer: n.path.Orient(true)})
+		}
+	}
+	for _, n := range nodes {
+		if n.depth%2 == 1 {
+			s := &shapes[index[n.parent]]
+			s.Holes = append(s.Holes, n.path.Orient(false))
+		}
+	}
+	return shapes
+}
+
+// ScanLine returns the sorted X positions where the horizontal line at y crosses the rings
+func ScanLine(rings []Path, y float64) []float64 {
+	xs := []float64{}
+	for _, p := range rings {
+		for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+			a, b := p[i], p[j]
+			if (a.Y > y) != (b.Y > y) {
+				xs = append(xs, a.X+(y-a.Y)/(b.Y-a.Y)*(b.X-a.X))
+			}
+		}
+	}
+	sort.Float64s(xs)
+	return xs
+}
+
+// Arc returns points along an arc from start angle a0 sweeping by sweep radians, spaced to keep
+// the chord error under tol
+func Arc(c Point, r, a0, sweep, tol float64) Path {
+	n := ArcSegments(r, sweep, tol)
+	out := make(Path, 0, n+1)
+	for i := 0; i <= n; i++ {
+		a := a0 + sweep*float64(i)/float64(n)
+		out = append(out, Point{c.X + r*math.Cos(a), c.Y + r*math.Sin(a)})
+	}
+	return out
+}
+
+// ArcSegments returns the number of chords needed to approximate an arc within tol
+func ArcSegments(r, sweep, tol float64) int {
+	if r <= tol || tol <= 0 {
+		return int(math.Max(4, math.Ceil(math.Abs(sweep)/(math.Pi/8))))
+	}
+	step := 2 * math.Acos(1-tol/r)
+	n := int(math.Ceil(math.Abs(sweep) / step))
+	if n < 4 {
+		n = 4
+	}
+	return n
+}
+
+// Circle returns a closed counter clockwise polygon approximating a circle
+func Circle(c Point, r, tol float64) Path {
+	p := Arc(c, r, 0, 2*math.Pi, tol)
+	return p[:len(p)-1]
+}
+
+// ConvexHull returns the counter clockwise convex hull of the points
+func ConvexHull(pts []Point) Path {
+	p := append([]Point{}, pts...)
+	sort.Slice(p, func(i, j int) bool {
+		if p[i].X != p[j].X {
+			return p[i].X < p[j].X
+		}
+		return p[i].Y < p[j].Y
+	})
+	if len(p) < 3 {
+		return p
+	}
+	hull := Path{}
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for _, pt := range p {
+			for len(hull) >= start+2 && hull[len(hull)-1].Sub(hull[len(hull)-2]).Cross(pt.Sub(hull[len(hull)-2])) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, pt)
+		}
+		hull = hull[:len(hull)-1]
+		// walk back along the upper hull
+		for i, j := 0, len(p)-1; i < j; i, j = i+1, j-1 {
+			p[i], p[j] = p[j], p[i]
+		}
+	}
+	return hull
+}
+
+// Transform returns a copy of the path rotated by angle radians about the origin and then moved by offset
+func (p Path) Transform(angle float64, offset Point) Path {
+	s, c := math.Sin(angle), math.Cos(angle)
+	out := make(Path, len(p))
+	for i, pt := range p {
+		out[i] = Point{pt.X*c - pt.Y*s + offset.X, pt.X*s + pt.Y*c + offset.Y}
+	}
+	return out
+}
+
+// OrderPaths orders paths to shorten the travel between them, starting nearest to start.
+// Closed paths are rotated to begin at the vertex closest to the previous end point, open
+// paths may be reversed.
+func OrderPaths(paths []Path, closed bool, start Point) []Path {
+	left := append([]Path{}, paths...)
+	out := make([]Path, 0, len(paths))
+	cur := start
+	for len(left) > 0 {
+		bi, bd, rev := 0, math.Inf(1), false
+		for i, p := range left {
+			if len(p) == 0 {
+				continue
+			}
+			if closed {
+				for _, v := range p {
+					if d := v.Dist(cur); d < bd {
+						bi, bd = i, d
+					}
+				}
+				continue
+			}
+			if d := p[0].Dist(cur); d < bd {
+				bi, bd, rev = i, d, false
+			}
+			if d := p[len(p)-1].Dist(cur); d < bd {
+				bi, bd, rev = i, d, true
+			}
+		}
+		p := left[bi]
+		left = append(left[:bi], left[bi+1:]...)
+		if len(p) == 0 {
+			continue
+		}
+		switch {
+		case closed:
+			p = p.RotateStart(cur)
+			cur = p[0]
+		case rev:
+			p = p.Reverse()
+			cur = p[len(p)-1]
+		default:
+			cur = p[len(p)-1]
+		}
+		out = append(out, p)
+	}
+	return out
+}
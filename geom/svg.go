@@ -0,0 +1,509 @@
+package geom
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReadDrawing reads a DXF or SVG file, chosen by the file extension
+func ReadDrawing(filePath string) (*Drawing, error) {
+	if strings.EqualFold(filepath.Ext(filePath), ".svg") {
+		return ReadSVGFile(filePath)
+	}
+	return ReadDXFFile(filePath)
+}
+
+// ReadSVGFile reads the shapes of an SVG file
+func ReadSVGFile(filePath string) (*Drawing, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	return ReadSVG(file)
+}
+
+// matrix is an SVG affine transform mapping (x, y) to (a*x + c*y + e, b*x + d*y + f)
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+func (m matrix) apply(p Point) Point {
+	return Point{m[0]*p.X + m[2]*p.Y + m[4], m[1]*p.X + m[3]*p.Y + m[5]}
+}
+
+// scale is the average length scale of the transform, used to size curve flattening
+func (m matrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+// svgUnits converts SVG lengths to mm, plain numbers are CSS pixels at 96 per inch
+var svgUnits = map[string]float64{"": 25.4 / 96, "px": 25.4 / 96, "mm": 1, "cm": 10, "in": 25.4, "pt": 25.4 / 72, "pc": 25.4 / 6}
+
+var reNumber = regexp.MustCompile(`[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?`)
+
+func svgNumbers(s string) []float64 {
+	out := []float64{}
+	for _, m := range reNumber.FindAllString(s, -1) {
+		v, _ := strconv.ParseFloat(m, 64)
+		out = append(out, v)
+	}
+	return out
+}
+
+// svgLength parses a length with an optional unit, returning the value in mm
+func svgLength(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	m := regexp.MustCompile(`^([-+]?[\d.]+(?:[eE][-+]?\d+)?)\s*([a-z]*)$`).FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	unit, ok := svgUnits[m[2]]
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	return v * unit, err == nil
+}
+
+// parseTransform parses an SVG transform attribute
+func parseTransform(s string) (matrix, error) {
+	m := identity
+	for _, t := range regexp.MustCompile(`(\w+)\s*\(([^)]*)\)`).FindAllStringSubmatch(s, -1) {
+		v := svgNumbers(t[2])
+		get := func(i int, def float64) float64 {
+			if i < len(v) {
+				return v[i]
+			}
+			return def
+		}
+		var n matrix
+		switch t[1] {
+		case "matrix":
+			if len(v) != 6 {
+				return m, fmt.Errorf("bad transform %q", t[0])
+			}
+			copy(n[:], v)
+		case "translate":
+			n = matrix{1, 0, 0, 1, get(0, 0), get(1, 0)}
+		case "scale":
+			n = matrix{get(0, 1), 0, 0, get(1, get(0, 1)), 0, 0}
+		case "rotate":
+			a := get(0, 0) * math.Pi / 180
+			cx, cy := get(1, 0), get(2, 0)
+			n = matrix{1, 0, 0, 1, cx, cy}.mul(matrix{math.Cos(a), math.Sin(a), -math.Sin(a), math.Cos(a), 0, 0}).mul(matrix{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			n = matrix{1, 0, math.Tan(get(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			n = matrix{1, math.Tan(get(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			return m, fmt.Errorf("unknown transform %q", t[1])
+		}
+		m = m.mul(n)
+	}
+	return m, nil
+}
+
+// ReadSVG reads path, rect, circle, ellipse, line, polyline and polygon elements. The drawing is
+// converted to mm using the document size and viewBox, with Y flipped so the bottom left corner
+// of the page is the origin. Open subpaths whose ends meet are chained into closed contours.
+func ReadSVG(r io.Reader) (*Drawing, error) {
+	dec := xml.NewDecoder(r)
+	d := &Drawing{}
+	open := []Path{}
+	stack := []matrix{}
+	skip := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading svg: %v", err)
+		}
+		if _, ok := tok.(xml.EndElement); ok {
+			if skip > 0 {
+				skip--
+			} else if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if skip > 0 {
+			skip++
+			continue
+		}
+		attr := map[string]string{}
+		for _, a := range el.Attr {
+			attr[a.Name.Local] = a.Value
+		}
+		switch el.Name.Local {
+		case "defs", "clipPath", "mask", "symbol", "marker", "pattern", "metadata":
+			skip = 1
+			continue
+		}
+
+		m := identity
+		if len(stack) > 0 {
+			m = stack[len(stack)-1]
+		} else if el.Name.Local == "svg" {
+			m = svgViewport(attr)
+		}
+		t, err := parseTransform(attr["transform"])
+		if err != nil {
+			return nil, err
+		}
+		m = m.mul(t)
+		stack = append(stack, m)
+
+		num := func(k string) float64 {
+			v, _ := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(attr[k], "px")), 64)
+			return v
+		}
+		addLoop := func(p Path) {
+			for i := range p {
+				p[i] = m.apply(p[i])
+			}
+			d.Loops = append(d.Loops, p)
+		}
+		switch el.Name.Local {
+		case "path":
+			loops, paths, err := svgPath(attr["d"], m)
+			if err != nil {
+				return nil, err
+			}
+			d.Loops = append(d.Loops, loops...)
+			open = append(open, paths...)
+		case "rect":
+			x, y, w, h := num("x"), num("y"), num("width"), num("height")
+			addLoop(Path{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}})
+		case "circle", "ellipse":
+			rx, ry := num("rx"), num("ry")
+			if el.Name.Local == "circle" {
+				rx, ry = num("r"), num("r")
+			}
+			c := Point{num("cx"), num("cy")}
+			loop := Circle(Point{}, 1, ArcTolerance/math.Max(rx, ry)/math.Max(m.scale(), 1e-9))
+			for i := range loop {
+				loop[i] = Point{c.X + loop[i].X*rx, c.Y + loop[i].Y*ry}
+			}
+			if rx == ry {
+				d.Circles = append(d.Circles, CircleEntity{Center: m.apply(c), Radius: rx * m.scale()})
+			}
+			addLoop(loop)
+		case "line":
+			open = append(open, Path{m.apply(Point{num("x1"), num("y1")}), m.apply(Point{num("x2"), num("y2")})})
+		case "polyline", "polygon":
+			v := svgNumbers(attr["points"])
+			p := Path{}
+			for i := 0; i+1 < len(v); i += 2 {
+				p = append(p, Point{v[i], v[i+1]})
+			}
+			if el.Name.Local == "polygon" && len(p) > 2 {
+				addLoop(p)
+			} else if len(p) > 1 {
+				for i := range p {
+					p[i] = m.apply(p[i])
+				}
+				open = append(open, p)
+			}
+		}
+	}
+
+	loops, rest := Chain(open, joinTolerance)
+	d.Loops = append(d.Loops, loops...)
+	d.Open = rest
+	for i, l := range d.Loops {
+		// the Y flip of the page reverses the winding, restore counter clockwise outlines
+		if l.Area() < 0 {
+			d.Loops[i] = l.Reverse()
+		}
+	}
+	return d, nil
+}
+
+// svgViewport returns the transform from the root viewBox to mm with Y pointing up
+func svgViewport(attr map[string]string) matrix {
+	vb := svgNumbers(attr["viewBox"])
+	w, wok := svgLength(attr["width"])
+	h, hok := svgLength(attr["height"])
+	if len(vb) != 4 || vb[2] <= 0 || vb[3] <= 0 {
+		// without a viewBox user units are pixels
+		px := svgUnits["px"]
+		if !hok {
+			h = 0
+		}
+		return matrix{px, 0, 0, -px, 0, h}
+	}
+	sx, sy := svgUnits["px"], svgUnits["px"]
+	if wok && w > 0 {
+		sx = w / vb[2]
+	}
+	if hok && h > 0 {
+		sy = h / vb[3]
+	}
+	if !wok && hok {
+		sx = sy
+	} else if wok && !hok {
+		sy = sx
+	}
+	return matrix{sx, 0, 0, -sy, -vb[0] * sx, (vb[1] + vb[3]) * sy}
+}
+
+// svgPath flattens path data through m into closed loops and open paths
+func svgPath(data string, m matrix) ([]Path, []Path, error) {
+	loops, open := []Path{}, []Path{}
+	toks := regexp.MustCompile(`[MmLlHhVvCcSsQqTtAaZz]|[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?`).FindAllString(data, -1)
+	i := 0
+	number := func() (float64, error) {
+		if i >= len(toks) {
+			return 0, fmt.Errorf("path data ends early")
+		}
+		v, err := strconv.ParseFloat(toks[i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad path data near %q", toks[i])
+		}
+		i++
+		return v, nil
+	}
+	isNumber := func() bool {
+		return i < len(toks) && !strings.ContainsAny(toks[i][:1], "MmLlHhVvCcSsQqTtAaZz")
+	}
+	tol := ArcTolerance / math.Max(m.scale(), 1e-9)
+
+	var cur, start, ctrl Point
+	var lastCmd byte
+	sub := Path{}
+	flush := func(closed bool) {
+		if closed && len(sub) > 2 {
+			if sub[0].Dist(sub[len(sub)-1]) < 1e-9 {
+				sub = sub[:len(sub)-1]
+			}
+			loops = append(loops, sub)
+		} else if len(sub) > 1 {
+			open = append(open, sub)
+		}
+		sub = Path{}
+	}
+	lineTo := func(p Point) {
+		if len(sub) == 0 {
+			sub = append(sub, m.apply(cur))
+		}
+		sub = append(sub, m.apply(p))
+		cur = p
+	}
+	var cmd byte
+	for i < len(toks) {
+		if !isNumber() {
+			cmd = toks[i][0]
+			i++
+		} else if cmd == 0 {
+			return nil, nil, fmt.Errorf("path data must start with a command")
+		}
+		rel := cmd >= 'a'
+		base := Point{}
+		if rel {
+			base = cur
+		}
+		pt := func() (Point, error) {
+			x, err := number()
+			if err != nil {
+				return Point{}, err
+			}
+			y, err := number()
+			return Point{base.X + x, base.Y + y}, err
+		}
+		var err error
+		switch cmd {
+		case 'M', 'm':
+			flush(false)
+			if cur, err = pt(); err != nil {
+				return nil, nil, err
+			}
+			start = cur
+			// further pairs are implicit line commands
+			if rel {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		case 'L', 'l':
+			p, err := pt()
+			if err != nil {
+				return nil, nil, err
+			}
+			lineTo(p)
+		case 'H', 'h':
+			x, err := number()
+			if err != nil {
+				return nil, nil, err
+			}
+			lineTo(Point{base.X + x, cur.Y})
+		case 'V', 'v':
+			y, err := number()
+			if err != nil {
+				return nil, nil, err
+			}
+			lineTo(Point{cur.X, base.Y + y})
+		case 'C', 'c', 'S', 's', 'Q', 'q', 'T', 't':
+			var c1, c2, p Point
+			upper := cmd &^ 0x20
+			// smooth curves reflect the previous control point when the previous segment was the same kind
+			reflect := cur.Add(cur.Sub(ctrl))
+			if !(upper == 'S' && (lastCmd == 'C' || lastCmd == 'S')) && !(upper == 'T' && (lastCmd == 'Q' || lastCmd == 'T')) {
+				reflect = cur
+			}
+			switch upper {
+			case 'C':
+				if c1, err = pt(); err == nil {
+					if c2, err = pt(); err == nil {
+						p, err = pt()
+					}
+				}
+			case 'S':
+				c1 = reflect
+				if c2, err = pt(); err == nil {
+					p, err = pt()
+				}
+			case 'Q':
+				if c1, err = pt(); err == nil {
+					p, err = pt()
+				}
+				c2 = c1
+			case 'T':
+				c1 = reflect
+				c2 = c1
+				p, err = pt()
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			q0, q3 := m.apply(cur), m.apply(p)
+			var q1, q2 Point
+			if upper == 'Q' || upper == 'T' {
+				// raise the quadratic to a cubic
+				q1 = q0.Add(m.apply(c1).Sub(q0).Scale(2.0 / 3))
+				q2 = q3.Add(m.apply(c1).Sub(q3).Scale(2.0 / 3))
+			} else {
+				q1, q2 = m.apply(c1), m.apply(c2)
+			}
+			if len(sub) == 0 {
+				sub = append(sub, q0)
+			}
+			sub = append(sub, bezier(q0, q1, q2, q3, ArcTolerance)[1:]...)
+			ctrl = c2
+			cur = p
+		case 'A', 'a':
+			v := [5]float64{}
+			for k := range v {
+				if v[k], err = number(); err != nil {
+					return nil, nil, err
+				}
+			}
+			p, err := pt()
+			if err != nil {
+				return nil, nil, err
+			}
+			arc := svgArc(cur, p, v[0], v[1], v[2], v[3] != 0, v[4] != 0, tol)
+			for _, a := range arc[1:] {
+				lineTo(a)
+			}
+			cur = p
+		case 'Z', 'z':
+			if len(sub) > 0 {
+				sub = append(sub, m.apply(start))
+			}
+			flush(true)
+			cur = start
+		default:
+			return nil, nil, fmt.Errorf("unknown path command %q", cmd)
+		}
+		lastCmd = cmd &^ 0x20
+		if lastCmd != 'C' && lastCmd != 'S' && lastCmd != 'Q' && lastCmd != 'T' {
+			ctrl = cur
+		}
+	}
+	flush(false)
+	return loops, open, nil
+}
+
+// bezier flattens a cubic curve so the chords stay within about tol of it
+func bezier(p0, p1, p2, p3 Point, tol float64) Path {
+	// the second differences bound the deviation of a chord from the curve
+	dd := math.Max(p0.Sub(p1.Scale(2)).Add(p2).Len(), p1.Sub(p2.Scale(2)).Add(p3).Len())
+	n := int(math.Ceil(math.Sqrt(3 * dd / (4 * tol))))
+	n = max(1, min(n, 500))
+	out := Path{}
+	for i := 0; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		out = append(out, p0.Scale(u*u*u).Add(p1.Scale(3*u*u*t)).Add(p2.Scale(3*u*t*t)).Add(p3.Scale(t*t*t)))
+	}
+	return out
+}
+
+// svgArc flattens an SVG elliptical arc from a to b, converting from the endpoint form to the
+// centre form as described in the SVG implementation notes
+func svgArc(a, b Point, rx, ry, rotation float64, large, sweep bool, tol float64) Path {
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || a.Dist(b) < 1e-12 {
+		return Path{a, b}
+	}
+	phi := rotation * math.Pi / 180
+	cos, sin := math.Cos(phi), math.Sin(phi)
+	dx, dy := (a.X-b.X)/2, (a.Y-b.Y)/2
+	x1 := cos*dx + sin*dy
+	y1 := -sin*dx + cos*dy
+	// scale up radii that are too small to span the endpoints
+	if l := x1*x1/(rx*rx) + y1*y1/(ry*ry); l > 1 {
+		rx, ry = rx*math.Sqrt(l), ry*math.Sqrt(l)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	k := math.Sqrt(math.Max(0, num/den))
+	if large == sweep {
+		k = -k
+	}
+	cx1, cy1 := k*rx*y1/ry, -k*ry*x1/rx
+	c := Point{cos*cx1 - sin*cy1 + (a.X+b.X)/2, sin*cx1 + cos*cy1 + (a.Y+b.Y)/2}
+	angle := func(ux, uy float64) float64 { return math.Atan2(uy, ux) }
+	t0 := angle((x1-cx1)/rx, (y1-cy1)/ry)
+	dt := angle((-x1-cx1)/rx, (-y1-cy1)/ry) - t0
+	if sweep && dt < 0 {
+		dt += 2 * math.Pi
+	} else if !sweep && dt > 0 {
+		dt -= 2 * math.Pi
+	}
+	r := math.Max(rx, ry)
+	step := 2 * math.Acos(math.Max(-1, 1-tol/r))
+	n := max(1, int(math.Ceil(math.Abs(dt)/step)))
+	out := Path{a}
+	for i := 1; i < n; i++ {
+		t := t0 + dt*float64(i)/float64(n)
+		x, y := rx*math.Cos(t), ry*math.Sin(t)
+		out = append(out, Point{cos*x - sin*y + c.X, sin*x + cos*y + c.Y})
+	}
+	return append(out, b)
+}
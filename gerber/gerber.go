@@ -0,0 +1,481 @@
+package gerber
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// arcTolerance is the chord error used when flattening arcs and round apertures
+const arcTolerance = 0.005
+
+// Primitive is one piece of the image, either a stroked segment (a capsule of radius R from A
+// to B, a circle when A == B) or a polygon. Dark primitives add copper, clear ones remove it.
+type Primitive struct {
+	Dark bool
+	A, B geom.Point
+	R    float64
+	Poly geom.Path
+}
+
+// Bounds returns the bounding box of the primitive
+func (p Primitive) Bounds() geom.Rect {
+	if p.Poly != nil {
+		return p.Poly.Bounds()
+	}
+	r := geom.EmptyRect().Extend(p.A).Extend(p.B)
+	r.Min = r.Min.Sub(geom.Point{X: p.R, Y: p.R})
+	r.Max = r.Max.Add(geom.Point{X: p.R, Y: p.R})
+	return r
+}
+
+// Dist returns the signed distance from pt to the primitive, positive inside
+func (p Primitive) Dist(pt geom.Point) float64 {
+	if p.Poly != nil {
+		return geom.PolygonDist(pt, p.Poly)
+	}
+	return geom.CapsuleDist(pt, p.A, p.B, p.R)
+}
+
+// points returns the outline of the primitive for building swept hulls
+func (p Primitive) points() []geom.Point {
+	if p.Poly != nil {
+		return p.Poly
+	}
+	return append(geom.Circle(p.A, p.R, arcTolerance), geom.Circle(p.B, p.R, arcTolerance)...)
+}
+
+func (p Primitive) transform(angle float64, offset geom.Point) Primitive {
+	if p.Poly != nil {
+		p.Poly = p.Poly.Transform(angle, offset)
+		return p
+	}
+	p.A = geom.Path{p.A}.Transform(angle, offset)[0]
+	p.B = geom.Path{p.B}.Transform(angle, offset)[0]
+	return p
+}
+
+// Image is the flattened content of a Gerber layer in mm, primitives are in drawing order
+type Image struct {
+	Prims []Primitive
+}
+
+// Bounds returns the bounding box of the dark primitives
+func (img *Image) Bounds() geom.Rect {
+	r := geom.EmptyRect()
+	for _, p := range img.Prims {
+		if p.Dark {
+			r = r.Union(p.Bounds())
+		}
+	}
+	return r
+}
+
+// aperture is a set of primitives around the flash point
+type aperture []Primitive
+
+// parser holds the graphics state while reading a file
+type parser struct {
+	img       *Image
+	scale     float64 // file units to mm
+	intDigits int
+	decDigits int
+	trailing  bool // trailing zeros omitted (deprecated)
+	apertures map[int]aperture
+	macros    map[string]*macro
+	current   int
+	interp    int // 1 linear, 2 clockwise, 3 counter clockwise
+	single    bool
+	region    bool
+	contour   geom.Path
+	dark      bool
+	x, y      float64
+}
+
+var (
+	reCoord = regexp.MustCompile(`([XYIJ])([+-]?[\d.]+)`)
+	reD     = regexp.MustCompile(`D(\d+)$`)
+	reG     = regexp.MustCompile(`^G0*(\d+)`)
+)
+
+// ParseFile reads a Gerber RS-274X file
+func ParseFile(filePath string) (*Image, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+// Parse reads Gerber RS-274X data covering apertures (including macros), draws, arcs, flashes,
+// regions and polarity. Step and repeat and block apertures are not supported.
+func Parse(r io.Reader) (*Image, error) {
+	p := &parser{
+		img:       &Image{},
+		scale:     1,
+		intDigits: 3,
+		decDigits: 6,
+		apertures: map[int]aperture{},
+		macros:    map[string]*macro{},
+		interp:    1,
+		dark:      true,
+	}
+
+	reader := bufio.NewReader(r)
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	text := string(data)
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '%':
+			end := strings.IndexByte(text[i+1:], '%')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated extended command")
+			}
+			if err := p.extended(text[i+1 : i+1+end]); err != nil {
+				return nil, err
+			}
+			i += end + 2
+		case c == '\r' || c == '\n' || c == ' ' || c == '\t':
+			i++
+		default:
+			end := strings.IndexByte(text[i:], '*')
+			if end < 0 {
+				end = len(text) - i
+			}
+			word := strings.Join(strings.Fields(text[i:i+end]), "")
+			i += end + 1
+			done, err := p.word(word)
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				return p.img, nil
+			}
+		}
+	}
+	return p.img, nil
+}
+
+// extended handles the contents of a %...% block
+func (p *parser) extended(block string) error {
+	block = strings.Join(strings.Fields(block), "")
+	switch {
+	case strings.HasPrefix(block, "AM"):
+		parts := strings.Split(strings.TrimSuffix(block, "*"), "*")
+		m, err := parseMacro(parts[1:])
+		if err != nil {
+			return fmt.Errorf("macro %s: %v", parts[0][2:], err)
+		}
+		p.macros[parts[0][2:]] = m
+		return nil
+	case strings.HasPrefix(block, "SRX") && !strings.HasPrefix(block, "SRX1Y1"), strings.HasPrefix(block, "AB"):
+		return fmt.Errorf("unsupported command %q", block)
+	}
+	for _, cmd := range strings.Split(block, "*") {
+		switch {
+		case cmd == "":
+		case strings.HasPrefix(cmd, "FS"):
+			// e.g. FSLAX26Y26
+			p.trailing = strings.Contains(cmd, "T")
+			i := strings.IndexByte(cmd, 'X')
+			if i < 0 || i+2 >= len(cmd) {
+				return fmt.Errorf("bad format %q", cmd)
+			}
+			p.intDigits, _ = strconv.Atoi(cmd[i+1 : i+2])
+			p.decDigits, _ = strconv.Atoi(cmd[i+2 : i+3])
+		case cmd == "MOMM":
+			p.scale = 1
+		case cmd == "MOIN":
+			p.scale = 25.4
+		case cmd == "LPD":
+			p.dark = true
+		case cmd == "LPC":
+			p.dark = false
+		case strings.HasPrefix(cmd, "AD"):
+			if err := p.defineAperture(cmd[2:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defineAperture handles an ADD command, e.g. D10C,0.5 or D11RoundRect,0.1X0.2
+func (p *parser) defineAperture(def string) error {
+	i := 1
+	for i < len(def) && def[i] >= '0' && def[i] <= '9' {
+		i++
+	}
+	code, err := strconv.Atoi(def[1:i])
+	if err != nil {
+		return fmt.Errorf("bad aperture %q", def)
+	}
+	name, args := def[i:], []float64{}
+	if j := strings.IndexByte(name, ','); j >= 0 {
+		for _, a := range strings.Split(name[j+1:], "X") {
+			v, err := strconv.ParseFloat(a, 64)
+			if err != nil {
+				return fmt.Errorf("bad aperture %q", def)
+			}
+			args = append(args, v)
+		}
+		name = name[:j]
+	}
+	raw := func(k int) float64 {
+		if k < len(args) {
+			return args[k]
+		}
+		return 0
+	}
+	arg := func(k int) float64 { return raw(k) * p.scale }
+	o := geom.Point{}
+	var ap aperture
+	switch name {
+	case "C":
+		ap = aperture{{Dark: true, R: arg(0) / 2}}
+	case "R":
+		w, h := arg(0)/2, arg(1)/2
+		ap = aperture{{Dark: true, Poly: geom.Path{{X: -w, Y: -h}, {X: w, Y: -h}, {X: w, Y: h}, {X: -w, Y: h}}}}
+	case "O":
+		w, h := arg(0), arg(1)
+		if w > h {
+			ap = aperture{{Dark: true, A: geom.Point{X: -(w - h) / 2}, B: geom.Point{X: (w - h) / 2}, R: h / 2}}
+		} else {
+			ap = aperture{{Dark: true, A: geom.Point{Y: -(h - w) / 2}, B: geom.Point{Y: (h - w) / 2}, R: w / 2}}
+		}
+	case "P":
+		n := int(raw(1))
+		if n < 3 {
+			return fmt.Errorf("polygon aperture needs at least 3 vertices")
+		}
+		ap = aperture{{Dark: true, Poly: regularPolygon(o, arg(0)/2, n, raw(2))}}
+	default:
+		m, ok := p.macros[name]
+		if !ok {
+			return fmt.Errorf("undefined aperture macro %q", name)
+		}
+		var err error
+		if ap, err = m.eval(args, p.scale); err != nil {
+			return fmt.Errorf("macro %s: %v", name, err)
+		}
+	}
+	p.apertures[code] = ap
+	return nil
+}
+
+func regularPolygon(c geom.Point, r float64, n int, rotation float64) geom.Path {
+	out := geom.Path{}
+	for i := 0; i < n; i++ {
+		a := (rotation + 360*float64(i)/float64(n)) * math.Pi / 180
+		out = append(out, geom.Point{X: c.X + r*math.Cos(a), Y: c.Y + r*math.Sin(a)})
+	}
+	return out
+}
+
+// coord converts a coordinate word value to mm
+func (p *parser) coord(s string) float64 {
+	if strings.Contains(s, ".") {
+		v, _ := strconv.ParseFloat(s, 64)
+		return v * p.scale
+	}
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	if p.trailing {
+		for len(s) < p.intDigits+p.decDigits {
+			s += "0"
+		}
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	v /= math.Pow(10, float64(p.decDigits))
+	if neg {
+		v = -v
+	}
+	return v * p.scale
+}
+
+// word handles a normal command, returning true at the end of the file
+func (p *parser) word(w string) (bool, error) {
+	if w == "" {
+		return false, nil
+	}
+	if w == "M02" || w == "M00" || w == "M2" {
+		p.closeContour()
+		return true, nil
+	}
+	if m := reG.FindStringSubmatch(w); m != nil {
+		switch m[1] {
+		case "4":
+			// comment
+			return false, nil
+		case "1", "2", "3":
+			p.interp, _ = strconv.Atoi(m[1])
+		case "36":
+			p.region, p.contour = true, nil
+		case "37":
+			p.closeContour()
+			p.region = false
+		case "74":
+			p.single = true
+		case "75":
+			p.single = false
+		case "70":
+			p.scale = 25.4
+		case "71":
+			p.scale = 1
+		}
+		w = w[len(m[0]):]
+		if w == "" {
+			return false, nil
+		}
+	}
+
+	d := reD.FindStringSubmatch(w)
+	if d == nil {
+		// coordinates with no operation use the last one, which is deprecated but common
+		if !reCoord.MatchString(w) {
+			return false, nil
+		}
+		d = []string{"D01", "1"}
+	}
+	code, _ := strconv.Atoi(d[1])
+	if code >= 10 {
+		if _, ok := p.apertures[code]; !ok {
+			return false, fmt.Errorf("aperture D%d is not defined", code)
+		}
+		p.current = code
+		return false, nil
+	}
+
+	x, y := p.x, p.y
+	i, j := 0.0, 0.0
+	for _, m := range reCoord.FindAllStringSubmatch(w, -1) {
+		v := p.coord(m[2])
+		switch m[1] {
+		case "X":
+			x = v
+		case "Y":
+			y = v
+		case "I":
+			i = v
+		case "J":
+			j = v
+		}
+	}
+	from, to := geom.Point{X: p.x, Y: p.y}, geom.Point{X: x, Y: y}
+	p.x, p.y = x, y
+
+	switch code {
+	case 1:
+		path := geom.Path{from, to}
+		if p.interp != 1 {
+			path = p.arc(from, to, i, j)
+		}
+		if p.region {
+			if len(p.contour) == 0 {
+				p.contour = geom.Path{from}
+			}
+			p.contour = append(p.contour, path[1:]...)
+			return false, nil
+		}
+		p.stroke(path)
+	case 2:
+		if p.region {
+			p.closeContour()
+		}
+	case 3:
+		ap, ok := p.apertures[p.current]
+		if !ok {
+			return false, fmt.Errorf("flash with no aperture selected")
+		}
+		for _, prim := range ap {
+			prim = prim.transform(0, to)
+			prim.Dark = prim.Dark == p.dark
+			p.img.Prims = append(p.img.Prims, prim)
+		}
+	}
+	return false, nil
+}
+
+// arc flattens a circular interpolation from the current point
+func (p *parser) arc(from, to geom.Point, i, j float64) geom.Path {
+	cw := p.interp == 2
+	centre := geom.Point{X: from.X + i, Y: from.Y + j}
+	if p.single {
+		// offsets are unsigned, pick the centre that gives a quarter arc or less
+		best := math.Inf(1)
+		for _, s := range [][2]float64{{1, 1}, {-1, 1}, {1, -1}, {-1, -1}} {
+			c := geom.Point{X: from.X + s[0]*math.Abs(i), Y: from.Y + s[1]*math.Abs(j)}
+			sweep := sweepAngle(c, from, to, cw, false)
+			if err := math.Abs(c.Dist(from) - c.Dist(to)); math.Abs(sweep) <= math.Pi/2+1e-6 && err < best {
+				best, centre = err, c
+			}
+		}
+	}
+	r := centre.Dist(from)
+	a0 := math.Atan2(from.Y-centre.Y, from.X-centre.X)
+	arc := geom.Arc(centre, r, a0, sweepAngle(centre, from, to, cw, !p.single), arcTolerance)
+	arc[len(arc)-1] = to
+	return arc
+}
+
+// sweepAngle returns the signed sweep from 'from' to 'to' around c, a full turn when they meet and full is set
+func sweepAngle(c, from, to geom.Point, cw, full bool) float64 {
+	a0 := math.Atan2(from.Y-c.Y, from.X-c.X)
+	a1 := math.Atan2(to.Y-c.Y, to.X-c.X)
+	sweep := a1 - a0
+	if cw {
+		for sweep >= 0 {
+			sweep -= 2 * math.Pi
+		}
+		if sweep < -2*math.Pi+1e-9 && !full {
+			sweep = 0
+		}
+	} else {
+		for sweep <= 0 {
+			sweep += 2 * math.Pi
+		}
+		if sweep > 2*math.Pi-1e-9 && !full {
+			sweep = 0
+		}
+	}
+	return sweep
+}
+
+// stroke draws a path with the current aperture
+func (p *parser) stroke(path geom.Path) {
+	ap := p.apertures[p.current]
+	for k := 1; k < len(path); k++ {
+		a, b := path[k-1], path[k]
+		for _, prim := range ap {
+			var out Primitive
+			if prim.Poly == nil && prim.A == (geom.Point{}) && prim.B == (geom.Point{}) {
+				out = Primitive{A: a, B: b, R: prim.R}
+			} else {
+				// sweep any other shape as the hull of its start and end positions
+				pts := append(prim.transform(0, a).points(), prim.transform(0, b).points()...)
+				out = Primitive{Poly: geom.ConvexHull(pts)}
+			}
+			out.Dark = prim.Dark == p.dark
+			p.img.Prims = append(p.img.Prims, out)
+		}
+	}
+}
+
+// closeContour finishes the current region contour
+func (p *parser) closeContour() {
+	if len(p.contour) >= 3 {
+		p.img.Prims = append(p.img.Prims, Primitive{Dark: p.dark, Poly: p.contour})
+	}
+	p.contour = nil
+}
@@ -0,0 +1,128 @@
+package gerber
+
+import (
+	"fmt"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/util"
+)
+
+// IsolateParams configures isolation routing around the copper of an image
+type IsolateParams struct {
+	ToolWidth  float64 // width of the cut at depth
+	Passes     int
+	Overlap    float64 // percent of the tool width shared by neighbouring passes
+	Depth      float64 // positive depth below the copper surface at Z0
+	Feed       float64
+	PlungeFeed float64
+	Spindle    float64
+	SafeZ      float64
+	Climb      bool
+	Resolution float64 // grid spacing used to offset the copper
+}
+
+// DefaultIsolateParams returns settings for a 0.2mm V-bit
+func DefaultIsolateParams() IsolateParams {
+	return IsolateParams{
+		ToolWidth:  0.2,
+		Passes:     2,
+		Overlap:    25,
+		Depth:      0.05,
+		Feed:       200,
+		PlungeFeed: 50,
+		Spindle:    12000,
+		SafeZ:      2,
+		Climb:      true,
+		Resolution: 0.02,
+	}
+}
+
+// Validate checks the parameters
+func (p IsolateParams) Validate() error {
+	switch {
+	case p.ToolWidth <= 0:
+		return fmt.Errorf("tool width must be positive")
+	case p.Passes < 1:
+		return fmt.Errorf("at least one pass is needed")
+	case p.Overlap < 0 || p.Overlap >= 100:
+		return fmt.Errorf("overlap must be between 0 and 100 percent")
+	case p.Depth <= 0:
+		return fmt.Errorf("depth must be positive")
+	case p.Resolution <= 0:
+		return fmt.Errorf("resolution must be positive")
+	}
+	return nil
+}
+
+// offsets returns the distance from the copper to the tool centre for each pass, innermost first
+func (p IsolateParams) offsets() []float64 {
+	out := []float64{}
+	for i := 0; i < p.Passes; i++ {
+		out = append(out, p.ToolWidth/2+float64(i)*p.ToolWidth*(1-p.Overlap/100))
+	}
+	return out
+}
+
+// Field paints the image into a distance field reaching out to reach mm around the copper
+func (img *Image) Field(res, reach float64) *geom.DistanceField {
+	f := geom.NewEmptyField(img.Bounds(), res, reach)
+	for _, p := range img.Prims {
+		p := p
+		f.Paint(p.Bounds(), reach+res, p.Dark, p.Dist)
+	}
+	return f
+}
+
+// IsolationPaths returns the closed tool paths for every pass, innermost pass first
+func IsolationPaths(img *Image, p IsolateParams) ([][]geom.Path, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if img.Bounds().Empty() {
+		return nil, fmt.Errorf("no copper in the image")
+	}
+	offsets := p.offsets()
+	field := img.Field(p.Resolution, offsets[len(offsets)-1]+p.Resolution*2)
+	passes := [][]geom.Path{}
+	for _, d := range offsets {
+		loops := field.Contours(-d)
+		if p.Climb {
+			// contours run counter clockwise around the copper, climb milling an outside profile with M3 is clockwise
+			for i := range loops {
+				loops[i] = loops[i].Reverse()
+			}
+		}
+		passes = append(passes, loops)
+	}
+	return passes, nil
+}
+
+// Isolate returns G-code that cuts isolation passes around the copper
+func Isolate(img *Image, p IsolateParams) (util.Gcode, error) {
+	passes, err := IsolationPaths(img, p)
+	if err != nil {
+		return "", err
+	}
+	g := util.Gcode("")
+	g.G90Preamble()
+	g.Add("G0 Z%.3f ; Safe height", p.SafeZ)
+	g.Add("M3 S%.0f ; Start spindle", p.Spindle)
+	pos := geom.Point{}
+	for i, loops := range passes {
+		g.Add("; Isolation pass %d", i+1)
+		for _, loop := range geom.OrderPaths(loops, true, pos) {
+			g.Add("G0 X%.4f Y%.4f", loop[0].X, loop[0].Y)
+			g.Add("G1 Z%.4f F%.0f", -p.Depth, p.PlungeFeed)
+			g.Add("G1 F%.0f", p.Feed)
+			for _, pt := range loop[1:] {
+				g.Add("G1 X%.4f Y%.4f", pt.X, pt.Y)
+			}
+			g.Add("G1 X%.4f Y%.4f", loop[0].X, loop[0].Y)
+			g.Add("G0 Z%.3f", p.SafeZ)
+			pos = loop[0]
+		}
+	}
+	g.Add("M5 ; Stop spindle")
+	g.Add("M30 ; End program")
+	return g, nil
+}
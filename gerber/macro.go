@@ -0,0 +1,231 @@
+package gerber
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// macro is an aperture macro, a list of statements evaluated against the aperture arguments
+type macro struct {
+	statements []string
+}
+
+func parseMacro(statements []string) (*macro, error) {
+	m := &macro{}
+	for _, s := range statements {
+		// primitive 0 is a comment
+		if s == "" || strings.HasPrefix(s, "0") {
+			continue
+		}
+		m.statements = append(m.statements, s)
+	}
+	return m, nil
+}
+
+// eval expands the macro into primitives, args are the aperture parameters $1, $2...
+func (m *macro) eval(args []float64, scale float64) (aperture, error) {
+	vars := map[int]float64{}
+	for i, a := range args {
+		vars[i+1] = a
+	}
+	ap := aperture{}
+	for _, s := range m.statements {
+		if strings.HasPrefix(s, "$") {
+			eq := strings.IndexByte(s, '=')
+			if eq < 0 {
+				return nil, fmt.Errorf("bad statement %q", s)
+			}
+			n, err := strconv.Atoi(s[1:eq])
+			if err != nil {
+				return nil, fmt.Errorf("bad variable %q", s)
+			}
+			v, err := evalExpr(s[eq+1:], vars)
+			if err != nil {
+				return nil, err
+			}
+			vars[n] = v
+			continue
+		}
+		fields := strings.Split(s, ",")
+		vals := make([]float64, len(fields))
+		for i, f := range fields {
+			v, err := evalExpr(f, vars)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = v
+		}
+		prims, err := macroPrimitive(vals, scale)
+		if err != nil {
+			return nil, err
+		}
+		ap = append(ap, prims...)
+	}
+	return ap, nil
+}
+
+// macroPrimitive builds the primitive for one evaluated statement, lengths are scaled to mm
+func macroPrimitive(v []float64, scale float64) ([]Primitive, error) {
+	get := func(i int) float64 {
+		if i < len(v) {
+			return v[i]
+		}
+		return 0
+	}
+	code := int(get(0))
+	dark := get(1) != 0
+	deg := func(i int) float64 { return get(i) * math.Pi / 180 }
+	switch code {
+	case 1:
+		// circle: exposure, diameter, centre x, centre y, rotation
+		c := geom.Path{{X: get(3) * scale, Y: get(4) * scale}}.Transform(deg(5), geom.Point{})[0]
+		return []Primitive{{Dark: dark, A: c, B: c, R: get(2) * scale / 2}}, nil
+	case 2, 20:
+		// vector line: exposure, width, start x, start y, end x, end y, rotation
+		a := geom.Point{X: get(3) * scale, Y: get(4) * scale}
+		b := geom.Point{X: get(5) * scale, Y: get(6) * scale}
+		w := get(2) * scale / 2
+		d := b.Sub(a)
+		if l := d.Len(); l > 0 {
+			d = d.Scale(w / l)
+		}
+		n := geom.Point{X: -d.Y, Y: d.X}
+		poly := geom.Path{a.Add(n), a.Sub(n), b.Sub(n), b.Add(n)}
+		return []Primitive{{Dark: dark, Poly: poly.Transform(deg(7), geom.Point{})}}, nil
+	case 21:
+		// centre line: exposure, width, height, centre x, centre y, rotation
+		w, h := get(2)*scale/2, get(3)*scale/2
+		c := geom.Point{X: get(4) * scale, Y: get(5) * scale}
+		poly := geom.Path{{X: -w, Y: -h}, {X: w, Y: -h}, {X: w, Y: h}, {X: -w, Y: h}}.Transform(0, c)
+		return []Primitive{{Dark: dark, Poly: poly.Transform(deg(6), geom.Point{})}}, nil
+	case 4:
+		// outline: exposure, vertex count, x0, y0 ... xn, yn, rotation
+		n := int(get(2))
+		poly := geom.Path{}
+		for i := 0; i <= n; i++ {
+			poly = append(poly, geom.Point{X: get(3+2*i) * scale, Y: get(4+2*i) * scale})
+		}
+		if len(poly) > 1 && poly[0] == poly[len(poly)-1] {
+			poly = poly[:len(poly)-1]
+		}
+		return []Primitive{{Dark: dark, Poly: poly.Transform(deg(5+2*n), geom.Point{})}}, nil
+	case 5:
+		// polygon: exposure, vertex count, centre x, centre y, diameter, rotation
+		c := geom.Point{X: get(3) * scale, Y: get(4) * scale}
+		poly := regularPolygon(c, get(5)*scale/2, int(get(2)), 0)
+		return []Primitive{{Dark: dark, Poly: poly.Transform(deg(6), geom.Point{})}}, nil
+	case 7:
+		// thermal: centre x, centre y, outer diameter, inner diameter, gap, rotation. The gaps are
+		// ignored so the thermal is treated as a solid ring, which isolates it conservatively.
+		c := geom.Point{X: get(1) * scale, Y: get(2) * scale}
+		c = geom.Path{c}.Transform(deg(6), geom.Point{})[0]
+		return []Primitive{
+			{Dark: true, A: c, B: c, R: get(3) * scale / 2},
+			{Dark: false, A: c, B: c, R: get(4) * scale / 2},
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported macro primitive %d", code)
+}
+
+// evalExpr evaluates a macro arithmetic expression with +, -, x (or X), / and parentheses
+func evalExpr(s string, vars map[int]float64) (float64, error) {
+	e := &exprParser{s: strings.ReplaceAll(s, " ", ""), vars: vars}
+	v, err := e.sum()
+	if err != nil {
+		return 0, err
+	}
+	if e.i != len(e.s) {
+		return 0, fmt.Errorf("bad expression %q", s)
+	}
+	return v, nil
+}
+
+type exprParser struct {
+	s    string
+	i    int
+	vars map[int]float64
+}
+
+func (e *exprParser) peek() byte {
+	if e.i < len(e.s) {
+		return e.s[e.i]
+	}
+	return 0
+}
+
+func (e *exprParser) sum() (float64, error) {
+	v, err := e.product()
+	for err == nil && (e.peek() == '+' || e.peek() == '-') {
+		op := e.peek()
+		e.i++
+		var r float64
+		if r, err = e.product(); op == '+' {
+			v += r
+		} else {
+			v -= r
+		}
+	}
+	return v, err
+}
+
+func (e *exprParser) product() (float64, error) {
+	v, err := e.unary()
+	for err == nil && (e.peek() == 'x' || e.peek() == 'X' || e.peek() == '/') {
+		op := e.peek()
+		e.i++
+		var r float64
+		if r, err = e.unary(); op == '/' {
+			v /= r
+		} else {
+			v *= r
+		}
+	}
+	return v, err
+}
+
+func (e *exprParser) unary() (float64, error) {
+	switch e.peek() {
+	case '-':
+		e.i++
+		v, err := e.unary()
+		return -v, err
+	case '+':
+		e.i++
+		return e.unary()
+	case '(':
+		e.i++
+		v, err := e.sum()
+		if err != nil {
+			return 0, err
+		}
+		if e.peek() != ')' {
+			return 0, fmt.Errorf("missing ) in %q", e.s)
+		}
+		e.i++
+		return v, nil
+	case '$':
+		e.i++
+		start := e.i
+		for e.i < len(e.s) && e.s[e.i] >= '0' && e.s[e.i] <= '9' {
+			e.i++
+		}
+		n, err := strconv.Atoi(e.s[start:e.i])
+		if err != nil {
+			return 0, fmt.Errorf("bad variable in %q", e.s)
+		}
+		return e.vars[n], nil
+	}
+	start := e.i
+	for e.i < len(e.s) && (e.s[e.i] >= '0' && e.s[e.i] <= '9' || e.s[e.i] == '.') {
+		e.i++
+	}
+	v, err := strconv.ParseFloat(e.s[start:e.i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad number in %q", e.s)
+	}
+	return v, nil
+}
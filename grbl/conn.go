@@ -0,0 +1,209 @@
+package grbl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timeout is how long Command waits for the controller to answer
+var Timeout = 10 * time.Second
+
+// Conn is a line based connection to a GRBL style controller
+type Conn struct {
+	rw   io.ReadWriteCloser
+	r    *bufio.Reader
+	Echo io.Writer // when set, traffic is copied here
+}
+
+// Dial connects to a controller. An address with a port, like 192.168.1.20:23, is a telnet
+// style TCP connection as FluidNC and grblHAL offer, anything else is a serial device that is
+// set to baud with stty, on Linux only.
+func Dial(addr string, baud int) (*Conn, error) {
+	var rw io.ReadWriteCloser
+	if _, _, err := net.SplitHostPort(addr); err == nil && !strings.HasPrefix(addr, "/") {
+		c, err := net.DialTimeout("tcp", addr, Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+		}
+		rw = c
+	} else {
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("serial device %s can only be set up on Linux, give the controller as host:port", addr)
+		}
+		if err := exec.Command("stty", "-F", addr, strconv.Itoa(baud), "raw", "-echo", "-hupcl").Run(); err != nil {
+			return nil, fmt.Errorf("failed to set up %s: %v", addr, err)
+		}
+		f, err := os.OpenFile(addr, os.O_RDWR, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", addr, err)
+		}
+		rw = f
+	}
+	c := &Conn{rw: rw, r: bufio.NewReader(rw)}
+	// wake the controller and drop the greeting
+	if _, err := rw.Write([]byte("\r\n\r\n")); err != nil {
+		rw.Close()
+		return nil, err
+	}
+	time.Sleep(2 * time.Second)
+	c.drain()
+	return c, nil
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.rw.Close()
+}
+
+// deadline sets a read deadline when the connection supports one
+func (c *Conn) deadline(t time.Time) {
+	if d, ok := c.rw.(interface{ SetReadDeadline(time.Time) error }); ok {
+		d.SetReadDeadline(t)
+	}
+}
+
+// drain throws away whatever the controller has already sent
+func (c *Conn) drain() {
+	c.deadline(time.Now().Add(100 * time.Millisecond))
+	for {
+		if _, err := c.r.ReadString('\n'); err != nil {
+			break
+		}
+	}
+	c.deadline(time.Time{})
+	c.r.Reset(c.rw)
+}
+
+// Command sends a line and returns the lines the controller answers with before ok. An
+// error: or ALARM: answer is returned as an error.
+func (c *Conn) Command(line string) ([]string, error) {
+	if c.Echo != nil {
+		fmt.Fprintf(c.Echo, "> %s\n", line)
+	}
+	if _, err := c.rw.Write([]byte(line + "\n")); err != nil {
+		return nil, fmt.Errorf("failed to send %q: %v", line, err)
+	}
+	return c.wait(Timeout)
+}
+
+// wait reads answer lines until ok or an error
+func (c *Conn) wait(timeout time.Duration) ([]string, error) {
+	out := []string{}
+	c.deadline(time.Now().Add(timeout))
+	defer c.deadline(time.Time{})
+	for {
+		s, err := c.r.ReadString('\n')
+		if err != nil {
+			return out, fmt.Errorf("no answer from the controller: %v", err)
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if c.Echo != nil {
+			fmt.Fprintf(c.Echo, "< %s\n", s)
+		}
+		switch {
+		case s == "ok":
+			return out, nil
+		case strings.HasPrefix(s, "error:"), strings.HasPrefix(s, "ALARM:"):
+			return out, fmt.Errorf("controller answered %s", s)
+		}
+		out = append(out, s)
+	}
+}
+
+// Settings reads the $ settings from the controller
+func (c *Conn) Settings() (Settings, error) {
+	lines, err := c.Command("$$")
+	if err != nil {
+		return nil, err
+	}
+	return ParseSettings(strings.NewReader(strings.Join(lines, "\n")))
+}
+
+// Set changes a $ setting
+func (c *Conn) Set(n int, v float64) error {
+	_, err := c.Command(fmt.Sprintf("$%d=%.3f", n, v))
+	return err
+}
+
+// ProbeResult finds the [PRB:x,y,z:1] report in answer lines and returns the machine position
+// the probe triggered at
+func ProbeResult(lines []string) ([]float64, error) {
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "[PRB:") {
+			continue
+		}
+		body := strings.TrimSuffix(strings.TrimPrefix(l, "[PRB:"), "]")
+		coords, state, _ := strings.Cut(body, ":")
+		if state != "1" {
+			return nil, fmt.Errorf("probe did not trigger")
+		}
+		pos := []float64{}
+		for _, v := range strings.Split(coords, ",") {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad probe report %q", l)
+			}
+			pos = append(pos, f)
+		}
+		return pos, nil
+	}
+	return nil, fmt.Errorf("no probe report")
+}
+
+// Offsets reads the coordinate offsets with $#, keyed by name like G54, G92 and TLO
+func (c *Conn) Offsets() (map[string][]float64, error) {
+	lines, err := c.Command("$#")
+	if err != nil {
+		return nil, err
+	}
+	out := map[string][]float64{}
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "[") || strings.HasPrefix(l, "[PRB:") {
+			continue
+		}
+		name, values, ok := strings.Cut(strings.Trim(l, "[]"), ":")
+		if !ok {
+			continue
+		}
+		v := []float64{}
+		for _, s := range strings.Split(values, ",") {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad offset report %q", l)
+			}
+			v = append(v, f)
+		}
+		out[name] = v
+	}
+	return out, nil
+}
+
+// CoordinateSystem returns the active work coordinate system, G54 to G59, from the $G report
+func (c *Conn) CoordinateSystem() (string, error) {
+	lines, err := c.Command("$G")
+	if err != nil {
+		return "", err
+	}
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "[GC:") {
+			continue
+		}
+		for _, w := range strings.Fields(strings.Trim(l[4:], "]")) {
+			if len(w) == 3 && w >= "G54" && w <= "G59" {
+				return w, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no parser state report")
+}
@@ -0,0 +1,96 @@
+package grbl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// steps per mm settings, $100 for X and on through the axes
+const (
+	StepsX = 100
+	StepsY = 101
+	StepsZ = 102
+)
+
+// Settings holds numbered $ settings
+type Settings map[int]float64
+
+// ParseSettings reads a $$ dump. Lines that are not settings, like ok and comments, are skipped.
+func ParseSettings(r io.Reader) (Settings, error) {
+	s := Settings{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if n, v, ok := parseSetting(scanner.Text()); ok {
+			s[n] = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading settings: %v", err)
+	}
+	if len(s) == 0 {
+		return nil, fmt.Errorf("no $ settings found")
+	}
+	return s, nil
+}
+
+// LoadSettings reads a $$ dump from a file
+func LoadSettings(path string) (Settings, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open settings: %v", err)
+	}
+	defer f.Close()
+	return ParseSettings(f)
+}
+
+// parseSetting parses a line like $100=80.000 (x, step/mm)
+func parseSetting(line string) (int, float64, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "$") {
+		return 0, 0, false
+	}
+	key, val, ok := strings.Cut(line[1:], "=")
+	if !ok {
+		return 0, 0, false
+	}
+	if i := strings.IndexAny(val, " ;("); i >= 0 {
+		val = val[:i]
+	}
+	n, err := strconv.Atoi(key)
+	if err != nil {
+		return 0, 0, false
+	}
+	v, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return n, v, true
+}
+
+// AxisSetting returns the setting for an axis, base plus 0 for X, 1 for Y, 2 for Z and so on
+func AxisSetting(base int, axis byte) (int, error) {
+	i := strings.IndexByte("XYZABC", axis&^0x20)
+	if i < 0 {
+		return 0, fmt.Errorf("unknown axis %q", axis)
+	}
+	return base + i, nil
+}
+
+// Lines formats settings as $n=v lines, in order
+func (s Settings) Lines() []string {
+	keys := []int{}
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	out := []string{}
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("$%d=%.3f", k, s[k]))
+	}
+	return out
+}
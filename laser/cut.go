@@ -0,0 +1,192 @@
+package laser
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/util"
+)
+
+// CutParams configures multi pass vector cutting. Power, Feed and Air hold one value per pass,
+// the last value is repeated when there are more passes than values.
+type CutParams struct {
+	Passes     int
+	Power      []float64
+	Feed       []float64
+	StepDown   float64 // Z descent between passes, follows the focus into the cut
+	FocusZ     float64 // Z of the first pass, 0 leaves Z alone and needs no step down
+	Air        []bool  // air assist per pass
+	AirCode    string  // M7 or M8, empty for no air assist
+	Kerf       float64 // closed contours are grown by half the kerf so parts come out on size
+	Resolution float64 // grid spacing used for the kerf offset
+}
+
+// DefaultCutParams returns a single full power pass with no air assist
+func DefaultCutParams() CutParams {
+	return CutParams{
+		Passes:     1,
+		Power:      []float64{1000},
+		Feed:       []float64{300},
+		Air:        []bool{true},
+		Resolution: 0.02,
+	}
+}
+
+// Apply takes the passes, power, feed, step down and air assist from a material preset
+func (p *CutParams) Apply(m Material) {
+	p.Passes = m.Passes
+	p.Power = m.Power
+	p.Feed = m.Feed
+	p.StepDown = m.StepDown
+	p.AirCode = m.Air
+	p.Air = []bool{true}
+}
+
+// Validate checks the parameters
+func (p CutParams) Validate() error {
+	switch {
+	case p.Passes < 1:
+		return fmt.Errorf("at least one pass is needed")
+	case len(p.Power) == 0 || len(p.Feed) == 0:
+		return fmt.Errorf("power and feed need at least one value")
+	case p.StepDown < 0:
+		return fmt.Errorf("step down can not be negative")
+	case p.StepDown > 0 && p.FocusZ == 0:
+		// Z0 is the laser touching the work, stepping down from it drives the head into the stock
+		return fmt.Errorf("step down needs the focus Z, set it with cnctools laser focus or --focus-z")
+	case p.StepDown > 0 && p.FocusZ-float64(p.Passes-1)*p.StepDown <= 0:
+		return fmt.Errorf("the last pass at Z%.3f would touch the work", p.FocusZ-float64(p.Passes-1)*p.StepDown)
+	case p.AirCode != "" && p.AirCode != "M7" && p.AirCode != "M8":
+		return fmt.Errorf("air assist must be M7 or M8, not %q", p.AirCode)
+	case p.Kerf < 0:
+		return fmt.Errorf("kerf can not be negative")
+	case p.Kerf > 0 && p.Resolution <= 0:
+		return fmt.Errorf("resolution must be positive")
+	}
+	for _, f := range p.Feed {
+		if f <= 0 {
+			return fmt.Errorf("feed rates must be positive")
+		}
+	}
+	return nil
+}
+
+// perPass returns the value for pass i, repeating the last one
+func perPass(vals []float64, i int) float64 {
+	return vals[min(i, len(vals)-1)]
+}
+
+// airOn reports whether air assist runs during pass i
+func (p CutParams) airOn(i int) bool {
+	return p.AirCode != "" && len(p.Air) > 0 && p.Air[min(i, len(p.Air)-1)]
+}
+
+// CutPaths returns the open paths and the kerf compensated closed contours of a drawing in
+// cutting order. Contours inside other contours come first so holes are cut before the part
+// around them drops out.
+func CutPaths(d *geom.Drawing, p CutParams) ([]geom.Path, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	loops := d.Loops
+	if p.Kerf > 0 && len(loops) > 0 {
+		field := geom.NewBandedField(geom.Nest(loops), p.Resolution, p.Kerf)
+		loops = field.Contours(-p.Kerf / 2)
+		for i := range loops {
+			loops[i] = loops[i].SimplifyClosed(p.Resolution / 4)
+		}
+	}
+	if len(loops)+len(d.Open) == 0 {
+		return nil, fmt.Errorf("nothing to cut in the drawing")
+	}
+
+	depth := make([]int, len(loops))
+	for i, l := range loops {
+		for k, o := range loops {
+			if k != i && o.Contains(l[0]) {
+				depth[i]++
+			}
+		}
+	}
+	levels := map[int][]geom.Path{}
+	for i, l := range loops {
+		levels[depth[i]] = append(levels[depth[i]], l)
+	}
+	order := []int{}
+	for k := range levels {
+		order = append(order, k)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(order)))
+
+	out := geom.OrderPaths(d.Open, false, geom.Point{})
+	pos := geom.Point{}
+	if len(out) > 0 {
+		last := out[len(out)-1]
+		pos = last[len(last)-1]
+	}
+	for _, k := range order {
+		for _, l := range geom.OrderPaths(levels[k], true, pos) {
+			out = append(out, l.Closed())
+			pos = l[0]
+		}
+	}
+	return out, nil
+}
+
+// CutPasses writes the passes over paths, from the first laser move to the last, so it can be
+// embedded in another program
+func CutPasses(g *util.Gcode, paths []geom.Path, p CutParams) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	air := false
+	for pass := 0; pass < p.Passes; pass++ {
+		power, feed := perPass(p.Power, pass), perPass(p.Feed, pass)
+		z := p.FocusZ - float64(pass)*p.StepDown
+		g.Add("; Pass %d of %d, S%.0f F%.0f", pass+1, p.Passes, power, feed)
+		if p.FocusZ != 0 || p.StepDown > 0 {
+			g.Add("G0 Z%.3f", z)
+		}
+		if on := p.airOn(pass); on != air {
+			if on {
+				g.Add("%s ; Air assist on", p.AirCode)
+			} else {
+				g.Add("M9 ; Air assist off")
+			}
+			air = on
+		}
+		for _, path := range paths {
+			g.Add("G0 X%.3f Y%.3f", path[0].X, path[0].Y)
+			g.Add("M3 S%.0f ; Laser on", power)
+			g.Add("G1 F%.0f", feed)
+			for _, pt := range path[1:] {
+				g.Add("G1 X%.3f Y%.3f", pt.X, pt.Y)
+			}
+			g.Add("M5 ; Laser off")
+		}
+	}
+	if air {
+		g.Add("M9 ; Air assist off")
+	}
+	return nil
+}
+
+// Cut returns a program that cuts a drawing in as many passes as set
+func Cut(d *geom.Drawing, p CutParams) (util.Gcode, error) {
+	paths, err := CutPaths(d, p)
+	if err != nil {
+		return "", err
+	}
+	g := util.Gcode("")
+	g.G90Preamble()
+	if err := CutPasses(&g, paths, p); err != nil {
+		return "", err
+	}
+	if p.FocusZ != 0 || p.StepDown > 0 {
+		g.Add("G0 Z%.3f", p.FocusZ)
+	}
+	g.Add("G0 X0 Y0")
+	g.Add("M30 ; End program")
+	return g, nil
+}
@@ -0,0 +1,57 @@
+package laser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// square is a drawing of one 10mm square
+func square() *geom.Drawing {
+	return &geom.Drawing{Loops: []geom.Path{{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}}}}
+}
+
+// zMoves returns the Z moves of a program
+func zMoves(g string) []string {
+	out := []string{}
+	for _, l := range strings.Split(g, "\n") {
+		if strings.HasPrefix(l, "G0 Z") {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func TestCutStepDown(t *testing.T) {
+	p := DefaultCutParams()
+	p.Passes, p.StepDown = 3, 1
+
+	// without a focus Z the passes would step down from the work surface into the stock
+	if _, err := Cut(square(), p); err == nil {
+		t.Error("step down without a focus Z was accepted")
+	}
+
+	p.FocusZ = 1.5
+	if _, err := Cut(square(), p); err == nil {
+		t.Error("step down below the work surface was accepted")
+	}
+
+	p.FocusZ = 20
+	g, err := Cut(square(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"G0 Z20.000", "G0 Z19.000", "G0 Z18.000", "G0 Z20.000"}
+	if got := zMoves(string(g)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Z moves %v, want %v", got, want)
+	}
+
+	p.FocusZ, p.StepDown = 0, 0
+	if g, err = Cut(square(), p); err != nil {
+		t.Fatal(err)
+	}
+	if got := zMoves(string(g)); len(got) > 0 {
+		t.Errorf("Z moves %v without a focus Z or step down", got)
+	}
+}
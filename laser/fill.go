@@ -0,0 +1,93 @@
+package laser
+
+import (
+	"fmt"
+
+	"github.com/redt1de/cnctools/fill"
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/util"
+)
+
+// FillParams configures burning a fill pattern
+type FillParams struct {
+	Fill   fill.Params
+	Power  float64
+	Feed   float64
+	FocusZ float64 // Z to move to before starting, 0 stays at the current height
+}
+
+// DefaultFillParams returns a scanline fill at a third power
+func DefaultFillParams() FillParams {
+	return FillParams{
+		Fill:  fill.DefaultParams(),
+		Power: 300,
+		Feed:  1500,
+	}
+}
+
+// Validate checks the parameters
+func (p FillParams) Validate() error {
+	if p.Feed <= 0 {
+		return fmt.Errorf("feed rate must be positive")
+	}
+	return p.Fill.Validate()
+}
+
+// Burn writes the strokes in dynamic power mode, from laser on to laser off, so it can be
+// embedded in another program. Power is set on each move rather than with M3/M5 so the
+// controller does not stop between strokes, open strokes are run up to and past at S0 by the
+// overscan.
+func Burn(g *util.Gcode, strokes []geom.Path, p FillParams) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	over := p.Fill.Overscan
+	g.Add("M4 S0 ; Laser on, dynamic power")
+	g.Add("G1 F%.0f", p.Feed)
+	for _, s := range strokes {
+		open := len(s) > 1 && s[0] != s[len(s)-1]
+		start, end := s[0], s[len(s)-1]
+		if d := s[1].Sub(s[0]); open && over > 0 && d.Len() > 0 {
+			start = s[0].Sub(d.Scale(over / d.Len()))
+		}
+		g.Add("G0 X%.3f Y%.3f", start.X, start.Y)
+		if start != s[0] {
+			g.Add("G1 X%.3f Y%.3f S0", s[0].X, s[0].Y)
+		}
+		g.Add("G1 X%.3f Y%.3f S%.0f", s[1].X, s[1].Y, p.Power)
+		for _, pt := range s[2:] {
+			g.Add("G1 X%.3f Y%.3f", pt.X, pt.Y)
+		}
+		if d := end.Sub(s[len(s)-2]); open && over > 0 && d.Len() > 0 {
+			pt := end.Add(d.Scale(over / d.Len()))
+			g.Add("G1 X%.3f Y%.3f S0", pt.X, pt.Y)
+		} else {
+			g.Add("S0")
+		}
+	}
+	g.Add("M5 ; Laser off")
+	return nil
+}
+
+// Fill returns a program that fills the shapes with the pattern
+func Fill(shapes []geom.Shape, p FillParams) (util.Gcode, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	strokes, err := fill.Fill(shapes, p.Fill)
+	if err != nil {
+		return "", err
+	}
+	g := util.Gcode("")
+	g.G90Preamble()
+	if p.FocusZ > 0 {
+		g.Add("G0 Z%.3f ; Focus from profile", p.FocusZ)
+	}
+	g.Add("; %s fill, %d strokes at %.3fmm", p.Fill.Pattern, len(strokes), p.Fill.Interval)
+	if err := Burn(&g, strokes, p); err != nil {
+		return "", err
+	}
+	g.Add("G0 X0 Y0")
+	g.Add("M30 ; End program")
+	return g, nil
+}
@@ -0,0 +1,151 @@
+package laser
+
+import (
+	"fmt"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/text"
+	"github.com/redt1de/cnctools/util"
+)
+
+// focus test modes
+const (
+	Ramp      = "ramp"      // one line climbing steadily in Z
+	Staircase = "staircase" // flat segments, one Z each
+)
+
+// FocusParams configures the focus test. The laser is touched off on the work surface at Z0 and
+// the line runs along +X from X0 Y0 with Z going from Focal+ZMin to Focal+ZMax.
+type FocusParams struct {
+	Mode      string
+	Length    float64 // length of the test line
+	Steps     int     // ramp divisions between ticks, or staircase segments
+	Focal     float64 // rough focal length above the surface
+	ZMin      float64 // lowest Z relative to Focal
+	ZMax      float64 // highest Z relative to Focal
+	Power     float64
+	Feed      float64
+	LabelSize float64 // height of the tick labels, 0 for no labels
+}
+
+// DefaultFocusParams returns a 50mm ramp covering 10mm around a 40mm focal length
+func DefaultFocusParams() FocusParams {
+	return FocusParams{
+		Mode:      Ramp,
+		Length:    50,
+		Steps:     10,
+		Focal:     40,
+		ZMin:      -5,
+		ZMax:      5,
+		Power:     75,
+		Feed:      100,
+		LabelSize: 2,
+	}
+}
+
+// Validate checks the parameters
+func (p FocusParams) Validate() error {
+	switch {
+	case p.Mode != Ramp && p.Mode != Staircase:
+		return fmt.Errorf("unknown focus test mode %q", p.Mode)
+	case p.Length <= 0:
+		return fmt.Errorf("length must be positive")
+	case p.Steps < 1 || (p.Mode == Staircase && p.Steps < 2):
+		return fmt.Errorf("not enough steps")
+	case p.ZMax <= p.ZMin:
+		return fmt.Errorf("Z max must be above Z min")
+	case p.Focal+p.ZMin <= 0:
+		return fmt.Errorf("lowest Z would touch the work")
+	case p.Feed <= 0:
+		return fmt.Errorf("feed rate must be positive")
+	}
+	return nil
+}
+
+// Station is a labelled tick on the test line
+type Station struct {
+	X, Z float64
+}
+
+// Stations returns the ticks of the test: every division of a ramp, or the middle of each
+// staircase segment. The moves, labels and chart are all generated from these.
+func (p FocusParams) Stations() []Station {
+	out := []Station{}
+	lo, hi := p.Focal+p.ZMin, p.Focal+p.ZMax
+	if p.Mode == Staircase {
+		w := p.Length / float64(p.Steps)
+		for i := 0; i < p.Steps; i++ {
+			out = append(out, Station{X: w * (float64(i) + 0.5), Z: lo + (hi-lo)*float64(i)/float64(p.Steps-1)})
+		}
+		return out
+	}
+	for i := 0; i <= p.Steps; i++ {
+		t := float64(i) / float64(p.Steps)
+		out = append(out, Station{X: p.Length * t, Z: lo + (hi-lo)*t})
+	}
+	return out
+}
+
+// ZAt returns the Z the laser was at when it passed X on the test line
+func (p FocusParams) ZAt(x float64) (float64, error) {
+	if x < 0 || x > p.Length {
+		return 0, fmt.Errorf("X%.3f is off the %.0fmm test line", x, p.Length)
+	}
+	lo, hi := p.Focal+p.ZMin, p.Focal+p.ZMax
+	if p.Mode == Staircase {
+		i := min(int(x/(p.Length/float64(p.Steps))), p.Steps-1)
+		return lo + (hi-lo)*float64(i)/float64(p.Steps-1), nil
+	}
+	return lo + (hi-lo)*x/p.Length, nil
+}
+
+// Focus returns the focus test in absolute coordinates. The line is burnt first, then a tick
+// and label for every station are drawn below it at the rough focal length.
+func Focus(p FocusParams) (util.Gcode, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	stations := p.Stations()
+	g := util.Gcode("")
+	g.G90Preamble()
+	g.Add("; Focus test, %s from Z%.3f to Z%.3f over X0 to X%.3f", p.Mode, p.Focal+p.ZMin, p.Focal+p.ZMax, p.Length)
+	for i, s := range stations {
+		g.Add("; %d: X%.3f Z%.3f", i+1, s.X, s.Z)
+	}
+	g.Add("G0 Z%.3f ; Clear the work", p.Focal+p.ZMax)
+	g.Add("G0 X0 Y0")
+	if p.Mode == Staircase {
+		w := p.Length / float64(p.Steps)
+		for i, s := range stations {
+			g.Add("G0 X%.3f Z%.3f", w*float64(i), s.Z)
+			g.Add("M3 S%.0f ; Laser on", p.Power)
+			g.Add("G1 X%.3f F%.0f", w*float64(i+1), p.Feed)
+			g.Add("M5 ; Laser off")
+		}
+	} else {
+		g.Add("G0 Z%.3f", stations[0].Z)
+		g.Add("M3 S%.0f ; Laser on", p.Power)
+		g.Add("G1 X%.3f Z%.3f F%.0f", p.Length, stations[len(stations)-1].Z, p.Feed)
+		g.Add("M5 ; Laser off")
+	}
+
+	// ticks and labels are drawn in focus so they stay readable
+	marks := []geom.Path{}
+	o := text.DefaultOptions()
+	o.Size, o.Rotation, o.Align = p.LabelSize, 90, text.Right
+	for _, s := range stations {
+		marks = append(marks, geom.Path{{X: s.X, Y: -0.5}, {X: s.X, Y: -2}})
+		if p.LabelSize > 0 {
+			label, err := text.Strokes(fmt.Sprintf("%.1f", s.Z), geom.Point{X: s.X + p.LabelSize/2, Y: -2.5}, o)
+			if err != nil {
+				return "", err
+			}
+			marks = append(marks, label...)
+		}
+	}
+	g.Add("G0 Z%.3f ; Ticks and labels", p.Focal)
+	text.Engrave(&g, marks, text.EngraveParams{Laser: true, Power: p.Power, Feed: p.Feed})
+	g.Add("G0 X0 Y0")
+	g.Add("M30 ; End program")
+	return g, nil
+}
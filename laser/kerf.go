@@ -0,0 +1,147 @@
+package laser
+
+import (
+	"fmt"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/text"
+	"github.com/redt1de/cnctools/util"
+)
+
+// KerfParams configures the kerf and beam diameter test. A bar of Pieces squares is cut out along
+// +X from X0 Y0, and above it a ladder of filled squares is engraved with growing line intervals.
+type KerfParams struct {
+	Pieces    int
+	Size      float64 // nominal side of each piece
+	Passes    int     // cutting passes
+	Power     float64 // cutting power
+	Feed      float64 // cutting feed
+	Intervals []float64
+	Engrave   float64 // ladder power
+	Speed     float64 // ladder feed
+	FocusZ    float64 // Z to move to before starting, 0 stays at the current height
+}
+
+// DefaultKerfParams returns a 5 piece comb and a ladder from 0.05 to 0.3mm
+func DefaultKerfParams() KerfParams {
+	return KerfParams{
+		Pieces:    5,
+		Size:      10,
+		Passes:    1,
+		Power:     1000,
+		Feed:      300,
+		Intervals: []float64{0.05, 0.075, 0.1, 0.125, 0.15, 0.2, 0.25, 0.3},
+		Engrave:   300,
+		Speed:     1500,
+	}
+}
+
+// Validate checks the parameters
+func (p KerfParams) Validate() error {
+	switch {
+	case p.Pieces < 2:
+		return fmt.Errorf("at least two pieces are needed")
+	case p.Size <= 0:
+		return fmt.Errorf("piece size must be positive")
+	case p.Passes < 1:
+		return fmt.Errorf("at least one pass is needed")
+	case p.Feed <= 0 || p.Speed <= 0:
+		return fmt.Errorf("feed rates must be positive")
+	}
+	for _, i := range p.Intervals {
+		if i <= 0 {
+			return fmt.Errorf("line intervals must be positive")
+		}
+	}
+	return nil
+}
+
+// ladderSquare is the side of each engraved square in the ladder
+const ladderSquare = 5.0
+
+// Kerf returns the test program. The ladder is engraved first so the sheet is still whole,
+// then the cross cuts and finally the outline free the pieces.
+func Kerf(p KerfParams) (util.Gcode, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	g := util.Gcode("")
+	g.G90Preamble()
+	if p.FocusZ > 0 {
+		g.Add("G0 Z%.3f ; Focus from profile", p.FocusZ)
+	}
+
+	if len(p.Intervals) > 0 {
+		g.Add("; Beam diameter ladder, the widest interval without gaps gives the beam diameter")
+		labels := []geom.Path{}
+		o := text.DefaultOptions()
+		o.Size, o.Align = 1.5, text.Center
+		y0 := p.Size + 3
+		for i, interval := range p.Intervals {
+			x0 := float64(i) * (ladderSquare + 2)
+			rows := geom.Path{}
+			for k, y := 0, 0.0; y <= ladderSquare+1e-9; k, y = k+1, y+interval {
+				a, b := geom.Point{X: x0, Y: y0 + y}, geom.Point{X: x0 + ladderSquare, Y: y0 + y}
+				if k%2 == 1 {
+					a, b = b, a
+				}
+				rows = append(rows, a, b)
+			}
+			g.Add("; Interval %.3f", interval)
+			g.Add("G0 X%.3f Y%.3f", rows[0].X, rows[0].Y)
+			g.Add("M3 S%.0f ; Laser on", p.Engrave)
+			g.Add("G1 F%.0f", p.Speed)
+			for _, pt := range rows[1:] {
+				g.Add("G1 X%.3f Y%.3f", pt.X, pt.Y)
+			}
+			g.Add("M5 ; Laser off")
+			l, err := text.Strokes(fmt.Sprintf("%g", interval), geom.Point{X: x0 + ladderSquare/2, Y: y0 + ladderSquare + 1}, o)
+			if err != nil {
+				return "", err
+			}
+			labels = append(labels, l...)
+		}
+		text.Engrave(&g, labels, text.EngraveParams{Laser: true, Power: p.Engrave, Feed: p.Speed})
+	}
+
+	g.Add("; Comb of %d pieces, %.3fmm nominal", p.Pieces, p.Size)
+	length := p.Size * float64(p.Pieces)
+	cuts := []geom.Path{}
+	for i := 1; i < p.Pieces; i++ {
+		x := p.Size * float64(i)
+		cuts = append(cuts, geom.Path{{X: x, Y: 0}, {X: x, Y: p.Size}})
+	}
+	cuts = append(cuts, geom.Path{{X: 0, Y: 0}, {X: length, Y: 0}, {X: length, Y: p.Size}, {X: 0, Y: p.Size}, {X: 0, Y: 0}})
+	for _, c := range cuts {
+		g.Add("G0 X%.3f Y%.3f", c[0].X, c[0].Y)
+		g.Add("M3 S%.0f ; Laser on", p.Power)
+		g.Add("G1 F%.0f", p.Feed)
+		for pass := 0; pass < p.Passes; pass++ {
+			// open cuts go back and forth, the outline goes round again
+			path := c
+			if pass%2 == 1 && len(c) == 2 {
+				path = c.Reverse()
+			}
+			for _, pt := range path[1:] {
+				g.Add("G1 X%.3f Y%.3f", pt.X, pt.Y)
+			}
+		}
+		g.Add("M5 ; Laser off")
+	}
+	g.Add("G0 X0 Y0")
+	g.Add("M30 ; End program")
+	return g, nil
+}
+
+// KerfFromPieces returns the kerf given the length of the cut pieces pushed together. Every
+// piece is cut on its nominal lines, so each comes out one kerf short.
+func KerfFromPieces(size float64, pieces int, measured float64) (float64, error) {
+	if pieces < 1 || measured <= 0 {
+		return 0, fmt.Errorf("need the piece count and a measured length")
+	}
+	kerf := (size*float64(pieces) - measured) / float64(pieces)
+	if kerf < 0 || kerf >= size {
+		return 0, fmt.Errorf("measured %.3fmm does not fit %d pieces of %.3fmm", measured, pieces, size)
+	}
+	return kerf, nil
+}
@@ -0,0 +1,78 @@
+package laser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Material is a cutting preset. Power and Feed hold one value per pass, the last value is
+// repeated when there are more passes than values.
+type Material struct {
+	Thickness float64   `json:"thickness"`
+	Passes    int       `json:"passes"`
+	Power     []float64 `json:"power"`
+	Feed      []float64 `json:"feed"`
+	StepDown  float64   `json:"step_down,omitempty"` // Z descent between passes
+	Air       string    `json:"air,omitempty"`       // air assist code, M7 or M8, empty for none
+	Note      string    `json:"note,omitempty"`
+}
+
+// Materials is a preset table keyed by name
+type Materials map[string]Material
+
+// DefaultMaterials returns the built in presets. They are starting points for a 10W diode
+// laser with S1000 as full power, run a test cut before trusting them.
+func DefaultMaterials() Materials {
+	return Materials{
+		"plywood-3":   {Thickness: 3, Passes: 2, Power: []float64{1000}, Feed: []float64{300}, StepDown: 1, Air: "M8"},
+		"plywood-6":   {Thickness: 6, Passes: 4, Power: []float64{1000}, Feed: []float64{250, 200}, StepDown: 1.5, Air: "M8"},
+		"mdf-3":       {Thickness: 3, Passes: 3, Power: []float64{1000}, Feed: []float64{250}, StepDown: 1, Air: "M8"},
+		"acrylic-3":   {Thickness: 3, Passes: 2, Power: []float64{1000}, Feed: []float64{200}, StepDown: 1, Air: "M8", Note: "dark colours only with a diode laser"},
+		"acrylic-5":   {Thickness: 5, Passes: 4, Power: []float64{1000}, Feed: []float64{150}, StepDown: 1.25, Air: "M8", Note: "dark colours only with a diode laser"},
+		"cardboard-2": {Thickness: 2, Passes: 1, Power: []float64{700}, Feed: []float64{1200}, Air: "M8"},
+		"leather-2":   {Thickness: 2, Passes: 2, Power: []float64{900}, Feed: []float64{400}, StepDown: 0.5, Air: "M8"},
+		"paper":       {Thickness: 0.2, Passes: 1, Power: []float64{300}, Feed: []float64{2000}},
+	}
+}
+
+// LoadMaterials returns the built in presets with the ones in path added or replacing them. A
+// missing file leaves the built in table.
+func LoadMaterials(path string) (Materials, error) {
+	m := DefaultMaterials()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read materials: %v", err)
+	}
+	user := Materials{}
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("bad materials file %s: %v", path, err)
+	}
+	for name, mat := range user {
+		m[strings.ToLower(name)] = mat
+	}
+	return m, nil
+}
+
+// Names returns the preset names in order
+func (m Materials) Names() []string {
+	names := []string{}
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns a preset by name
+func (m Materials) Get(name string) (Material, error) {
+	if mat, ok := m[strings.ToLower(name)]; ok {
+		return mat, nil
+	}
+	return Material{}, fmt.Errorf("unknown material %q, available: %s", name, strings.Join(m.Names(), ", "))
+}
@@ -0,0 +1,450 @@
+package pocket
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/util"
+)
+
+const (
+	Offset = "offset"
+	ZigZag = "zigzag"
+)
+
+// Params configures a pocketing operation, all distances in mm with the stock top at Z0 unless Top is set
+type Params struct {
+	ToolDiameter  float64
+	StepOver      float64 // percent of the tool diameter
+	StepDown      float64
+	Depth         float64
+	Strategy      string  // Offset or ZigZag
+	Finish        float64 // radial stock left by roughing and removed by the finishing pass
+	FinishPass    bool
+	RampAngle     float64 // degrees, for helical and linear ramp entries
+	HelixDiameter float64 // 0 uses half the tool diameter
+	Feed          float64
+	PlungeFeed    float64
+	Spindle       float64
+	SafeZ         float64
+	Resolution    float64 // distance field grid spacing, 0 picks one from the tool size
+	Top           float64 // Z of the stock top, Depth is measured down from here
+}
+
+// DefaultParams returns sane defaults for a 6mm end mill
+func DefaultParams() Params {
+	return Params{
+		ToolDiameter: 6,
+		StepOver:     40,
+		StepDown:     1,
+		Depth:        3,
+		Strategy:     Offset,
+		FinishPass:   true,
+		RampAngle:    3,
+		Feed:         800,
+		PlungeFeed:   200,
+		Spindle:      10000,
+		SafeZ:        5,
+	}
+}
+
+func (p Params) radius() float64 { return p.ToolDiameter / 2 }
+func (p Params) step() float64   { return p.ToolDiameter * p.StepOver / 100 }
+
+// Validate checks the parameters for values that would produce an endless or empty program
+func (p Params) Validate() error {
+	switch {
+	case p.ToolDiameter <= 0:
+		return fmt.Errorf("tool diameter must be positive")
+	case p.StepOver <= 0 || p.StepOver > 100:
+		return fmt.Errorf("step over must be between 0 and 100 percent")
+	case p.StepDown <= 0:
+		return fmt.Errorf("step down must be positive")
+	case p.Depth <= 0:
+		return fmt.Errorf("depth must be positive")
+	case p.Strategy != Offset && p.Strategy != ZigZag:
+		return fmt.Errorf("unknown strategy %q", p.Strategy)
+	case p.Finish < 0:
+		return fmt.Errorf("finish allowance can not be negative")
+	}
+	return nil
+}
+
+// DepthPasses splits depth into equal passes no deeper than stepDown, returning the Z of each pass
+func DepthPasses(depth, stepDown float64) []float64 {
+	n := int(math.Ceil(depth/stepDown - 1e-9))
+	if n < 1 {
+		n = 1
+	}
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = -depth * float64(i+1) / float64(n)
+	}
+	return out
+}
+
+// region is one connected area the tool centre can reach, with the paths cut inside it
+type region struct {
+	bound  geom.Shape  // tool centre boundary for roughing
+	centre geom.Point  // point with the most room, used for the helical entry
+	room   float64     // distance from centre to the pocket wall
+	paths  []geom.Path // roughing paths, closed loops for Offset, open rows for ZigZag
+	closed bool
+	walls  []geom.Path // closed loops cut after the ZigZag rows of every pass
+	finish []geom.Path // finishing loops, cut once at full depth
+}
+
+// Generate returns G-code that clears the shapes to depth. Shapes are the pocket boundaries with
+// their islands as holes, as returned by geom.Nest.
+func Generate(shapes []geom.Shape, p Params) (util.Gcode, error) {
+	g := util.Gcode("")
+	g.G90Preamble()
+	g.Add("G0 Z%.3f ; Safe height", p.SafeZ)
+	if err := Cut(&g, shapes, p); err != nil {
+		return "", err
+	}
+	g.Add("M30 ; End program")
+	return g, nil
+}
+
+// Cut appends the moves that clear the shapes to depth, from spindle start to stop, so the pocket
+// can be part of a larger program. The tool must start at SafeZ.
+func Cut(g *util.Gcode, shapes []geom.Shape, p Params) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if len(shapes) == 0 {
+		return fmt.Errorf("no closed contours to pocket")
+	}
+	if p.PlungeFeed <= 0 {
+		p.PlungeFeed = p.Feed / 3
+	}
+	res := p.Resolution
+	if res <= 0 {
+		res = math.Max(p.ToolDiameter/25, 0.05)
+	}
+
+	field := geom.NewDistanceField(shapes, res, 0)
+	rough := p.radius() + p.Finish
+	regions := []*region{}
+	for _, b := range field.Offset(rough) {
+		r := &region{bound: b}
+		r.centre, r.room = field.Max(b)
+		if p.Strategy == Offset {
+			r.paths, r.closed = offsetLoops(field, b, rough, p.step()), true
+		} else {
+			r.paths = zigzagRows(field, b, rough, p.step())
+			r.walls = b.Rings()
+		}
+		if p.FinishPass {
+			for _, s := range field.Offset(p.radius()) {
+				if s.Contains(r.centre) {
+					r.finish = append(r.finish, s.Rings()...)
+				}
+			}
+		}
+		regions = append(regions, r)
+	}
+	if len(regions) == 0 {
+		return fmt.Errorf("tool is too large for the pocket")
+	}
+
+	g.Add("M3 S%.0f ; Start spindle", p.Spindle)
+	top := p.Top
+	for li, z := range DepthPasses(p.Depth, p.StepDown) {
+		z += p.Top
+		g.Add("; Pass %d, Z%.3f", li+1, z)
+		for ri, r := range regions {
+			g.Add("; Region %d", ri+1)
+			r.cut(g, field, p, top, z)
+		}
+		top = z
+	}
+	if p.FinishPass {
+		g.Add("; Finishing pass, Z%.3f", top)
+		for ri, r := range regions {
+			g.Add("; Region %d", ri+1)
+			r.cutFinish(g, p, top)
+		}
+	}
+	g.Add("G0 Z%.3f ; Retract", p.SafeZ)
+	g.Add("M5 ; Stop spindle")
+	return nil
+}
+
+// offsetLoops returns contour parallel loops inside bound, innermost first
+func offsetLoops(field *geom.DistanceField, bound geom.Shape, level, step float64) []geom.Path {
+	levels := [][]geom.Path{bound.Rings()}
+	last := level
+	for d := level + step; ; d += step {
+		loops := loopsAt(field, bound, d)
+		if len(loops) == 0 {
+			break
+		}
+		levels = append(levels, loops)
+		last = d
+	}
+	// an extra loop between the last level and the centre keeps a wide stepover from leaving a strip
+	if _, peak := field.Max(bound); peak-last > step/2 {
+		if loops := loopsAt(field, bound, (last+peak)/2); len(loops) > 0 {
+			levels = append(levels, loops)
+		}
+	}
+	out := []geom.Path{}
+	for i := len(levels) - 1; i >= 0; i-- {
+		out = append(out, levels[i]...)
+	}
+	return out
+}
+
+// loopsAt returns the rings of the offset at level d that lie inside bound
+func loopsAt(field *geom.DistanceField, bound geom.Shape, d float64) []geom.Path {
+	loops := []geom.Path{}
+	for _, s := range field.Offset(d) {
+		if bound.Contains(s.Outer[0]) {
+			loops = append(loops, s.Rings()...)
+		}
+	}
+	return loops
+}
+
+// zigzagRows returns raster rows along X inside bound, alternating direction where rows can be linked
+func zigzagRows(field *geom.DistanceField, bound geom.Shape, level, step float64) []geom.Path {
+	b := bound.Bounds()
+	rows := [][][2]float64{}
+	n := int(math.Ceil(b.Height()/step - 1e-9))
+	if n < 1 {
+		n = 1
+	}
+	ys := []float64{}
+	for i := 0; i <= n; i++ {
+		// inset the first and last rows a hair so they sit on the boundary and not outside it
+		y := b.Min.Y + b.Height()*float64(i)/float64(n)
+		y = math.Max(b.Min.Y+field.Res*0.05, math.Min(b.Max.Y-field.Res*0.05, y))
+		ys = append(ys, y)
+		xs := geom.ScanLine(bound.Rings(), y)
+		row := [][2]float64{}
+		for k := 0; k+1 < len(xs); k += 2 {
+			row = append(row, [2]float64{xs[k], xs[k+1]})
+		}
+		rows = append(rows, row)
+	}
+
+	used := make([][]bool, len(rows))
+	for i := range rows {
+		used[i] = make([]bool, len(rows[i]))
+	}
+	out := []geom.Path{}
+	for {
+		// start each chain at the lowest unused interval
+		si, sk := -1, -1
+		for i := range rows {
+			for k := range rows[i] {
+				if !used[i][k] {
+					si, sk = i, k
+					break
+				}
+			}
+			if si >= 0 {
+				break
+			}
+		}
+		if si < 0 {
+			break
+		}
+		chain := geom.Path{}
+		forward := true
+		for i, k := si, sk; ; {
+			used[i][k] = true
+			iv := rows[i][k]
+			a, c := geom.Point{X: iv[0], Y: ys[i]}, geom.Point{X: iv[1], Y: ys[i]}
+			if !forward {
+				a, c = c, a
+			}
+			chain = append(chain, a, c)
+			if i+1 >= len(rows) {
+				break
+			}
+			nk := -1
+			for k2, iv2 := range rows[i+1] {
+				if used[i+1][k2] {
+					continue
+				}
+				end := geom.Point{X: iv2[0], Y: ys[i+1]}
+				if forward {
+					end.X = iv2[1]
+				}
+				if iv2[0] <= iv[1] && iv2[1] >= iv[0] && field.SegmentInside(c, end, level) {
+					nk = k2
+					break
+				}
+			}
+			if nk < 0 {
+				break
+			}
+			i, k = i+1, nk
+			forward = !forward
+		}
+		out = append(out, chain)
+	}
+	return out
+}
+
+// cut writes the roughing moves of one region at depth z, top is the floor of the previous pass
+func (r *region) cut(g *util.Gcode, field *geom.DistanceField, p Params, top, z float64) {
+	if len(r.paths) == 0 {
+		return
+	}
+	first := r.paths[0]
+
+	// helical entry at the point with the most room, falling back to a ramp along the first path
+	helixR := p.HelixDiameter / 2
+	if helixR <= 0 {
+		helixR = p.radius() / 2
+	}
+	helixR = math.Min(helixR, r.room-p.radius()-p.Finish)
+	if helixR >= p.ToolDiameter*0.1 {
+		if r.closed {
+			first = first.RotateStart(r.centre)
+		}
+		Helix(g, r.centre, helixR, top, z, p.RampAngle, p.PlungeFeed, p.SafeZ)
+		exit := geom.Point{X: r.centre.X + helixR, Y: r.centre.Y}
+		if field.SegmentInside(exit, first[0], p.radius()) {
+			g.Add("G1 X%.3f Y%.3f F%.0f", first[0].X, first[0].Y, p.Feed)
+		} else {
+			retract(g, p, first[0], top)
+			Ramp(g, first, r.closed, top, z, p.RampAngle, p.PlungeFeed)
+		}
+	} else {
+		retract(g, p, first[0], top)
+		Ramp(g, first, r.closed, top, z, p.RampAngle, p.PlungeFeed)
+	}
+
+	paths := append([]geom.Path{first}, r.paths[1:]...)
+	paths = append(paths, r.walls...)
+	pos := first[0]
+	for i, path := range paths {
+		closed := r.closed || i >= len(r.paths)
+		if i > 0 {
+			if closed {
+				path = path.RotateStart(pos)
+			}
+			// stay down when the link is short and inside the pocket, otherwise lift and ramp back in
+			if pos.Dist(path[0]) <= 2*p.ToolDiameter && field.SegmentInside(pos, path[0], p.radius()) {
+				g.Add("G1 X%.3f Y%.3f F%.0f", path[0].X, path[0].Y, p.Feed)
+			} else {
+				retract(g, p, path[0], top)
+				Ramp(g, path, closed, top, z, p.RampAngle, p.PlungeFeed)
+			}
+		}
+		g.Add("G1 F%.0f", p.Feed)
+		for _, pt := range path[1:] {
+			g.Add("G1 X%.3f Y%.3f", pt.X, pt.Y)
+		}
+		pos = path[len(path)-1]
+		if closed {
+			g.Add("G1 X%.3f Y%.3f", path[0].X, path[0].Y)
+			pos = path[0]
+		}
+	}
+	g.Add("G0 Z%.3f", p.SafeZ)
+}
+
+// cutFinish writes the finishing loops of one region at the full depth z, once roughing has
+// cleared it. Each loop is entered from the nearest point of the roughing paths, which are
+// clear all the way down, with a short move out through the finishing allowance.
+func (r *region) cutFinish(g *util.Gcode, p Params, z float64) {
+	if len(r.paths) == 0 {
+		return
+	}
+	for _, loop := range r.finish {
+		if len(loop) < 2 {
+			continue
+		}
+		entry, best := r.paths[0][0], math.Inf(1)
+		for _, path := range append(append([]geom.Path{}, r.paths...), r.walls...) {
+			for _, pt := range path {
+				for _, q := range loop {
+					if d := pt.Dist(q); d < best {
+						entry, best = pt, d
+					}
+				}
+			}
+		}
+		loop = loop.RotateStart(entry)
+		retract(g, p, entry, z)
+		g.Add("G1 Z%.3f F%.0f", z, p.PlungeFeed)
+		g.Add("G1 X%.3f Y%.3f F%.0f", loop[0].X, loop[0].Y, p.Feed)
+		for _, pt := range loop[1:] {
+			g.Add("G1 X%.3f Y%.3f", pt.X, pt.Y)
+		}
+		g.Add("G1 X%.3f Y%.3f", loop[0].X, loop[0].Y)
+		g.Add("G0 Z%.3f", p.SafeZ)
+	}
+}
+
+// retract lifts to safe height and rapids over to, and down near, the next start point
+func retract(g *util.Gcode, p Params, to geom.Point, top float64) geom.Point {
+	g.Add("G0 Z%.3f", p.SafeZ)
+	g.Add("G0 X%.3f Y%.3f", to.X, to.Y)
+	if top < p.SafeZ {
+		g.Add("G0 Z%.3f", top+0.5)
+	}
+	return to
+}
+
+// Helix descends from top to z on a circle of radius r around c using helical arcs, finishing
+// with a flat revolution at depth. The tool ends at c+(r,0).
+func Helix(g *util.Gcode, c geom.Point, r, top, z, angle, feed, safeZ float64) {
+	if angle <= 0 {
+		angle = 3
+	}
+	perRev := 2 * math.Pi * r * math.Tan(angle*math.Pi/180)
+	revs := int(math.Ceil((top - z) / perRev))
+	if revs < 1 {
+		revs = 1
+	}
+	g.Add("G0 Z%.3f", safeZ)
+	g.Add("G0 X%.3f Y%.3f ; Helix entry", c.X+r, c.Y)
+	g.Add("G0 Z%.3f", top+0.5)
+	g.Add("G1 Z%.3f F%.0f", top, feed)
+	for i := 1; i <= revs; i++ {
+		g.Add("G3 X%.3f Y%.3f I%.3f J0 Z%.3f", c.X+r, c.Y, -r, top+(z-top)*float64(i)/float64(revs))
+	}
+	g.Add("G3 X%.3f Y%.3f I%.3f J0", c.X+r, c.Y, -r)
+}
+
+// Ramp descends from top to z by zig-zagging along the start of path, the tool ends at path[0].
+// The tool must already be above path[0].
+func Ramp(g *util.Gcode, path geom.Path, closed bool, top, z, angle, feed float64) {
+	if angle <= 0 {
+		angle = 3
+	}
+	if closed {
+		path = path.Closed()
+	}
+	// walk up to half the path length so the ramp stays on the cut
+	limit := path.Length(false) / 2
+	walk := geom.Path{path[0]}
+	for i := 1; i < len(path) && walk.Length(false) < limit; i++ {
+		walk = append(walk, path[i])
+	}
+	length := walk.Length(false)
+	if length < 1e-6 {
+		g.Add("G1 Z%.3f F%.0f ; Plunge", z, feed)
+		return
+	}
+	g.Add("G1 Z%.3f F%.0f", top, feed)
+	slope := math.Tan(angle * math.Pi / 180)
+	cur := top
+	for cur > z+1e-9 {
+		// forward along the walk, then back to the start, descending on both legs
+		for _, leg := range []geom.Path{walk, walk.Reverse()} {
+			for i := 1; i < len(leg); i++ {
+				cur = math.Max(z, cur-leg[i].Dist(leg[i-1])*slope)
+				g.Add("G1 X%.3f Y%.3f Z%.3f", leg[i].X, leg[i].Y, cur)
+			}
+		}
+	}
+}
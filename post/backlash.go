@@ -0,0 +1,202 @@
+package post
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/redt1de/cnctools/gcode"
+)
+
+// Backlash adds compensating moves to a program. Whenever an axis reverses, a short move takes
+// up the slack and from then on that axis is programmed shifted by the slack, so the tool ends
+// up where the program meant. amounts holds the backlash of each axis in mm, indexed like
+// gcode.Axes. Arcs are split where an axis turns around so each piece is shifted as a whole.
+// Canned cycles and moves after homing or probing are passed through, the direction of the
+// slack is unknown again after them.
+func Backlash(blocks []gcode.Block, amounts gcode.Axes) ([]gcode.Block, error) {
+	for _, a := range amounts {
+		if a < 0 {
+			return nil, fmt.Errorf("backlash can not be negative")
+		}
+	}
+	s := gcode.NewState()
+	var offset gcode.Axes // shift of every axis in mm
+	var dir [6]int        // last direction of travel per axis, 0 when unknown
+	out := []gcode.Block{}
+	outMotion := -1
+	for n, b := range blocks {
+		b.Words = append([]gcode.Word{}, b.Words...)
+		known := s.Known
+		m, moved, err := s.Apply(b)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		scale := s.Scale()
+		if hasMotion(b) {
+			outMotion = s.Motion
+		}
+		if !moved || s.Canned() {
+			// G92 names program positions, shift it like an absolute move
+			if b.HasCode('G', 92) || moved && s.Absolute {
+				shift(&b, offset, scale, false)
+			}
+			for i := range dir {
+				if s.Known[i] != known[i] || s.Canned() {
+					dir[i] = 0
+				}
+			}
+			out = append(out, b)
+			continue
+		}
+
+		pieces := []gcode.Move{m}
+		if m.Motion == 2 || m.Motion == 3 {
+			pieces = splitArc(m)
+		}
+		for pi, piece := range pieces {
+			// take up the slack of the axes this piece turns around on
+			comp := gcode.Block{}
+			for i := range dir {
+				d := 0
+				if delta := piece.To[i] - piece.From[i]; delta > 1e-9 {
+					d = 1
+				} else if delta < -1e-9 {
+					d = -1
+				}
+				if d == 0 {
+					continue
+				}
+				if dir[i] != 0 && d != dir[i] && amounts[i] > 0 {
+					offset[i] += float64(d) * amounts[i]
+					v := float64(d) * amounts[i]
+					if s.Absolute {
+						v = piece.From[i] + offset[i]
+					}
+					comp.Words = append(comp.Words, gcode.Word{Letter: gcode.AxisLetters[i], Value: v / axisScale(i, scale)})
+				}
+				dir[i] = d
+			}
+			if len(comp.Words) > 0 {
+				motion := 1.0
+				if piece.Motion == 0 || s.InverseTime {
+					motion = 0
+				}
+				comp.Words = append([]gcode.Word{{Letter: 'G', Value: motion}}, comp.Words...)
+				comp.Comment = "; Backlash"
+				out = append(out, comp)
+				outMotion = int(motion)
+			}
+
+			var nb gcode.Block
+			if len(pieces) == 1 {
+				nb = b
+				if s.Absolute {
+					shift(&nb, offset, scale, s.ArcAbsolute)
+				}
+			} else {
+				nb = arcBlock(piece, offset, scale, s)
+				f, ok := b.Get('F')
+				switch {
+				case s.InverseTime:
+					// inverse time feeds cover the whole arc, split them over the pieces
+					nb.Words = append(nb.Words, gcode.Word{Letter: 'F', Value: f * float64(len(pieces))})
+				case ok && pi == 0:
+					nb.Words = append(nb.Words, gcode.Word{Letter: 'F', Value: f})
+				}
+				if pi == 0 {
+					nb.Comment = b.Comment
+				}
+			}
+			if !hasMotion(nb) && outMotion != piece.Motion {
+				nb.Words = append([]gcode.Word{{Letter: 'G', Value: float64(piece.Motion)}}, nb.Words...)
+			}
+			outMotion = piece.Motion
+			out = append(out, nb)
+		}
+	}
+	return out, nil
+}
+
+// axisScale converts mm to program units on linear axes, rotary axes stay in degrees
+func axisScale(i int, scale float64) float64 {
+	if i <= gcode.Z {
+		return scale
+	}
+	return 1
+}
+
+// shift moves the axis words of an absolute block by offset, and the arc centre words when
+// they are absolute too
+func shift(b *gcode.Block, offset gcode.Axes, scale float64, centres bool) {
+	for i, w := range b.Words {
+		a := gcode.AxisIndex(w.Letter)
+		if centres && a < 0 {
+			a = strings.IndexByte("IJK", w.Letter)
+		}
+		if a >= 0 && offset[a] != 0 {
+			b.Words[i] = gcode.Word{Letter: w.Letter, Value: w.Value + offset[a]/axisScale(a, scale)}
+		}
+	}
+}
+
+// splitArc cuts an arc where either plane axis turns around, at the quarter points of its circle
+func splitArc(m gcode.Move) []gcode.Move {
+	a0, a1, _ := gcode.PlaneAxes(m.Plane)
+	r := math.Hypot(m.From[a0]-m.Centre[0], m.From[a1]-m.Centre[1])
+	start := math.Atan2(m.From[a1]-m.Centre[1], m.From[a0]-m.Centre[0])
+	sweep := m.Sweep()
+	cuts := []float64{}
+	step := math.Pi / 2
+	if sweep > 0 {
+		for a := math.Floor(start/step+1) * step; a < start+sweep-1e-9; a += step {
+			cuts = append(cuts, (a-start)/sweep)
+		}
+	} else {
+		for a := math.Ceil(start/step-1) * step; a > start+sweep+1e-9; a -= step {
+			cuts = append(cuts, (a-start)/sweep)
+		}
+	}
+	cuts = append(cuts, 1)
+	out := []gcode.Move{}
+	from := m.From
+	for _, t := range cuts {
+		to := m.To
+		if t < 1 {
+			for i := range to {
+				to[i] = m.From[i] + (m.To[i]-m.From[i])*t
+			}
+			a := start + sweep*t
+			to[a0] = m.Centre[0] + r*math.Cos(a)
+			to[a1] = m.Centre[1] + r*math.Sin(a)
+		}
+		if p := (gcode.Move{Motion: m.Motion, From: from, To: to, Centre: m.Centre, Plane: m.Plane}); t > 1e-9 {
+			out = append(out, p)
+		}
+		from = to
+	}
+	return out
+}
+
+// arcBlock formats a piece of an arc shifted by offset, in the distance mode of the state
+func arcBlock(m gcode.Move, offset gcode.Axes, scale float64, s *gcode.State) gcode.Block {
+	b := gcode.Block{Words: []gcode.Word{{Letter: 'G', Value: float64(m.Motion)}}}
+	for i, l := range gcode.AxisLetters {
+		if math.Abs(m.To[i]-m.From[i]) < 1e-9 {
+			continue
+		}
+		v := m.To[i] - m.From[i]
+		if s.Absolute {
+			v = m.To[i] + offset[i]
+		}
+		b.Words = append(b.Words, gcode.Word{Letter: byte(l), Value: v / axisScale(i, scale)})
+	}
+	a0, a1, _ := gcode.PlaneAxes(m.Plane)
+	l0, l1 := "IJK"[a0], "IJK"[a1]
+	c0, c1 := m.Centre[0]-m.From[a0], m.Centre[1]-m.From[a1]
+	if s.ArcAbsolute {
+		c0, c1 = m.Centre[0]+offset[a0], m.Centre[1]+offset[a1]
+	}
+	b.Words = append(b.Words, gcode.Word{Letter: l0, Value: c0 / scale}, gcode.Word{Letter: l1, Value: c1 / scale})
+	return b
+}
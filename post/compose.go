@@ -0,0 +1,178 @@
+package post
+
+import (
+	"fmt"
+
+	"github.com/redt1de/cnctools/gcode"
+)
+
+// Operation is one program of a composed job
+type Operation struct {
+	Name   string
+	Blocks []gcode.Block
+	Tool   int    // tool number, 0 keeps the tool of the operation before
+	Note   string // tool description shown at manual changes, e.g. 3.175mm end mill
+}
+
+// ComposeParams configures how operations are joined
+type ComposeParams struct {
+	SafeZ   float64 // work Z to retract to between operations
+	Machine bool    // retract to machine Z0 with G53 instead of SafeZ
+	Retract bool    // retract between operations, off for laser jobs that keep their focus height
+	Manual  bool    // pause with M0 for tool changes rather than M6
+}
+
+// DefaultComposeParams returns a retract to 5mm and M6 tool changes
+func DefaultComposeParams() ComposeParams {
+	return ComposeParams{SafeZ: 5, Retract: true}
+}
+
+// Validate checks the parameters
+func (p ComposeParams) Validate() error {
+	if p.Retract && !p.Machine && p.SafeZ <= 0 {
+		return fmt.Errorf("safe height must be above the surface")
+	}
+	return nil
+}
+
+// modalCodes are the G codes compared against the output state to drop repeats
+var modalCodes = []float64{17, 18, 19, 90, 91, 93, 94}
+
+// Compose joins operations into one program with a single header and end. Each operation is
+// converted to millimetres and its program end, % markers, blank lines and mode codes that
+// repeat the current state are dropped. Between operations the tool retracts, G92 offsets are
+// cleared, the tool is changed when the next operation names another one, and the distance
+// mode, plane and feed mode go back to G90 G17 G94 for programs that rely on the controller
+// defaults.
+func Compose(ops []Operation, p ComposeParams) ([]gcode.Block, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("no operations")
+	}
+	code := func(letter byte, v float64) gcode.Word { return gcode.Word{Letter: letter, Value: v} }
+	comment := func(format string, a ...interface{}) gcode.Block {
+		return gcode.Block{Comment: "; " + fmt.Sprintf(format, a...)}
+	}
+
+	out := []gcode.Block{comment("Job of %d operations", len(ops))}
+	for i, op := range ops {
+		tool := ""
+		if op.Tool > 0 {
+			tool = fmt.Sprintf(", tool %d", op.Tool)
+			if op.Note != "" {
+				tool += ", " + op.Note
+			}
+		}
+		out = append(out, comment("%d. %s%s", i+1, op.Name, tool))
+	}
+	out = append(out, gcode.Block{Words: []gcode.Word{code('G', 21)}}, gcode.Block{Words: []gcode.Word{code('G', 90)}})
+
+	s := gcode.NewState() // the state of the output so far
+	retract := func() {
+		if !p.Retract {
+			return
+		}
+		b := gcode.Block{Words: []gcode.Word{code('G', 0), code('Z', p.SafeZ)}, Comment: "; Retract"}
+		if p.Machine {
+			b.Words = []gcode.Word{code('G', 53), code('G', 0), code('Z', 0)}
+		} else if !s.Absolute {
+			b.Words = append([]gcode.Word{code('G', 90)}, b.Words...)
+		}
+		s.Apply(b)
+		out = append(out, b)
+	}
+	current := 0
+	offsets := false // whether an operation left G92 offsets behind
+	clearOffsets := func() {
+		if offsets {
+			out = append(out, gcode.Block{Words: []gcode.Word{code('G', 92.1)}, Comment: "; Clear G92 offsets"})
+			offsets = false
+		}
+	}
+	for i, op := range ops {
+		blocks, err := Units(op.Blocks, false)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op.Name, err)
+		}
+		clearOffsets()
+		if i > 0 {
+			retract()
+		}
+		out = append(out, comment("Operation %d: %s", i+1, op.Name))
+		if op.Tool > 0 && op.Tool != current {
+			if p.Manual {
+				out = append(out, gcode.Block{Words: []gcode.Word{code('M', 5)}, Comment: "; Stop spindle"})
+				note := ""
+				if op.Note != "" {
+					note = ", " + op.Note + ","
+				}
+				out = append(out, gcode.Block{Words: []gcode.Word{code('M', 0)}, Comment: fmt.Sprintf("; Change to tool %d%s and resume", op.Tool, note)})
+			} else {
+				out = append(out, gcode.Block{Words: []gcode.Word{code('T', float64(op.Tool)), code('M', 6)}, Comment: "; Tool change"})
+			}
+			current = op.Tool
+		}
+		reset := gcode.Block{}
+		if !s.Absolute {
+			reset.Words = append(reset.Words, code('G', 90))
+		}
+		if s.Plane != 17 {
+			reset.Words = append(reset.Words, code('G', 17))
+		}
+		if s.InverseTime {
+			reset.Words = append(reset.Words, code('G', 94))
+		}
+		if len(reset.Words) > 0 {
+			s.Apply(reset)
+			out = append(out, reset)
+		}
+
+		for _, b := range blocks {
+			if b.Raw == "%" || b.Empty() {
+				continue
+			}
+			if b.HasCode('G', 92) {
+				offsets = true
+			}
+			had := len(b.Words) > 0
+			b.Words = append([]gcode.Word{}, b.Words...)
+			b.RemoveCode('G', 20)
+			b.RemoveCode('G', 21)
+			b.RemoveCode('M', 2)
+			b.RemoveCode('M', 30)
+			for _, c := range modalCodes {
+				if b.HasCode('G', c) && repeats(s, c) {
+					b.RemoveCode('G', c)
+				}
+			}
+			if had && len(b.Words) == 0 {
+				// nothing left of a preamble or end line, its comment goes with it
+				continue
+			}
+			if _, _, err := s.Apply(b); err != nil {
+				return nil, fmt.Errorf("%s: %v", op.Name, err)
+			}
+			out = append(out, b)
+		}
+	}
+	clearOffsets()
+	retract()
+	out = append(out, gcode.Block{Words: []gcode.Word{code('M', 5)}, Comment: "; Stop spindle"})
+	out = append(out, gcode.Block{Words: []gcode.Word{code('M', 30)}, Comment: "; End program"})
+	return out, nil
+}
+
+// repeats reports whether a modal G code sets what the state already has
+func repeats(s *gcode.State, c float64) bool {
+	switch c {
+	case 17, 18, 19:
+		return s.Plane == int(c)
+	case 90, 91:
+		return s.Absolute == (c == 90)
+	case 93, 94:
+		return s.InverseTime == (c == 93)
+	}
+	return false
+}
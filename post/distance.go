@@ -0,0 +1,95 @@
+package post
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/redt1de/cnctools/gcode"
+)
+
+// Distance rewrites a program into absolute (G90) or relative (G91) coordinates, taking the
+// machine to start at start in work coordinates. Moves, probing targets and the intermediate
+// points of G28 and G30 are converted. G53 and G92 values are absolute in either mode and are
+// passed through, and G92 resets the positions the conversion works from. Moves that need a
+// position the program can not know, after homing, probing or a G53 move, and canned cycles
+// whose R and Z mean different things in each mode, keep their own mode with a mode switch
+// around them.
+func Distance(blocks []gcode.Block, absolute bool, start gcode.Axes) ([]gcode.Block, error) {
+	target := 90.0
+	if !absolute {
+		target = 91
+	}
+	s := gcode.NewState()
+	s.Pos = start
+	for i := range s.Known {
+		s.Known[i] = true
+	}
+	out := []gcode.Block{{Words: []gcode.Word{{Letter: 'G', Value: target}}}}
+	outAbs := absolute
+	for n, b := range blocks {
+		from, known := s.Pos, s.Known
+		if _, _, err := s.Apply(b); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if b.Raw != "" {
+			out = append(out, b)
+			continue
+		}
+		b.Words = append([]gcode.Word{}, b.Words...)
+		b.RemoveCode('G', 90)
+		b.RemoveCode('G', 91)
+		if b.Empty() {
+			continue
+		}
+
+		axes := false
+		for _, l := range gcode.AxisLetters {
+			if b.Has(byte(l)) {
+				axes = true
+			}
+		}
+		fixed := b.HasCode('G', 53) || b.HasCode('G', 92) || b.HasCode('G', 10) || b.HasCode('G', 4)
+		home := b.HasCode('G', 28) || b.HasCode('G', 30)
+		if !axes || fixed || s.Motion < 0 && !home {
+			out = append(out, b)
+			continue
+		}
+
+		convert := s.Absolute != absolute && (!s.Canned() || home)
+		for i, l := range gcode.AxisLetters {
+			if b.Has(byte(l)) && !known[i] {
+				convert = false
+			}
+		}
+		mode := s.Absolute
+		if convert {
+			mode = absolute
+			scale := s.Scale()
+			for i, w := range b.Words {
+				a := gcode.AxisIndex(w.Letter)
+				if a < 0 {
+					continue
+				}
+				k := axisScale(a, scale)
+				v := from[a] + w.Value*k // relative to absolute
+				if !absolute {
+					v = w.Value*k - from[a]
+				}
+				if math.Abs(v) < 1e-12 {
+					v = 0
+				}
+				b.Words[i] = gcode.Word{Letter: w.Letter, Value: v / k}
+			}
+		}
+		if mode != outAbs {
+			code := 90.0
+			if !mode {
+				code = 91
+			}
+			b.Words = append([]gcode.Word{{Letter: 'G', Value: code}}, b.Words...)
+			outAbs = mode
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
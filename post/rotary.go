@@ -0,0 +1,208 @@
+package post
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/redt1de/cnctools/gcode"
+)
+
+// rotary modes
+const (
+	Chuck  = "chuck"  // the object turns on the A axis, Y becomes degrees
+	Roller = "roller" // the object sits on rollers driven by the Y motor, Y is rescaled
+)
+
+// RotaryParams configures wrapping the Y axis around a cylinder
+type RotaryParams struct {
+	Mode      string
+	Diameter  float64 // object diameter, chuck mode
+	Scale     float64 // commanded Y per mm of surface travel, roller mode
+	Tolerance float64 // chord error when arcs through Y are broken into lines
+}
+
+// DefaultRotaryParams returns chuck mode for a 80mm tumbler
+func DefaultRotaryParams() RotaryParams {
+	return RotaryParams{Mode: Chuck, Diameter: 80, Scale: 1, Tolerance: 0.01}
+}
+
+// Validate checks the parameters
+func (p RotaryParams) Validate() error {
+	switch {
+	case p.Mode != Chuck && p.Mode != Roller:
+		return fmt.Errorf("unknown rotary mode %q", p.Mode)
+	case p.Mode == Chuck && p.Diameter <= 0:
+		return fmt.Errorf("object diameter must be positive")
+	case p.Mode == Roller && p.Scale <= 0:
+		return fmt.Errorf("roller scale must be positive")
+	case p.Tolerance <= 0:
+		return fmt.Errorf("tolerance must be positive")
+	}
+	return nil
+}
+
+// RollerScale returns the Y scale for a roller rotary on the Y motor. The controller moves
+// ySteps steps per commanded mm, the rollers need stepsPerRev steps to turn once, and the
+// object surface moves as far as the roller surface.
+func RollerScale(rollerDiameter, stepsPerRev, ySteps float64) (float64, error) {
+	if rollerDiameter <= 0 || stepsPerRev <= 0 || ySteps <= 0 {
+		return 0, fmt.Errorf("roller diameter, steps per revolution and Y steps must be positive")
+	}
+	return stepsPerRev / (math.Pi * rollerDiameter) / ySteps, nil
+}
+
+// perMM returns how far the output Y or A word moves per mm of surface travel
+func (p RotaryParams) perMM() float64 {
+	if p.Mode == Chuck {
+		return 360 / (math.Pi * p.Diameter)
+	}
+	return p.Scale
+}
+
+// Rotary rewrites a flat program for a rotary. Y words become A degrees around an object of
+// the set diameter in chuck mode, or are scaled for the roller drive in roller mode. Arcs
+// that move Y are broken into lines. Feed rates are scaled on every cutting move so the
+// surface passes under the tool at the programmed speed, the controller sees the rotary move
+// as longer or shorter than the surface distance.
+func Rotary(blocks []gcode.Block, p RotaryParams) ([]gcode.Block, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	k := p.perMM()
+	s := gcode.NewState()
+	out := []gcode.Block{}
+	outMotion := -1
+	lastF := -1.0
+	for n, b := range blocks {
+		if p.Mode == Chuck && b.Has('A') {
+			return nil, fmt.Errorf("line %d: the program already uses the A axis", n+1)
+		}
+		b.Words = append([]gcode.Word{}, b.Words...)
+		hadF := b.Has('F')
+		m, moved, err := s.Apply(b)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if !moved {
+			// Y words outside motion, like G92, are rewritten all the same
+			b = wrapY(b, k, s.Scale(), p.Mode)
+			if hasMotion(b) {
+				outMotion = s.Motion
+			}
+			if hadF && !s.InverseTime {
+				b.Remove('F')
+				if b.Empty() {
+					continue
+				}
+			}
+			out = append(out, b)
+			continue
+		}
+		scale := s.Scale()
+		var pts []gcode.Axes
+		if (m.Motion == 2 || m.Motion == 3) && m.Plane != 18 {
+			pts = m.Points(p.Tolerance)
+		}
+
+		if pts == nil {
+			b = wrapY(b, k, scale, p.Mode)
+			if !hasMotion(b) && outMotion != s.Motion {
+				b.Words = append([]gcode.Word{{Letter: 'G', Value: float64(s.Motion)}}, b.Words...)
+			}
+			outMotion = s.Motion
+			if !s.InverseTime {
+				b.Remove('F')
+				if f := s.Feed * p.ratio(m.From, m.To, scale); m.Motion != 0 && math.Abs(f-lastF) > 1e-6 {
+					b.Set('F', f/scale)
+					lastF = f
+				}
+			}
+			out = append(out, b)
+			continue
+		}
+
+		from := m.From
+		for i, pt := range pts {
+			nb := gcode.Block{}
+			if i == 0 {
+				nb.Comment = b.Comment
+			}
+			nb.Words = append(nb.Words, gcode.Word{Letter: 'G', Value: 1})
+			for a, l := range gcode.AxisLetters {
+				v, prev := pt[a], from[a]
+				if !s.Absolute {
+					v -= prev
+				}
+				if math.Abs(pt[a]-prev) < 1e-9 && !(i == len(pts)-1 && b.Has(byte(l))) {
+					continue
+				}
+				letter := byte(l)
+				switch {
+				case a <= gcode.Z && a != gcode.Y:
+					v /= scale
+				case a == gcode.Y && p.Mode == Chuck:
+					letter, v = 'A', v*k
+				case a == gcode.Y:
+					v *= k / scale
+				}
+				nb.Words = append(nb.Words, gcode.Word{Letter: letter, Value: v})
+			}
+			if s.InverseTime {
+				// inverse time feeds cover the whole arc, split them over the pieces
+				f, _ := blocks[n].Get('F')
+				nb.Words = append(nb.Words, gcode.Word{Letter: 'F', Value: f * float64(len(pts))})
+			} else if f := s.Feed * p.ratio(from, pt, scale); math.Abs(f-lastF) > 1e-6 {
+				nb.Words = append(nb.Words, gcode.Word{Letter: 'F', Value: f / scale})
+				lastF = f
+			}
+			out = append(out, nb)
+			from = pt
+		}
+		outMotion = 1
+	}
+	return out, nil
+}
+
+// ratio returns how much longer the controller sees a move than the surface travel. Chuck
+// mode counts degrees as program units alongside X and Z, as GRBL style controllers do.
+func (p RotaryParams) ratio(from, to gcode.Axes, scale float64) float64 {
+	dx, dy, dz := to[gcode.X]-from[gcode.X], to[gcode.Y]-from[gcode.Y], to[gcode.Z]-from[gcode.Z]
+	surface := math.Sqrt(dx*dx+dy*dy+dz*dz) / scale
+	if surface < 1e-9 {
+		return 1
+	}
+	k := p.perMM()
+	seen := math.Sqrt(dx*dx+dy*dy*k*k+dz*dz) / scale
+	if p.Mode == Chuck {
+		seen = math.Sqrt((dx*dx+dz*dz)/(scale*scale) + dy*dy*k*k)
+	}
+	return seen / surface
+}
+
+// wrapY rewrites the Y word of a block in place
+func wrapY(b gcode.Block, k, scale float64, mode string) gcode.Block {
+	for i, w := range b.Words {
+		if w.Letter != 'Y' {
+			continue
+		}
+		if mode == Chuck {
+			b.Words[i] = gcode.Word{Letter: 'A', Value: w.Value * scale * k}
+		} else {
+			b.Words[i] = gcode.Word{Letter: 'Y', Value: w.Value * k}
+		}
+	}
+	return b
+}
+
+// hasMotion reports whether a block sets the motion mode itself
+func hasMotion(b gcode.Block) bool {
+	for _, w := range b.Words {
+		if w.Letter != 'G' {
+			continue
+		}
+		if v := math.Round(w.Value * 10); v <= 30 && int(v)%10 == 0 || v >= 382 && v <= 385 || v == 730 || v >= 800 && v <= 890 && int(v)%10 == 0 {
+			return true
+		}
+	}
+	return false
+}
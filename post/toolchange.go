@@ -0,0 +1,152 @@
+package post
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/redt1de/cnctools/gcode"
+)
+
+// tool length methods
+const (
+	WorkZ = "g10" // re-zero work Z with G10 L20 from the known height of the tool setter
+	TLO   = "tlo" // G43.1 tool length offset against a reference tool, live sender only
+)
+
+// Retract is the move to the top of the machine before travelling
+const Retract = "G53 G0 Z0 ; Retract"
+
+// ToolChangeParams configures the manual tool change macro. Positions are machine coordinates
+// apart from SetterZ.
+type ToolChangeParams struct {
+	Method    string
+	ParkX     float64 // where the tool is changed
+	ParkY     float64
+	SetterX   float64 // tool setter position
+	SetterY   float64
+	SetterZ   float64 // work Z of the tool setter top, for the G10 method
+	ProbeZ    float64 // machine Z probing starts from
+	Depth     float64 // furthest the probe travels down from ProbeZ
+	SeekFeed  float64
+	LatchFeed float64 // slow second touch
+	PullOff   float64 // lift between the two touches
+}
+
+// DefaultToolChangeParams returns a G10 re-zero with 50mm of probe travel, parked at machine
+// X0 Y0
+func DefaultToolChangeParams() ToolChangeParams {
+	return ToolChangeParams{
+		Method:    WorkZ,
+		Depth:     50,
+		SeekFeed:  100,
+		LatchFeed: 20,
+		PullOff:   2,
+	}
+}
+
+// Validate checks the parameters
+func (p ToolChangeParams) Validate() error {
+	switch {
+	case p.Method != WorkZ && p.Method != TLO:
+		return fmt.Errorf("unknown tool length method %q", p.Method)
+	case p.Depth <= 0:
+		return fmt.Errorf("probe depth must be positive")
+	case p.SeekFeed <= 0 || p.LatchFeed <= 0:
+		return fmt.Errorf("probe feed rates must be positive")
+	case p.PullOff <= 0 || p.PullOff >= p.Depth:
+		return fmt.Errorf("pull off must be positive and less than the probe depth")
+	}
+	return nil
+}
+
+// Park returns the lines that stop the spindle and take the machine to the change position
+func (p ToolChangeParams) Park(tool int) []string {
+	return []string{
+		"M5 ; Stop spindle",
+		Retract,
+		fmt.Sprintf("G53 G0 X%s Y%s ; Park for tool %d", gcode.FormatNumber(p.ParkX), gcode.FormatNumber(p.ParkY), tool),
+	}
+}
+
+// Probe returns the lines that touch the tool off on the setter, twice, leaving it touching.
+// They end in G90.
+func (p ToolChangeParams) Probe() []string {
+	lines := []string{fmt.Sprintf("G53 G0 X%s Y%s ; Tool setter", gcode.FormatNumber(p.SetterX), gcode.FormatNumber(p.SetterY))}
+	if p.ProbeZ != 0 {
+		lines = append(lines, fmt.Sprintf("G53 G0 Z%s", gcode.FormatNumber(p.ProbeZ)))
+	}
+	return append(lines,
+		"G91",
+		fmt.Sprintf("G38.2 Z%s F%s ; Find the setter", gcode.FormatNumber(-p.Depth), gcode.FormatNumber(p.SeekFeed)),
+		fmt.Sprintf("G0 Z%s", gcode.FormatNumber(p.PullOff)),
+		fmt.Sprintf("G38.2 Z%s F%s ; Touch slowly", gcode.FormatNumber(-2*p.PullOff), gcode.FormatNumber(p.LatchFeed)),
+		"G90",
+	)
+}
+
+// Macro returns the whole change for a program, parking, pausing for the swap, probing and
+// re-zeroing work Z from the setter height
+func (p ToolChangeParams) Macro(tool int) []string {
+	lines := p.Park(tool)
+	lines = append(lines, fmt.Sprintf("M0 ; Change to tool %d and resume", tool))
+	lines = append(lines, p.Probe()...)
+	return append(lines,
+		fmt.Sprintf("G10 L20 P0 Z%s ; Set work Z for the new tool", gcode.FormatNumber(p.SetterZ)),
+		Retract,
+	)
+}
+
+// ToolChange replaces every M6 in a program with the manual change macro. The tool is the T
+// word of the block or the last one before it. The macro runs in millimetres and absolute
+// mode, the program modes are put back after it. Only the G10 method works without the live
+// sender, G43.1 needs the probed length.
+func ToolChange(blocks []gcode.Block, p ToolChangeParams) ([]gcode.Block, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Method != WorkZ {
+		return nil, fmt.Errorf("the %s method needs the live sender, the offset comes from the probe", p.Method)
+	}
+	s := gcode.NewState()
+	out := []gcode.Block{}
+	tool := 0
+	for n, b := range blocks {
+		if _, _, err := s.Apply(b); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if t, ok := b.Get('T'); ok {
+			tool = int(t)
+		}
+		if !b.HasCode('M', 6) {
+			out = append(out, b)
+			continue
+		}
+		b.Words = append([]gcode.Word{}, b.Words...)
+		b.RemoveCode('M', 6)
+		b.Remove('T')
+		if len(b.Words) > 0 {
+			out = append(out, gcode.Block{Words: b.Words})
+		}
+		enter, leave := MacroModes(s)
+		lines := append(append(enter, p.Macro(tool)...), leave...)
+		macro, err := gcode.ParseString(strings.Join(lines, "\n"))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, gcode.Block{Comment: fmt.Sprintf("; Tool change to T%d", tool)})
+		out = append(out, macro...)
+	}
+	return out, nil
+}
+
+// MacroModes returns the lines that switch a program in the state s to millimetres and
+// absolute mode for a macro, and the lines that switch it back after
+func MacroModes(s *gcode.State) (enter, leave []string) {
+	if s.Inches {
+		enter, leave = append(enter, "G21"), append(leave, "G20")
+	}
+	if !s.Absolute {
+		enter, leave = append(enter, "G90"), append(leave, "G91")
+	}
+	return enter, leave
+}
@@ -0,0 +1,370 @@
+package post
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/redt1de/cnctools/gcode"
+)
+
+// Affine maps X and Y as x' = A*x + B*y + C, y' = D*x + E*y + F
+type Affine struct {
+	A, B, C float64
+	D, E, F float64
+}
+
+// Identity leaves positions alone
+func Identity() Affine {
+	return Affine{A: 1, E: 1}
+}
+
+// Skew corrects a machine whose Y axis leans angle degrees towards +X, so a commanded
+// (x, y) lands at (x + y sin, y cos). The correction is the inverse of that.
+func Skew(angle float64) Affine {
+	a := angle * math.Pi / 180
+	return Affine{A: 1, B: -math.Tan(a), E: 1 / math.Cos(a)}
+}
+
+// Translate moves positions by dx, dy
+func Translate(dx, dy float64) Affine {
+	return Affine{A: 1, C: dx, E: 1, F: dy}
+}
+
+// Rotate turns positions angle degrees counter clockwise about cx, cy
+func Rotate(angle, cx, cy float64) Affine {
+	a := angle * math.Pi / 180
+	c, s := math.Cos(a), math.Sin(a)
+	return Translate(-cx, -cy).Then(Affine{A: c, B: -s, D: s, E: c}).Then(Translate(cx, cy))
+}
+
+// Scale scales positions by sx, sy about cx, cy, negative factors mirror
+func Scale(sx, sy, cx, cy float64) Affine {
+	return Translate(-cx, -cy).Then(Affine{A: sx, E: sy}).Then(Translate(cx, cy))
+}
+
+// Mirror flips X about the line x = cx, Y about y = cy, or both
+func Mirror(x, y bool, cx, cy float64) Affine {
+	sx, sy := 1.0, 1.0
+	if x {
+		sx = -1
+	}
+	if y {
+		sy = -1
+	}
+	return Scale(sx, sy, cx, cy)
+}
+
+// Then returns the transform that applies m and then n
+func (m Affine) Then(n Affine) Affine {
+	return Affine{
+		A: n.A*m.A + n.B*m.D, B: n.A*m.B + n.B*m.E, C: n.A*m.C + n.B*m.F + n.C,
+		D: n.D*m.A + n.E*m.D, E: n.D*m.B + n.E*m.E, F: n.D*m.C + n.E*m.F + n.F,
+	}
+}
+
+// Apply maps a point
+func (m Affine) Apply(x, y float64) (float64, float64) {
+	return m.A*x + m.B*y + m.C, m.D*x + m.E*y + m.F
+}
+
+// Linear maps a vector, leaving out the translation
+func (m Affine) Linear(x, y float64) (float64, float64) {
+	return m.A*x + m.B*y, m.D*x + m.E*y
+}
+
+// Det returns the determinant, negative when the transform mirrors
+func (m Affine) Det() float64 {
+	return m.A*m.E - m.B*m.D
+}
+
+// Conformal reports whether the transform keeps circles circular, i.e. it only rotates,
+// mirrors, moves and scales uniformly
+func (m Affine) Conformal() bool {
+	const eps = 1e-9
+	return (math.Abs(m.A-m.E) < eps && math.Abs(m.B+m.D) < eps) || (math.Abs(m.A+m.E) < eps && math.Abs(m.B-m.D) < eps)
+}
+
+// Transform applies m to the X and Y of a program. XY arcs stay arcs under conformal
+// transforms, with their direction swapped when m mirrors. Otherwise they are broken into
+// lines within tol, or rejected when tol is 0. Arcs in the XZ and YZ planes stay arcs only
+// when m just moves them. Machine coordinate moves and homing are passed through untouched.
+// A program that moves relative to wherever it starts has its start taken as X0 Y0, and a
+// rapid to where m puts that is added before its first move.
+func Transform(blocks []gcode.Block, m Affine, tol float64) ([]gcode.Block, error) {
+	if tol < 0 {
+		return nil, fmt.Errorf("tolerance can not be negative")
+	}
+	if math.Abs(m.Det()) < 1e-12 {
+		return nil, fmt.Errorf("the transform flattens the program")
+	}
+	s := gcode.NewState()
+	out := []gcode.Block{}
+	outMotion := -1
+	placed := false // whether the program start has been put where m moves it
+	for n, b := range blocks {
+		b.Words = append([]gcode.Word{}, b.Words...)
+		mv, moved, err := s.Apply(b)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		scale := s.Scale()
+		if s.Known[gcode.X] && s.Known[gcode.Y] {
+			placed = true
+		}
+		if hasMotion(b) {
+			outMotion = s.Motion
+		}
+		touchesXY := b.Has('X') || b.Has('Y')
+		if b.HasCode('G', 92) && touchesXY {
+			// the new program position is the transformed one
+			if !s.Known[gcode.X] || !s.Known[gcode.Y] {
+				return nil, fmt.Errorf("line %d: G92 needs both X and Y once the program is transformed", n+1)
+			}
+			x, y := m.Apply(s.Pos[gcode.X], s.Pos[gcode.Y])
+			out = append(out, replaceXY(b, x/scale, y/scale, nil))
+			continue
+		}
+		if !moved || !touchesXY && mv.Motion < 2 {
+			out = append(out, b)
+			continue
+		}
+		if s.Absolute && (!s.Known[gcode.X] || !s.Known[gcode.Y]) {
+			return nil, fmt.Errorf("line %d: moves in X or Y before both are known, start the program with a move to an XY position", n+1)
+		}
+		if !placed {
+			if x, y := m.Apply(0, 0); math.Abs(x) > 1e-9 || math.Abs(y) > 1e-9 {
+				out = append(out, gcode.Block{
+					Words:   []gcode.Word{{Letter: 'G', Value: 0}, {Letter: 'X', Value: x / scale}, {Letter: 'Y', Value: y / scale}},
+					Comment: "; Move to the transformed start",
+				})
+				outMotion = 0
+			}
+			placed = true
+		}
+
+		arc := mv.Motion == 2 || mv.Motion == 3
+		if arc && !keepsArc(m, mv.Plane, s.ArcAbsolute) {
+			if tol == 0 {
+				return nil, fmt.Errorf("line %d: the transform turns the arc into an ellipse, break arcs into lines", n+1)
+			}
+			// break the arc into lines and transform each
+			from := mv.From
+			pts := mv.Points(tol)
+			for i, pt := range pts {
+				nb := gcode.Block{Words: []gcode.Word{{Letter: 'G', Value: 1}}}
+				if i == 0 {
+					nb.Comment = b.Comment
+				}
+				x, y := point(m, from, pt, s.Absolute)
+				nb.Words = append(nb.Words, gcode.Word{Letter: 'X', Value: x / scale}, gcode.Word{Letter: 'Y', Value: y / scale})
+				for a := gcode.Z; a <= gcode.C; a++ {
+					if math.Abs(pt[a]-from[a]) > 1e-9 {
+						v := pt[a]
+						if !s.Absolute {
+							v -= from[a]
+						}
+						nb.Words = append(nb.Words, gcode.Word{Letter: gcode.AxisLetters[a], Value: v / axisScale(a, scale)})
+					}
+				}
+				if f, ok := b.Get('F'); ok && (i == 0 || s.InverseTime) {
+					if s.InverseTime {
+						f *= float64(len(pts))
+					}
+					nb.Words = append(nb.Words, gcode.Word{Letter: 'F', Value: f})
+				}
+				out = append(out, nb)
+				from = pt
+			}
+			outMotion = 1
+			continue
+		}
+
+		x, y := point(m, mv.From, mv.To, s.Absolute)
+		var centre []float64
+		if arc && mv.Plane == 17 {
+			cx, cy := mv.Centre[0], mv.Centre[1]
+			if s.ArcAbsolute {
+				cx, cy = m.Apply(cx, cy)
+			} else {
+				cx, cy = m.Linear(cx-mv.From[gcode.X], cy-mv.From[gcode.Y])
+			}
+			centre = []float64{cx / scale, cy / scale}
+			if r, ok := b.Get('R'); ok {
+				centre = []float64{r * math.Sqrt(math.Abs(m.Det()))}
+			}
+		}
+		nb := replaceXY(b, x/scale, y/scale, centre)
+		if arc && mv.Plane == 17 && m.Det() < 0 {
+			// a mirror image runs the other way round
+			motion := 5 - mv.Motion
+			nb.RemoveCode('G', float64(mv.Motion))
+			nb.Words = append([]gcode.Word{{Letter: 'G', Value: float64(motion)}}, nb.Words...)
+			out = append(out, nb)
+			outMotion = motion
+			continue
+		}
+		if !hasMotion(nb) && outMotion != s.Motion {
+			nb.Words = append([]gcode.Word{{Letter: 'G', Value: float64(s.Motion)}}, nb.Words...)
+		}
+		outMotion = s.Motion
+		out = append(out, nb)
+	}
+	return out, nil
+}
+
+// keepsArc reports whether an arc in the plane is still an arc the block can describe after m
+func keepsArc(m Affine, plane int, arcAbsolute bool) bool {
+	const eps = 1e-9
+	switch plane {
+	case 18:
+		return math.Abs(m.A-1) < eps && math.Abs(m.B) < eps && !arcAbsolute
+	case 19:
+		return math.Abs(m.E-1) < eps && math.Abs(m.D) < eps && !arcAbsolute
+	}
+	return m.Conformal()
+}
+
+// point returns the transformed X and Y words of a move, an absolute position or a relative step
+func point(m Affine, from, to gcode.Axes, absolute bool) (float64, float64) {
+	if absolute {
+		return m.Apply(to[gcode.X], to[gcode.Y])
+	}
+	return m.Linear(to[gcode.X]-from[gcode.X], to[gcode.Y]-from[gcode.Y])
+}
+
+// replaceXY swaps the X and Y words of a block for new ones where the first of them was, and
+// the I and J or R words for centre when it is set
+func replaceXY(b gcode.Block, x, y float64, centre []float64) gcode.Block {
+	words := []gcode.Word{}
+	xy, ij := false, false
+	for _, w := range b.Words {
+		switch {
+		case w.Letter == 'X' || w.Letter == 'Y':
+			if !xy {
+				words = append(words, gcode.Word{Letter: 'X', Value: x}, gcode.Word{Letter: 'Y', Value: y})
+				xy = true
+			}
+		case centre != nil && (w.Letter == 'I' || w.Letter == 'J' || w.Letter == 'R'):
+			if !ij {
+				if len(centre) == 1 {
+					words = append(words, gcode.Word{Letter: 'R', Value: centre[0]})
+				} else {
+					words = append(words, gcode.Word{Letter: 'I', Value: centre[0]}, gcode.Word{Letter: 'J', Value: centre[1]})
+				}
+				ij = true
+			}
+		default:
+			words = append(words, w)
+		}
+	}
+	if !xy {
+		words = append(words, gcode.Word{Letter: 'X', Value: x}, gcode.Word{Letter: 'Y', Value: y})
+	}
+	b.Words = words
+	return b
+}
+
+// Tile repeats a program on a grid of cols by rows copies, dx and dy apart, each transformed
+// by m first. Program ends are dropped from the copies and one is added after the last. A
+// program that moves relative to its start rapids back to it between copies, at whatever
+// height it finished.
+func Tile(blocks []gcode.Block, m Affine, cols, rows int, dx, dy, tol float64) ([]gcode.Block, error) {
+	if cols < 1 || rows < 1 {
+		return nil, fmt.Errorf("at least one column and row are needed")
+	}
+	body := []gcode.Block{}
+	end := false
+	for _, b := range blocks {
+		if b.Raw == "%" {
+			continue
+		}
+		if b.HasCode('M', 2) || b.HasCode('M', 30) {
+			end = true
+			b.Words = append([]gcode.Word{}, b.Words...)
+			b.RemoveCode('M', 2)
+			b.RemoveCode('M', 30)
+			if len(b.Words) == 0 {
+				continue
+			}
+		}
+		body = append(body, b)
+	}
+
+	// where a relative program finishes, compared to its start
+	s := gcode.NewState()
+	for n, b := range body {
+		if _, _, err := s.Apply(b); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+	}
+	relative := !s.Known[gcode.X] || !s.Known[gcode.Y]
+
+	out := []gcode.Block{}
+	var prev Affine
+	for j := 0; j < rows; j++ {
+		for i := 0; i < cols; i++ {
+			mk := m.Then(Translate(float64(i)*dx, float64(j)*dy))
+			if relative && (i > 0 || j > 0) {
+				x, y := prev.Apply(s.Pos[gcode.X], s.Pos[gcode.Y])
+				back := gcode.Block{
+					Words:   []gcode.Word{{Letter: 'G', Value: 91}, {Letter: 'G', Value: 0}, {Letter: 'X', Value: -x / s.Scale()}, {Letter: 'Y', Value: -y / s.Scale()}},
+					Comment: "; Back to the start",
+				}
+				out = append(out, back)
+				if s.Absolute {
+					out = append(out, gcode.Block{Words: []gcode.Word{{Letter: 'G', Value: 90}}})
+				}
+			}
+			out = append(out, gcode.Block{Comment: fmt.Sprintf("; Copy %d,%d", i+1, j+1)})
+			part, err := Transform(body, mk, tol)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, part...)
+			prev = mk
+		}
+	}
+	if end {
+		out = append(out, gcode.Block{Words: []gcode.Word{{Letter: 'M', Value: 30}}, Comment: "; End program"})
+	}
+	return out, nil
+}
+
+// CoordinateRotation has the controller turn a program angle degrees counter clockwise about
+// cx, cy with G68, for controllers that have it, leaving the program itself alone. G68 goes
+// before the first move and G69 cancels it before the program end.
+func CoordinateRotation(blocks []gcode.Block, angle, cx, cy float64) []gcode.Block {
+	rotate := gcode.Block{
+		Words:   []gcode.Word{{Letter: 'G', Value: 68}, {Letter: 'X', Value: cx}, {Letter: 'Y', Value: cy}, {Letter: 'R', Value: angle}},
+		Comment: "; Rotate to the stock",
+	}
+	cancel := gcode.Block{Words: []gcode.Word{{Letter: 'G', Value: 69}}, Comment: "; Cancel rotation"}
+	out := []gcode.Block{}
+	started, ended := false, false
+	for _, b := range blocks {
+		if !started && (hasMotion(b) || hasAxis(b)) {
+			out = append(out, rotate)
+			started = true
+		}
+		if started && !ended && (b.HasCode('M', 2) || b.HasCode('M', 30)) {
+			out = append(out, cancel)
+			ended = true
+		}
+		out = append(out, b)
+	}
+	if started && !ended {
+		out = append(out, cancel)
+	}
+	return out
+}
+
+// hasAxis reports whether a block has an axis word
+func hasAxis(b gcode.Block) bool {
+	for _, w := range b.Words {
+		if strings.IndexByte(gcode.AxisLetters, w.Letter) >= 0 {
+			return true
+		}
+	}
+	return false
+}
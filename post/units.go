@@ -0,0 +1,61 @@
+package post
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/redt1de/cnctools/gcode"
+)
+
+// lengthLetters are the words holding lengths, rotary axes and unitless words like P, S and
+// T are left alone
+const lengthLetters = "XYZIJKRQ"
+
+// mmPerInch converts between G20 and G21 values
+const mmPerInch = 25.4
+
+// Units rewrites a program into inches, or millimetres when inches is false. G20 and G21 are
+// replaced, lengths and feed rates are scaled, inverse time feeds are left alone. A program
+// that relies on the controller starting in millimetres gets the new units code before its
+// first length.
+func Units(blocks []gcode.Block, inches bool) ([]gcode.Block, error) {
+	target, code := 1.0, 21.0
+	if inches {
+		target, code = mmPerInch, 20
+	}
+	s := gcode.NewState()
+	out := []gcode.Block{}
+	declared := false
+	for n, b := range blocks {
+		if _, _, err := s.Apply(b); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if b.Raw != "" {
+			out = append(out, b)
+			continue
+		}
+		b.Words = append([]gcode.Word{}, b.Words...)
+		if b.HasCode('G', 20) || b.HasCode('G', 21) {
+			b.RemoveCode('G', 20)
+			b.RemoveCode('G', 21)
+			b.Words = append([]gcode.Word{{Letter: 'G', Value: code}}, b.Words...)
+			declared = true
+		}
+		k := s.Scale() / target
+		lengths := false
+		for i, w := range b.Words {
+			if strings.IndexByte(lengthLetters, w.Letter) >= 0 || w.Letter == 'F' && !s.InverseTime {
+				lengths = true
+				if k != 1 {
+					b.Words[i] = gcode.Word{Letter: w.Letter, Value: w.Value * k}
+				}
+			}
+		}
+		if lengths && !declared {
+			out = append(out, gcode.Block{Words: []gcode.Word{{Letter: 'G', Value: code}}})
+			declared = true
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
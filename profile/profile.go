@@ -0,0 +1,110 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Profile holds the calibration results for one machine so generators can pick them up
+type Profile struct {
+	Name    string  `json:"name"`
+	Machine Machine `json:"machine"`
+	Laser   Laser   `json:"laser"`
+}
+
+// Machine holds the mechanical calibration results
+type Machine struct {
+	Backlash   map[string]float64 `json:"backlash,omitempty"`   // lost motion on reversal per axis letter
+	Skew       float64            `json:"skew,omitempty"`       // degrees the Y axis leans towards +X
+	Controller string             `json:"controller,omitempty"` // gcode dialect programs are written in
+}
+
+// Laser holds the laser calibration results
+type Laser struct {
+	FocusZ       float64 `json:"focus_z,omitempty"`       // work Z that puts the beam in focus on a surface at Z0
+	Kerf         float64 `json:"kerf,omitempty"`          // width of material removed by a through cut
+	BeamDiameter float64 `json:"beam_diameter,omitempty"` // effective spot size when engraving
+}
+
+// DefaultBeamDiameter is assumed when the beam diameter has not been measured
+const DefaultBeamDiameter = 0.2
+
+// Beam returns the measured beam diameter, or DefaultBeamDiameter
+func (l Laser) Beam() float64 {
+	if l.BeamDiameter > 0 {
+		return l.BeamDiameter
+	}
+	return DefaultBeamDiameter
+}
+
+// ConfigDir returns the cnctools configuration directory
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no config directory: %v", err)
+	}
+	return filepath.Join(dir, "cnctools"), nil
+}
+
+// Dir returns the directory profiles are stored in
+func Dir() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "profiles"), nil
+}
+
+// Path returns the file a profile is stored in, a name containing a path separator or ending
+// in .json is used as the file itself
+func Path(name string) (string, error) {
+	if filepath.Ext(name) == ".json" || filepath.Base(name) != name {
+		return name, nil
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// Load reads a profile, a profile that was never saved loads empty
+func Load(name string) (*Profile, error) {
+	path, err := Path(name)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{Name: name}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %v", err)
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("bad profile %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Save writes the profile back to its file
+func (p *Profile) Save() error {
+	path, err := Path(p.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %v", err)
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write profile: %v", err)
+	}
+	return nil
+}
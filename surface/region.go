@@ -0,0 +1,155 @@
+package surface
+
+import (
+	"math"
+	"sort"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// centreLevel is the offset from the region boundary to the edge of the area the tool centre
+// covers, negative when the cutter hangs past the boundary
+func (p Params) centreLevel() float64 {
+	return p.ToolDiameter/2 - p.ToolDiameter*p.Overhang/100
+}
+
+// centreField samples the distance to the region boundary far enough out for the overhang
+func (p Params) centreField() *geom.DistanceField {
+	res := math.Max(p.ToolDiameter/25, 0.05)
+	return geom.NewDistanceField(p.Region, res, math.Max(0, -p.centreLevel())+p.ToolDiameter)
+}
+
+// regionPaths returns the paths of one pass clipped to the region. Generate links them at depth
+// when the move stays inside the area the tool centre may cover, and lifts over anything else.
+func (p Params) regionPaths(pass int, field *geom.DistanceField) []geom.Path {
+	level := p.centreLevel()
+	right := p.climbRight(pass)
+	var paths []geom.Path
+	switch p.Strategy {
+	case RasterX, RasterY:
+		// rows step towards +Y for RasterX, so rows along -X have the uncut side on their right.
+		// RasterY rows step towards +X, where rows along +Y have it on their right.
+		alongX := p.Strategy == RasterX
+		back := right != !alongX
+		// finish one area before moving to the nearest next one
+		areas := [][]geom.Path{}
+		for _, s := range field.Offset(level) {
+			if rows := clippedRows([]geom.Shape{s}, p.StepOver, alongX, p.Direction == Mixed, back); len(rows) > 0 {
+				areas = append(areas, rows)
+			}
+		}
+		pos := geom.Point{}
+		for len(areas) > 0 {
+			bi := 0
+			for i, a := range areas {
+				if a[0][0].Dist(pos) < areas[bi][0][0].Dist(pos) {
+					bi = i
+				}
+			}
+			rows := areas[bi]
+			areas = append(areas[:bi], areas[bi+1:]...)
+			paths = append(paths, rows...)
+			last := rows[len(rows)-1]
+			pos = last[len(last)-1]
+		}
+	default:
+		paths = offsetLoops(field, level, p.StepOver, p.ToolDiameter/2, right)
+	}
+	return paths
+}
+
+// clippedRows cuts evenly spaced rows through the shapes. Rows step towards +Y (or +X when
+// running along Y), every row runs the same way, reversed when back is set, unless zigzag
+// alternates them.
+func clippedRows(shapes []geom.Shape, step float64, alongX, zigzag, back bool) []geom.Path {
+	// work along X, transposing the shapes for rows along Y
+	flip := func(p geom.Point) geom.Point {
+		if alongX {
+			return p
+		}
+		return geom.Point{X: p.Y, Y: p.X}
+	}
+	rings := []geom.Path{}
+	b := geom.EmptyRect()
+	for _, s := range shapes {
+		for _, r := range s.Rings() {
+			t := make(geom.Path, len(r))
+			for i, pt := range r {
+				t[i] = flip(pt)
+			}
+			rings = append(rings, t)
+			b = b.Union(t.Bounds())
+		}
+	}
+	if b.Empty() {
+		return nil
+	}
+	// keep the outer rows a hair inside so they still cross the boundary
+	eps := 1e-6 * math.Max(1, b.Height())
+	n := int(math.Ceil(b.Height()/step - 1e-9))
+	paths := []geom.Path{}
+	for i := 0; i <= n; i++ {
+		y := b.Min.Y + eps
+		if n > 0 {
+			y = b.Min.Y + eps + (b.Height()-2*eps)*float64(i)/float64(n)
+		}
+		xs := geom.ScanLine(rings, y)
+		sort.Float64s(xs)
+		row := []geom.Path{}
+		for k := 0; k+1 < len(xs); k += 2 {
+			if xs[k+1]-xs[k] < 1e-3 {
+				continue
+			}
+			row = append(row, geom.Path{flip(geom.Point{X: xs[k], Y: y}), flip(geom.Point{X: xs[k+1], Y: y})})
+		}
+		if rev := (zigzag && i%2 == 1) || (!zigzag && back); rev {
+			for l, r := 0, len(row)-1; l < r; l, r = l+1, r-1 {
+				row[l], row[r] = row[r], row[l]
+			}
+			for k := range row {
+				row[k] = row[k].Reverse()
+			}
+		}
+		paths = append(paths, row...)
+	}
+	return paths
+}
+
+// offsetLoops returns closed loops parallel to the region boundary from the outside in, with a
+// last loop close to the middle of each area so no island is left uncut. Loops run counter
+// clockwise around the uncut material unless cw is set.
+func offsetLoops(field *geom.DistanceField, level, step, radius float64, cw bool) []geom.Path {
+	paths := []geom.Path{}
+	pos := geom.Point{}
+	add := func(loops []geom.Path) {
+		if cw {
+			for i := range loops {
+				loops[i] = loops[i].Reverse()
+			}
+		}
+		for _, l := range geom.OrderPaths(loops, true, pos) {
+			paths = append(paths, append(l, l[0]))
+			pos = l[0]
+		}
+	}
+	for d := level; ; d += step {
+		loops := field.Contours(d)
+		if len(loops) == 0 {
+			break
+		}
+		// areas that vanish before the next level get a last loop near their middle
+		extra := []geom.Path{}
+		for _, s := range geom.Nest(loops) {
+			if _, top := field.Max(s); top < d+step && top-d > radius*0.9 {
+				for _, l := range field.Contours(top - radius*0.9) {
+					if s.Contains(l[0]) {
+						extra = append(extra, l)
+					}
+				}
+			}
+		}
+		add(loops)
+		add(extra)
+	}
+	return paths
+}
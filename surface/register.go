@@ -0,0 +1,165 @@
+package surface
+
+import (
+	"fmt"
+
+	"github.com/redt1de/cnctools/drill"
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/pocket"
+	"github.com/redt1de/cnctools/util"
+)
+
+// registration feature styles
+const (
+	Fence  = "fence"  // L shaped fence left standing along the two edges at the corner
+	Pocket = "pocket" // square recess below the surface, open to the two edges at the corner
+)
+
+// board corners
+var corners = map[string][2]bool{"bl": {false, false}, "br": {true, false}, "tl": {false, true}, "tr": {true, true}}
+
+// Registration is an alignment feature at one corner of a rectangular board. Stock pushed into
+// the corner of the fence, the pocket walls or the dowel pins sits square at a known position.
+type Registration struct {
+	Style  string  // Fence, Pocket or "" for dowels alone
+	Corner string  // bl, br, tl or tr
+	Size   float64 // fence arm length, 0 for the full edges, or the side of the pocket
+	Width  float64 // fence width
+	Depth  float64 // pocket depth below the surfaced floor
+
+	Dowels        int     // dowel holes along each edge, 0 for none
+	DowelDiameter float64 // drill diameter, the program pauses for the drill change
+	DowelSpacing  float64 // distance between holes, the first hole is this far from the corner
+	DowelInset    float64 // distance from the board edges to the hole centres
+	DowelDepth    float64 // hole depth below the surfaced floor
+}
+
+// active reports whether any registration feature is set
+func (r Registration) active() bool {
+	return r.Style != "" || r.Dowels > 0
+}
+
+func (r Registration) validate(p Params) error {
+	if _, ok := corners[r.Corner]; !ok {
+		return fmt.Errorf("unknown corner %q, use bl, br, tl or tr", r.Corner)
+	}
+	switch {
+	case r.Style != Fence && r.Style != Pocket && r.Style != "":
+		return fmt.Errorf("unknown registration style %q", r.Style)
+	case r.Style == Fence && (r.Width <= 0 || 2*r.Width >= min(p.Width, p.Height)):
+		return fmt.Errorf("fence width must be positive and under half the board")
+	case r.Size < 0 || r.Size > min(p.Width, p.Height):
+		return fmt.Errorf("registration size must fit on the board")
+	case r.Style == Pocket && (r.Size <= p.ToolDiameter || r.Depth <= 0):
+		return fmt.Errorf("pocket needs a size larger than the tool and a positive depth")
+	case r.Dowels < 0:
+		return fmt.Errorf("dowel count can not be negative")
+	case r.Dowels > 0 && (r.DowelDiameter <= 0 || r.DowelSpacing <= 0 || r.DowelDepth <= 0):
+		return fmt.Errorf("dowels need a diameter, spacing and depth")
+	case r.Dowels > 0 && float64(r.Dowels)*r.DowelSpacing > min(p.Width, p.Height):
+		return fmt.Errorf("dowel holes run off the board")
+	}
+	return nil
+}
+
+// place maps a point given relative to the registration corner, with X and Y pointing along
+// the board edges away from it, onto the board
+func (p Params) place(pt geom.Point) geom.Point {
+	c := corners[p.Registration.Corner]
+	if c[0] {
+		pt.X = p.Width - pt.X
+	}
+	if c[1] {
+		pt.Y = p.Height - pt.Y
+	}
+	return pt.Add(p.Origin)
+}
+
+// withFence returns the parameters with the board turned into a region that leaves the fence
+// standing. The fence is grown so that, once the region is offset for the overhang, the cutter
+// stays outside the fence while still hanging past the open board edges.
+func (p Params) withFence() Params {
+	r := p.Registration
+	if r.Style != Fence {
+		return p
+	}
+	grow := p.ToolDiameter * p.Overhang / 100
+	lx, ly := p.Width, p.Height
+	if r.Size > 0 {
+		lx, ly = min(r.Size+grow, p.Width), min(r.Size+grow, p.Height)
+	}
+	w := r.Width + grow
+	// the board with an L notched out of the corner at the origin, counter clockwise
+	local := geom.Path{}
+	if lx < p.Width {
+		local = append(local, geom.Point{X: lx, Y: 0}, geom.Point{X: p.Width, Y: 0})
+	} else {
+		local = append(local, geom.Point{X: p.Width, Y: w})
+	}
+	local = append(local, geom.Point{X: p.Width, Y: p.Height})
+	if ly < p.Height {
+		local = append(local, geom.Point{X: 0, Y: p.Height}, geom.Point{X: 0, Y: ly})
+	} else {
+		local = append(local, geom.Point{X: w, Y: p.Height})
+	}
+	local = append(local, geom.Point{X: w, Y: ly}, geom.Point{X: w, Y: w})
+	if lx < p.Width {
+		local = append(local, geom.Point{X: lx, Y: w})
+	}
+	poly := geom.Path{}
+	for _, pt := range local {
+		if len(poly) == 0 || poly[len(poly)-1].Dist(p.place(pt)) > 1e-9 {
+			poly = append(poly, p.place(pt))
+		}
+	}
+	p.Region = []geom.Shape{{Outer: poly.Orient(true)}}
+	return p
+}
+
+// cut appends the pocket and dowel holes of the registration feature, the spindle is stopped
+// and the tool is at safe height before and after
+func (r Registration) cut(g *util.Gcode, p Params) error {
+	if r.Style == Pocket {
+		c := pocket.DefaultParams()
+		c.ToolDiameter, c.StepOver = p.ToolDiameter, p.StepOver/p.ToolDiameter*100
+		c.Top, c.Depth, c.StepDown = -p.Depth, r.Depth, p.StepDown
+		c.Feed, c.PlungeFeed, c.Spindle, c.SafeZ = p.Feed, p.PlungeFeed, p.Spindle, p.SafeZ
+		// run the pocket past the two board edges so it is open on those sides
+		d := p.ToolDiameter
+		sq := geom.Path{{X: -d, Y: -d}, {X: r.Size, Y: -d}, {X: r.Size, Y: r.Size}, {X: -d, Y: r.Size}}
+		for i := range sq {
+			sq[i] = p.place(sq[i])
+		}
+		g.Add("; Registration pocket")
+		if err := pocket.Cut(g, []geom.Shape{{Outer: sq.Orient(true)}}, c); err != nil {
+			return fmt.Errorf("registration pocket: %v", err)
+		}
+	}
+	if r.Dowels > 0 {
+		holes := []drill.Hole{}
+		for i := 1; i <= r.Dowels; i++ {
+			along := float64(i) * r.DowelSpacing
+			holes = append(holes,
+				drill.Hole{X: along, Y: r.DowelInset, Diameter: r.DowelDiameter},
+				drill.Hole{X: r.DowelInset, Y: along, Diameter: r.DowelDiameter})
+		}
+		for i, h := range holes {
+			pt := p.place(geom.Point{X: h.X, Y: h.Y})
+			holes[i].X, holes[i].Y = pt.X, pt.Y
+		}
+		d := drill.Params{
+			Cycle:   drill.Peck,
+			Depth:   p.Depth + r.DowelDepth,
+			Retract: 1,
+			SafeZ:   p.SafeZ,
+			Peck:    r.DowelDiameter,
+			Feed:    p.PlungeFeed,
+			Spindle: p.Spindle,
+		}
+		g.Add("M0 ; Change tool to a %.3fmm drill and resume", r.DowelDiameter)
+		if err := drill.Cut(g, [][]drill.Hole{drill.Optimize(holes, p.place(geom.Point{}))}, d); err != nil {
+			return fmt.Errorf("dowel holes: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package surface
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/pocket"
+	"github.com/redt1de/cnctools/util"
+)
+
+// surfacing strategies
+const (
+	Spiral  = "spiral"   // rectangular spiral from the edges inwards
+	RasterX = "raster-x" // rows along X, stepping over in Y
+	RasterY = "raster-y" // rows along Y, stepping over in X
+)
+
+// cut directions
+const (
+	Conventional = "conventional"
+	Climb        = "climb"
+	Mixed        = "mixed" // raster rows zig-zag, spiral passes alternate winding
+)
+
+// Params configures a surfacing operation. The board runs from Origin to Origin plus Width and
+// Height, or covers Region when it is set, with the top of the board at Z0.
+type Params struct {
+	Origin       geom.Point
+	Width        float64
+	Height       float64
+	Region       []geom.Shape // surface only inside these shapes instead of the rectangle
+	ToolDiameter float64
+	StepOver     float64 // distance between neighbouring rows or loops
+	Depth        float64 // total depth removed
+	StepDown     float64 // max depth per pass
+	Overhang     float64 // percent of the tool diameter hanging past the board edges on the outer pass
+	Strategy     string
+	Registration Registration
+	Direction    string // Climb, Conventional or Mixed
+	SpindleCCW   bool   // spindle runs counter clockwise (M4), which swaps climb and conventional
+	Feed         float64
+	PlungeFeed   float64
+	Spindle      float64
+	SafeZ        float64
+}
+
+// DefaultParams returns settings for a 16mm surfacing bit
+func DefaultParams() Params {
+	return Params{
+		Width:        200,
+		Height:       150,
+		ToolDiameter: 16,
+		StepOver:     8,
+		Depth:        2,
+		StepDown:     2,
+		Overhang:     60,
+		Strategy:     Spiral,
+		Direction:    Conventional,
+		Feed:         1000,
+		PlungeFeed:   25,
+		Spindle:      10000,
+		SafeZ:        5,
+	}
+}
+
+// Validate checks the parameters
+func (p Params) Validate() error {
+	switch {
+	case p.Region == nil && (p.Width <= 0 || p.Height <= 0):
+		return fmt.Errorf("board size must be positive")
+	case p.Region != nil && len(p.Region) == 0:
+		return fmt.Errorf("no closed contours in the region")
+	case p.Region != nil && p.Registration.active():
+		return fmt.Errorf("a registration corner needs a rectangular board")
+	case p.ToolDiameter <= 0:
+		return fmt.Errorf("tool diameter must be positive")
+	case p.StepOver <= 0 || p.StepOver > p.ToolDiameter:
+		return fmt.Errorf("step over must be between 0 and the tool diameter")
+	case p.Depth <= 0:
+		return fmt.Errorf("depth must be positive")
+	case p.StepDown <= 0:
+		return fmt.Errorf("step down must be positive")
+	case p.Overhang < 0 || p.Overhang > 100:
+		return fmt.Errorf("overhang must be between 0 and 100 percent")
+	case p.Strategy != Spiral && p.Strategy != RasterX && p.Strategy != RasterY:
+		return fmt.Errorf("unknown strategy %q", p.Strategy)
+	case p.Direction != Conventional && p.Direction != Climb && p.Direction != Mixed:
+		return fmt.Errorf("unknown cut direction %q", p.Direction)
+	case p.Feed <= 0:
+		return fmt.Errorf("feed rate must be positive")
+	}
+	if p.Registration.active() {
+		return p.Registration.validate(p)
+	}
+	return nil
+}
+
+// Area returns the rectangle the tool centre covers. The edges are pushed out so the set
+// percentage of the cutter hangs past the board.
+func (p Params) Area() geom.Rect {
+	out := p.ToolDiameter*p.Overhang/100 - p.ToolDiameter/2
+	o := p.Origin
+	return geom.Rect{Min: geom.Point{X: o.X - out, Y: o.Y - out}, Max: geom.Point{X: o.X + p.Width + out, Y: o.Y + p.Height + out}}
+}
+
+// climbRight reports whether a pass should cut with the uncut material on the right of the
+// tool. That is climb milling with a clockwise (M3) spindle and conventional with M4.
+func (p Params) climbRight(pass int) bool {
+	climb := p.Direction == Climb || (p.Direction == Mixed && pass%2 == 1)
+	return climb != p.SpindleCCW
+}
+
+// Paths returns the tool centre paths of one depth pass. On a rectangular board the tool rapids
+// at depth between paths, which only happens back along a row that was just cut, and the first
+// path starts with a lead in from off the board. Region paths, which include boards with a
+// registration fence, are linked as Generate does, see regionPaths.
+func (p Params) Paths(pass int) []geom.Path {
+	p = p.withFence()
+	if p.Region != nil {
+		return p.regionPaths(pass, p.centreField())
+	}
+	a := p.Area()
+	right := p.climbRight(pass)
+	var paths []geom.Path
+	switch p.Strategy {
+	case RasterX:
+		// rows step towards +Y, so rows along -X have the uncut side on their right
+		paths = raster(a, p.StepOver, true, p.Direction != Mixed, right)
+	case RasterY:
+		// rows step towards +X, so rows along +Y have the uncut side on their right
+		paths = raster(a, p.StepOver, false, p.Direction != Mixed, !right)
+	default:
+		// the uncut material is inside the loops, on the right when they run clockwise
+		paths = []geom.Path{spiral(a, p.StepOver, right)}
+	}
+	for i, path := range paths {
+		// drop repeated points where a loop closes onto the next one
+		out := geom.Path{}
+		for _, pt := range path {
+			if len(out) == 0 || out[len(out)-1].Dist(pt) > 1e-9 {
+				out = append(out, pt)
+			}
+		}
+		paths[i] = out
+	}
+	if first := paths[0]; len(first) > 1 {
+		d := first[1].Sub(first[0])
+		lead := first[0].Sub(d.Scale(p.ToolDiameter / d.Len()))
+		paths[0] = append(geom.Path{lead}, first...)
+	}
+	return paths
+}
+
+// spiral walks loops from the outside in, then runs along the middle of the area to clean up
+// the strip the last loop leaves behind. Loops run counter clockwise unless cw is set.
+func spiral(a geom.Rect, step float64, cw bool) geom.Path {
+	if cw {
+		// a clockwise spiral is the counter clockwise one of the transposed area, transposed back
+		t := geom.Rect{Min: geom.Point{X: a.Min.Y, Y: a.Min.X}, Max: geom.Point{X: a.Max.Y, Y: a.Max.X}}
+		path := spiral(t, step, false)
+		for i, pt := range path {
+			path[i] = geom.Point{X: pt.Y, Y: pt.X}
+		}
+		return path
+	}
+	x0, y0, x1, y1 := a.Min.X, a.Min.Y, a.Max.X, a.Max.Y
+	path := geom.Path{}
+	for x1-x0 > 1e-9 && y1-y0 > 1e-9 {
+		path = append(path,
+			geom.Point{X: x0, Y: y0}, geom.Point{X: x1, Y: y0}, geom.Point{X: x1, Y: y1},
+			geom.Point{X: x0, Y: y1}, geom.Point{X: x0, Y: math.Min(y0+step, y1)})
+		x0, y0, x1, y1 = x0+step, y0+step, x1-step, y1-step
+	}
+	c := geom.Point{X: (a.Min.X + a.Max.X) / 2, Y: (a.Min.Y + a.Max.Y) / 2}
+	if h := a.Height() / 2; a.Width() >= a.Height() {
+		path = append(path, geom.Point{X: a.Min.X + h, Y: c.Y}, geom.Point{X: a.Max.X - h, Y: c.Y})
+	} else {
+		w := a.Width() / 2
+		path = append(path, geom.Point{X: c.X, Y: a.Min.Y + w}, geom.Point{X: c.X, Y: a.Max.Y - w})
+	}
+	return path
+}
+
+// raster covers the area with evenly spaced rows so the first and last rows sit on its edges.
+// Bidirectional rows zig-zag in a single path. One way rows all run in the same direction,
+// reversed when back is set, each path stepping over from the previous row start and cutting
+// the next row so the rapid back along the finished row stays in cleared space.
+func raster(a geom.Rect, step float64, alongX, oneWay, back bool) []geom.Path {
+	across := a.Height()
+	if !alongX {
+		across = a.Width()
+	}
+	n := int(math.Ceil(across/step - 1e-9))
+	paths := []geom.Path{{}}
+	for i := 0; i <= n; i++ {
+		t := 0.0
+		if n > 0 {
+			t = float64(i) / float64(n)
+		}
+		var s, e geom.Point
+		if alongX {
+			y := a.Min.Y + t*across
+			s, e = geom.Point{X: a.Min.X, Y: y}, geom.Point{X: a.Max.X, Y: y}
+		} else {
+			x := a.Min.X + t*across
+			s, e = geom.Point{X: x, Y: a.Min.Y}, geom.Point{X: x, Y: a.Max.Y}
+		}
+		switch {
+		case !oneWay:
+			if i%2 == 1 {
+				s, e = e, s
+			}
+			paths[0] = append(paths[0], s, e)
+		case back:
+			s, e = e, s
+			fallthrough
+		default:
+			if i == 0 {
+				paths[0] = geom.Path{s, e}
+				continue
+			}
+			prev := paths[len(paths)-1][len(paths[len(paths)-1])-2]
+			paths = append(paths, geom.Path{prev, s, e})
+		}
+	}
+	return paths
+}
+
+// Generate returns G-code that surfaces the board to depth in as many passes as the step down needs
+func Generate(p Params) (util.Gcode, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	if p.PlungeFeed <= 0 {
+		p.PlungeFeed = p.Feed / 3
+	}
+	p = p.withFence()
+	g := util.Gcode("")
+	g.G90Preamble()
+	g.Add("G0 Z%.3f ; Safe height", p.SafeZ)
+	if p.SpindleCCW {
+		g.Add("M4 S%.0f ; Start spindle counter clockwise", p.Spindle)
+	} else {
+		g.Add("M3 S%.0f ; Start spindle", p.Spindle)
+	}
+	var field *geom.DistanceField
+	if p.Region != nil {
+		field = p.centreField()
+	}
+	for i, z := range pocket.DepthPasses(p.Depth, p.StepDown) {
+		var paths []geom.Path
+		if field != nil {
+			paths = p.regionPaths(i, field)
+		} else {
+			paths = p.Paths(i)
+		}
+		if len(paths) == 0 {
+			return "", fmt.Errorf("tool is too large for the region")
+		}
+		g.Add("; Pass %d, Z%.3f", i+1, z)
+		g.Add("G0 X%.3f Y%.3f", paths[0][0].X, paths[0][0].Y)
+		g.Add("G1 Z%.3f F%.0f", z, p.PlungeFeed)
+		g.Add("G1 F%.0f", p.Feed)
+		for j, path := range paths {
+			prev := paths[max(j-1, 0)]
+			switch {
+			case j == 0:
+			case field == nil:
+				g.Add("G0 X%.3f Y%.3f ; Back along the cut row", path[0].X, path[0].Y)
+			case field.SegmentInside(prev[len(prev)-1], path[0], p.centreLevel()):
+				g.Add("G1 X%.3f Y%.3f", path[0].X, path[0].Y)
+			default:
+				g.Add("G0 Z%.3f", p.SafeZ)
+				g.Add("G0 X%.3f Y%.3f", path[0].X, path[0].Y)
+				g.Add("G1 Z%.3f F%.0f", z, p.PlungeFeed)
+				g.Add("G1 F%.0f", p.Feed)
+			}
+			for _, pt := range path[1:] {
+				g.Add("G1 X%.3f Y%.3f", pt.X, pt.Y)
+			}
+		}
+		g.Add("G0 Z%.3f", p.SafeZ)
+	}
+	g.Add("M5 ; Stop spindle")
+	if err := p.Registration.cut(&g, p); err != nil {
+		return "", err
+	}
+	g.Add("M30 ; End program")
+	return g, nil
+}
@@ -0,0 +1,137 @@
+package surface
+
+import (
+	"testing"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// loops returns the corners of each loop of a spiral, which walks five points per loop
+func loops(path geom.Path) []geom.Path {
+	out := []geom.Path{}
+	for i := 0; i+5 <= len(path)-2; i += 5 {
+		out = append(out, path[i:i+4])
+	}
+	return out
+}
+
+func TestSpiralWinding(t *testing.T) {
+	for _, a := range []geom.Rect{
+		{Min: geom.Point{X: 0, Y: 0}, Max: geom.Point{X: 100, Y: 60}},
+		{Min: geom.Point{X: -10, Y: 5}, Max: geom.Point{X: 30, Y: 90}},
+	} {
+		for _, cw := range []bool{false, true} {
+			l := loops(spiral(a, 8, cw))
+			if len(l) == 0 {
+				t.Fatalf("%v: no loops", a)
+			}
+			for i, loop := range l {
+				if area := loop.Area(); area == 0 || (area < 0) != cw {
+					t.Errorf("%v cw=%v: loop %d has signed area %.3f", a, cw, i, area)
+				}
+			}
+		}
+	}
+}
+
+func TestSpiralDirection(t *testing.T) {
+	tests := []struct {
+		direction string
+		ccw       bool
+		pass      int
+		cw        bool // uncut material on the right of the tool
+	}{
+		{Conventional, false, 0, false},
+		{Climb, false, 0, true},
+		{Conventional, true, 0, true},
+		{Climb, true, 0, false},
+		{Mixed, false, 0, false},
+		{Mixed, false, 1, true},
+	}
+	for _, tt := range tests {
+		p := DefaultParams()
+		p.Direction, p.SpindleCCW = tt.direction, tt.ccw
+		path := p.Paths(tt.pass)[0][1:] // without the lead in
+		if area := path[:4].Area(); (area < 0) != tt.cw {
+			t.Errorf("%s m4=%v pass %d: first loop has signed area %.3f", tt.direction, tt.ccw, tt.pass, area)
+		}
+	}
+}
+
+// rows returns the sign of every row of a raster along X or Y
+func rows(paths []geom.Path, alongX bool) []float64 {
+	signs := []float64{}
+	add := func(s, e geom.Point) {
+		d := e.Y - s.Y
+		if alongX {
+			d = e.X - s.X
+		}
+		if d > 0 {
+			signs = append(signs, 1)
+		} else if d < 0 {
+			signs = append(signs, -1)
+		}
+	}
+	for i, path := range paths {
+		if i == 0 {
+			path = path[1:] // the lead in runs along the first row
+		}
+		if len(paths) == 1 {
+			for j := 1; j < len(path); j++ {
+				add(path[j-1], path[j])
+			}
+			continue
+		}
+		// one way paths step over from the previous row and then cut the next
+		add(path[len(path)-2], path[len(path)-1])
+	}
+	return signs
+}
+
+func TestRasterDirection(t *testing.T) {
+	// rows step towards +Y or +X, conventional milling with M3 keeps the uncut side on the left
+	tests := []struct {
+		strategy  string
+		direction string
+		ccw       bool
+		want      float64 // direction of the first row, every row for one way cuts
+	}{
+		{RasterX, Conventional, false, 1},
+		{RasterX, Climb, false, -1},
+		{RasterX, Conventional, true, -1},
+		{RasterX, Climb, true, 1},
+		{RasterY, Conventional, false, -1},
+		{RasterY, Climb, false, 1},
+		{RasterY, Conventional, true, 1},
+		{RasterY, Climb, true, -1},
+	}
+	for _, tt := range tests {
+		p := DefaultParams()
+		p.Strategy, p.Direction, p.SpindleCCW = tt.strategy, tt.direction, tt.ccw
+		paths := p.Paths(0)
+		signs := rows(paths, tt.strategy == RasterX)
+		if len(paths) < 2 || len(signs) != len(paths) {
+			t.Fatalf("%s %s m4=%v: %d paths with %d rows, want one way rows", tt.strategy, tt.direction, tt.ccw, len(paths), len(signs))
+		}
+		for i, s := range signs {
+			if s != tt.want {
+				t.Errorf("%s %s m4=%v: row %d runs %+.0f, want %+.0f", tt.strategy, tt.direction, tt.ccw, i, s, tt.want)
+			}
+		}
+	}
+
+	for _, strategy := range []string{RasterX, RasterY} {
+		p := DefaultParams()
+		p.Strategy, p.Direction = strategy, Mixed
+		paths := p.Paths(0)
+		signs := rows(paths, strategy == RasterX)
+		if len(paths) != 1 || len(signs) < 3 {
+			t.Fatalf("%s mixed: %d paths with %d rows, want one zig-zag", strategy, len(paths), len(signs))
+		}
+		for i := 1; i < len(signs); i++ {
+			if signs[i] == signs[i-1] {
+				t.Errorf("%s mixed: rows %d and %d run the same way", strategy, i-1, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package text
+
+import (
+	"fmt"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/util"
+)
+
+// EngraveParams controls how strokes are written as G-code
+type EngraveParams struct {
+	Laser      bool
+	Power      float64 // laser S value
+	Spindle    float64 // spindle S value
+	Depth      float64 // spindle engraving depth below Z0
+	SafeZ      float64
+	Feed       float64
+	PlungeFeed float64
+	Relative   bool // strokes are relative to the current position, written as G91 moves that return to it
+}
+
+// Validate checks the parameters
+func (p EngraveParams) Validate() error {
+	switch {
+	case p.Feed <= 0:
+		return fmt.Errorf("feed rate must be positive")
+	case !p.Laser && p.Depth <= 0:
+		return fmt.Errorf("engraving depth must be positive")
+	case !p.Laser && p.SafeZ <= 0:
+		return fmt.Errorf("safe height must be above the surface")
+	}
+	return nil
+}
+
+// Engrave appends the moves that draw paths to g. It writes no preamble or program end so
+// other generators can use it to label their own output. In relative mode the caller must
+// already be in G91, and for spindle engraving the tool must start at SafeZ.
+func Engrave(g *util.Gcode, paths []geom.Path, p EngraveParams) {
+	if p.PlungeFeed <= 0 {
+		p.PlungeFeed = p.Feed
+	}
+	pos := geom.Point{}
+	move := func(code string, to geom.Point, extra string) {
+		x, y := to.X, to.Y
+		if p.Relative {
+			x, y = to.X-pos.X, to.Y-pos.Y
+		}
+		g.Add("%s X%.3f Y%.3f%s", code, x, y, extra)
+		pos = to
+	}
+	plunge, retract := -p.Depth, p.SafeZ
+	if p.Relative {
+		plunge, retract = -(p.SafeZ + p.Depth), p.SafeZ+p.Depth
+	}
+
+	if !p.Laser {
+		g.Add("M3 S%.0f ; Start spindle", p.Spindle)
+	}
+	for _, path := range geom.OrderPaths(paths, false, pos) {
+		if len(path) < 2 {
+			continue
+		}
+		move("G0", path[0], "")
+		if p.Laser {
+			g.Add("M3 S%.0f ; Laser on", p.Power)
+		} else {
+			g.Add("G1 Z%.3f F%.0f", plunge, p.PlungeFeed)
+		}
+		for i, pt := range path[1:] {
+			if i == 0 {
+				move("G1", pt, fmt.Sprintf(" F%.0f", p.Feed))
+				continue
+			}
+			move("G1", pt, "")
+		}
+		if p.Laser {
+			g.Add("M5 ; Laser off")
+		} else {
+			g.Add("G0 Z%.3f", retract)
+		}
+	}
+	if !p.Laser {
+		g.Add("M5 ; Stop spindle")
+	}
+	if p.Relative {
+		move("G0", geom.Point{}, " ; Return to start")
+	}
+}
@@ -0,0 +1,213 @@
+package text
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// capHeight is the height of capital letters in font units
+const capHeight = 21.0
+
+// Align controls where the anchor point sits on each line of text
+type Align int
+
+const (
+	Left Align = iota
+	Center
+	Right
+)
+
+// ParseAlign converts left, center or right to an Align
+func ParseAlign(s string) (Align, error) {
+	switch strings.ToLower(s) {
+	case "left", "l", "":
+		return Left, nil
+	case "center", "centre", "c":
+		return Center, nil
+	case "right", "r":
+		return Right, nil
+	}
+	return Left, fmt.Errorf("unknown alignment %q", s)
+}
+
+// glyph is a single character as pen strokes in font units
+type glyph struct {
+	width   float64
+	strokes []geom.Path
+}
+
+// Font is a single-stroke font
+type Font struct {
+	glyphs map[rune]glyph
+}
+
+var fonts = map[string]*Font{
+	"simplex": loadHershey(simplexGlyphs[:]),
+}
+
+// FontNames returns the embedded font names
+func FontNames() []string {
+	names := []string{}
+	for n := range fonts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetFont returns an embedded font by name
+func GetFont(name string) (*Font, error) {
+	if f, ok := fonts[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown font %q, available: %s", name, strings.Join(FontNames(), ", "))
+}
+
+// loadHershey builds a font from glyph tables starting at ASCII 32
+func loadHershey(table [][]int8) *Font {
+	f := &Font{glyphs: map[rune]glyph{}}
+	for i, data := range table {
+		g := glyph{width: float64(data[0])}
+		stroke := geom.Path{}
+		for k := 1; k+1 < len(data); k += 2 {
+			if data[k] == -1 && data[k+1] == -1 {
+				if len(stroke) > 1 {
+					g.strokes = append(g.strokes, stroke)
+				}
+				stroke = geom.Path{}
+				continue
+			}
+			stroke = append(stroke, geom.Point{X: float64(data[k]), Y: float64(data[k+1])})
+		}
+		if len(stroke) > 1 {
+			g.strokes = append(g.strokes, stroke)
+		}
+		f.glyphs[rune(32+i)] = g
+	}
+	return f
+}
+
+// Options controls the size and placement of text
+type Options struct {
+	Font        string
+	Size        float64 // capital letter height in mm
+	Align       Align
+	Rotation    float64 // degrees counter clockwise about the anchor
+	Spacing     float64 // extra space between characters in mm
+	LineSpacing float64 // distance between baselines as a multiple of Size, 0 uses 1.6
+	ArcRadius   float64 // lay the baseline on a circle around the anchor, positive reads clockwise over the top, negative reads counter clockwise under the bottom
+	ArcAngle    float64 // degrees, where on the circle the aligned point of the text sits
+}
+
+// DefaultOptions returns 5mm simplex text
+func DefaultOptions() Options {
+	return Options{Font: "simplex", Size: 5}
+}
+
+func (o Options) scale() float64 { return o.Size / capHeight }
+
+// Width returns the width of a single line of text in mm
+func (f *Font) Width(line string, o Options) float64 {
+	w := 0.0
+	n := 0
+	for _, r := range line {
+		g, ok := f.glyphs[r]
+		if !ok {
+			g = f.glyphs['?']
+		}
+		w += g.width * o.scale()
+		n++
+	}
+	if n > 1 {
+		w += float64(n-1) * o.Spacing
+	}
+	return w
+}
+
+// Strokes lays out s, which may hold several lines, and returns the pen strokes in mm. The
+// anchor is on the baseline of the first line, at the left, centre or right edge depending on
+// the alignment. Characters the font does not have are drawn as '?'.
+func Strokes(s string, at geom.Point, o Options) ([]geom.Path, error) {
+	if o.Size <= 0 {
+		return nil, fmt.Errorf("text size must be positive")
+	}
+	if o.Font == "" {
+		o.Font = "simplex"
+	}
+	f, err := GetFont(o.Font)
+	if err != nil {
+		return nil, err
+	}
+	lineSpacing := o.LineSpacing
+	if lineSpacing <= 0 {
+		lineSpacing = 1.6
+	}
+	sc := o.scale()
+
+	// lay out in text space, x along the baseline and y up
+	local := []geom.Path{}
+	for li, line := range strings.Split(s, "\n") {
+		x := 0.0
+		switch o.Align {
+		case Center:
+			x = -f.Width(line, o) / 2
+		case Right:
+			x = -f.Width(line, o)
+		}
+		y := -float64(li) * o.Size * lineSpacing
+		for _, r := range line {
+			g, ok := f.glyphs[r]
+			if !ok {
+				g = f.glyphs['?']
+			}
+			for _, st := range g.strokes {
+				p := make(geom.Path, len(st))
+				for i, pt := range st {
+					p[i] = geom.Point{X: x + pt.X*sc, Y: y + pt.Y*sc}
+				}
+				local = append(local, p)
+			}
+			x += g.width*sc + o.Spacing
+		}
+	}
+
+	out := make([]geom.Path, 0, len(local))
+	for _, p := range local {
+		if o.ArcRadius != 0 {
+			// on an arc the rotation turns the text around the arc centre
+			out = append(out, onArc(p, at, o.ArcRadius, (o.ArcAngle+o.Rotation)*math.Pi/180, o.Size/10))
+			continue
+		}
+		out = append(out, p.Transform(o.Rotation*math.Pi/180, at))
+	}
+	return out, nil
+}
+
+// onArc bends a stroke from text space onto a circle around c. Segments are split to maxSeg so
+// long strokes follow the curve.
+func onArc(p geom.Path, c geom.Point, radius, angle, maxSeg float64) geom.Path {
+	dense := geom.Path{p[0]}
+	for i := 1; i < len(p); i++ {
+		n := int(math.Ceil(p[i].Dist(p[i-1]) / maxSeg))
+		for k := 1; k <= n; k++ {
+			dense = append(dense, p[i-1].Lerp(p[i], float64(k)/float64(n)))
+		}
+	}
+	out := make(geom.Path, len(dense))
+	for i, pt := range dense {
+		var a, r float64
+		if radius > 0 {
+			// reading clockwise over the top, letters point away from the centre
+			a, r = angle-pt.X/radius, radius+pt.Y
+		} else {
+			// reading counter clockwise under the bottom, letters point toward the centre
+			a, r = angle+pt.X/-radius, -radius-pt.Y
+		}
+		out[i] = geom.Point{X: c.X + r*math.Cos(a), Y: c.Y + r*math.Sin(a)}
+	}
+	return out
+}
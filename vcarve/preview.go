@@ -0,0 +1,82 @@
+package vcarve
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/redt1de/cnctools/geom"
+)
+
+// Preview writes an SVG picture of the finished carve. Each cut is drawn as wide as the groove it
+// leaves at the surface and shaded by depth, flat floors are filled and the contours outlined.
+func Preview(w io.Writer, shapes []geom.Shape, cuts []Cut, flat []geom.Shape, p Params) error {
+	b := geom.EmptyRect()
+	for _, s := range shapes {
+		b = b.Union(s.Bounds())
+	}
+	if b.Empty() {
+		return fmt.Errorf("nothing to preview")
+	}
+	pad := math.Max(b.Width(), b.Height()) * 0.05
+	deepest := p.reach() / p.slope()
+
+	type stroke struct {
+		a, b  geom.Point
+		depth float64
+	}
+	strokes := []stroke{}
+	for _, c := range cuts {
+		for i := range c.Path {
+			k := (i + 1) % len(c.Path)
+			strokes = append(strokes, stroke{c.Path[i], c.Path[k], (c.Depth[i] + c.Depth[k]) / 2})
+		}
+	}
+	// shallow strokes first so the deep middle of each groove stays on top
+	sort.SliceStable(strokes, func(i, j int) bool { return strokes[i].depth < strokes[j].depth })
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%.3fmm" height="%.3fmm" viewBox="%.3f %.3f %.3f %.3f">`+"\n",
+		b.Width()+2*pad, b.Height()+2*pad, b.Min.X-pad, -b.Max.Y-pad, b.Width()+2*pad, b.Height()+2*pad)
+	fmt.Fprintf(bw, `<rect x="%.3f" y="%.3f" width="%.3f" height="%.3f" fill="#e8d5b0"/>`+"\n",
+		b.Min.X-pad, -b.Max.Y-pad, b.Width()+2*pad, b.Height()+2*pad)
+	fmt.Fprintln(bw, `<g transform="scale(1,-1)">`)
+	for _, s := range flat {
+		fmt.Fprintf(bw, `<path d="%s" fill="%s" fill-rule="evenodd"/>`+"\n", svgPath(s.Rings()), shade(1))
+	}
+	for _, s := range strokes {
+		fmt.Fprintf(bw, `<line x1="%.3f" y1="%.3f" x2="%.3f" y2="%.3f" stroke="%s" stroke-width="%.3f" stroke-linecap="round"/>`+"\n",
+			s.a.X, s.a.Y, s.b.X, s.b.Y, shade(s.depth/deepest), math.Max(2*s.depth*p.slope(), 0.01))
+	}
+	for _, s := range shapes {
+		fmt.Fprintf(bw, `<path d="%s" fill="none" stroke="#c00000" stroke-width="%.3f"/>`+"\n", svgPath(s.Rings()), pad/50)
+	}
+	fmt.Fprintln(bw, "</g>")
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// shade maps a relative depth from 0 to 1 to a colour running from light to dark wood
+func shade(t float64) string {
+	t = math.Max(0, math.Min(1, t))
+	r, g, b := 200-140*t, 160-120*t, 110-90*t
+	return fmt.Sprintf("#%02x%02x%02x", int(r), int(g), int(b))
+}
+
+func svgPath(rings []geom.Path) string {
+	var d strings.Builder
+	for _, r := range rings {
+		for i, pt := range r {
+			cmd := "L"
+			if i == 0 {
+				cmd = "M"
+			}
+			fmt.Fprintf(&d, "%s%.3f %.3f ", cmd, pt.X, pt.Y)
+		}
+		d.WriteString("Z ")
+	}
+	return d.String()
+}
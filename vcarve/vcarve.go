@@ -0,0 +1,316 @@
+package vcarve
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/redt1de/cnctools/geom"
+	"github.com/redt1de/cnctools/pocket"
+	"github.com/redt1de/cnctools/util"
+)
+
+// Params configures a V-carve, all distances in mm with the stock top at Z0
+type Params struct {
+	Angle        float64 // included angle of the V-bit in degrees
+	ToolDiameter float64 // V-bit diameter, the carve never goes deeper than the full cone
+	MaxDepth     float64 // depth cap, 0 leaves only the tool diameter limit
+	StepDown     float64 // max depth per pass, 0 cuts in one pass
+	Feed         float64
+	PlungeFeed   float64
+	Spindle      float64
+	SafeZ        float64
+	Resolution   float64 // distance field grid spacing, 0 picks one from the tool size
+
+	// Clearing removes the flat floor left where the depth is capped with an end mill before
+	// the V-bit runs. Depth, SafeZ and Resolution are filled in from the V-carve. nil skips it.
+	Clearing *pocket.Params
+}
+
+// DefaultParams returns settings for a 90 degree, 1/4" V-bit
+func DefaultParams() Params {
+	return Params{
+		Angle:        90,
+		ToolDiameter: 6.35,
+		Feed:         800,
+		PlungeFeed:   200,
+		Spindle:      16000,
+		SafeZ:        5,
+	}
+}
+
+// Validate checks the parameters
+func (p Params) Validate() error {
+	switch {
+	case p.Angle <= 0 || p.Angle >= 180:
+		return fmt.Errorf("V-bit angle must be between 0 and 180 degrees")
+	case p.ToolDiameter <= 0:
+		return fmt.Errorf("tool diameter must be positive")
+	case p.MaxDepth < 0:
+		return fmt.Errorf("max depth can not be negative")
+	case p.StepDown < 0:
+		return fmt.Errorf("step down can not be negative")
+	case p.Feed <= 0:
+		return fmt.Errorf("feed rate must be positive")
+	}
+	if p.Clearing != nil {
+		c := *p.Clearing
+		c.Depth = 1
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("clearing tool: %v", err)
+		}
+	}
+	return nil
+}
+
+// slope is the cut radius at the surface per unit of depth
+func (p Params) slope() float64 { return math.Tan(p.Angle / 2 * math.Pi / 180) }
+
+// reach is the largest surface radius the tool may cut, set by the tool diameter or the depth cap
+func (p Params) reach() float64 {
+	r := p.ToolDiameter / 2
+	if p.MaxDepth > 0 {
+		r = math.Min(r, p.MaxDepth*p.slope())
+	}
+	return r
+}
+
+// Cut is one closed V-carve toolpath with the positive depth below Z0 at each point
+type Cut struct {
+	Path  geom.Path
+	Depth []float64
+}
+
+// MaxDepth returns the deepest point of the cut
+func (c Cut) MaxDepth() float64 {
+	d := 0.0
+	for _, v := range c.Depth {
+		d = math.Max(d, v)
+	}
+	return d
+}
+
+// Carve computes the V-bit toolpaths for the shapes. Every boundary point is followed by the
+// centre of the largest circle inside the shape that touches it, which traces the medial axis,
+// and the tool sinks until its cone fills that circle. Where the circle is larger than the tool
+// allows the depth is capped, and those floors are returned as flat areas for a clearing tool.
+func Carve(shapes []geom.Shape, p Params) ([]Cut, []geom.Shape, error) {
+	if err := p.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if len(shapes) == 0 {
+		return nil, nil, fmt.Errorf("no closed contours to carve")
+	}
+	res := p.Resolution
+	if res <= 0 {
+		res = math.Max(p.reach()/50, 0.02)
+	}
+	reach := p.reach()
+	field := geom.NewBandedField(shapes, res, reach+4*res)
+	step := field.Res / 2
+
+	cuts := []Cut{}
+	capped := false
+	for _, s := range shapes {
+		for _, ring := range s.Rings() {
+			c := Cut{}
+			for _, b := range boundarySamples(ring, step) {
+				r := inscribed(field, b.at, b.normal, reach)
+				if r >= reach-field.Res {
+					capped = true
+				}
+				c.Path = append(c.Path, b.at.Add(b.normal.Scale(r)))
+				c.Depth = append(c.Depth, r/p.slope())
+			}
+			if c = c.simplify(field.Res * 0.1); len(c.Path) > 1 {
+				cuts = append(cuts, c)
+			}
+		}
+	}
+	flat := []geom.Shape{}
+	if capped {
+		flat = field.Offset(reach)
+	}
+	return cuts, flat, nil
+}
+
+type sample struct {
+	at, normal geom.Point
+}
+
+// boundarySamples walks a ring at the given spacing pairing each point with the unit normal to
+// the left, which points into the material for rings oriented as geom.Nest returns them. Around
+// reflex corners the normal sweeps so the tool rolls around the corner.
+func boundarySamples(ring geom.Path, step float64) []sample {
+	out := []sample{}
+	n := len(ring)
+	normal := func(a, b geom.Point) geom.Point {
+		d := b.Sub(a)
+		l := d.Len()
+		return geom.Point{X: -d.Y / l, Y: d.X / l}
+	}
+	for i := 0; i < n; i++ {
+		a, b, c := ring[i], ring[(i+1)%n], ring[(i+2)%n]
+		if a.Dist(b) < 1e-9 {
+			continue
+		}
+		n1 := normal(a, b)
+		k := int(math.Ceil(a.Dist(b) / step))
+		for j := 0; j <= k; j++ {
+			out = append(out, sample{a.Lerp(b, float64(j)/float64(k)), n1})
+		}
+		if b.Dist(c) < 1e-9 {
+			continue
+		}
+		n2 := normal(b, c)
+		if turn := b.Sub(a).Cross(c.Sub(b)); turn < 0 {
+			a1 := math.Atan2(n1.Y, n1.X)
+			sweep := math.Atan2(n1.Cross(n2), n1.Dot(n2))
+			m := int(math.Ceil(math.Abs(sweep) / (10 * math.Pi / 180)))
+			for j := 1; j < m; j++ {
+				t := a1 + sweep*float64(j)/float64(m)
+				out = append(out, sample{b, geom.Point{X: math.Cos(t), Y: math.Sin(t)}})
+			}
+		}
+	}
+	return out
+}
+
+// inscribed returns the radius of the largest circle inside the field that touches b with its
+// centre along the inward normal n, up to limit
+func inscribed(f *geom.DistanceField, b, n geom.Point, limit float64) float64 {
+	tol := f.Res / 2
+	fits := func(t float64) bool { return f.At(b.Add(n.Scale(t))) >= t-tol }
+	lo, hi := 0.0, limit
+	for t := f.Res / 2; ; t += f.Res / 2 {
+		if t >= limit {
+			if fits(limit) {
+				return limit
+			}
+			hi = limit
+			break
+		}
+		if !fits(t) {
+			hi = t
+			break
+		}
+		lo = t
+	}
+	for i := 0; i < 8; i++ {
+		mid := (lo + hi) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// simplify drops points that lie within tol of the line through their neighbours in XYZ
+func (c Cut) simplify(tol float64) Cut {
+	out := Cut{}
+	for i := range c.Path {
+		if n := len(out.Path); n >= 2 {
+			a, b := out.Path[n-2], out.Path[n-1]
+			za, zb := out.Depth[n-2], out.Depth[n-1]
+			q, zq := c.Path[i], c.Depth[i]
+			// distance of b from segment a-q in 3D
+			ab := [3]float64{b.X - a.X, b.Y - a.Y, zb - za}
+			aq := [3]float64{q.X - a.X, q.Y - a.Y, zq - za}
+			l := aq[0]*aq[0] + aq[1]*aq[1] + aq[2]*aq[2]
+			t := 0.0
+			if l > 0 {
+				t = math.Max(0, math.Min(1, (ab[0]*aq[0]+ab[1]*aq[1]+ab[2]*aq[2])/l))
+			}
+			dx, dy, dz := ab[0]-aq[0]*t, ab[1]-aq[1]*t, ab[2]-aq[2]*t
+			if math.Sqrt(dx*dx+dy*dy+dz*dz) < tol {
+				out.Path, out.Depth = out.Path[:n-1], out.Depth[:n-1]
+			}
+		}
+		out.Path = append(out.Path, c.Path[i])
+		out.Depth = append(out.Depth, c.Depth[i])
+	}
+	return out
+}
+
+// Generate returns G-code for the V-carve, preceded by the clearing pass and a tool change when
+// p.Clearing is set and part of the carve reaches the depth cap
+func Generate(shapes []geom.Shape, p Params) (util.Gcode, error) {
+	cuts, flat, err := Carve(shapes, p)
+	if err != nil {
+		return "", err
+	}
+	if p.PlungeFeed <= 0 {
+		p.PlungeFeed = p.Feed / 3
+	}
+	g := util.Gcode("")
+	g.G90Preamble()
+	g.Add("G0 Z%.3f ; Safe height", p.SafeZ)
+	if p.Clearing != nil && len(flat) > 0 {
+		c := *p.Clearing
+		c.Depth, c.SafeZ, c.Resolution = p.reach()/p.slope(), p.SafeZ, p.Resolution
+		g.Add("; Clear flat areas with a %.3fmm end mill", c.ToolDiameter)
+		if err := pocket.Cut(&g, flat, c); err != nil {
+			return "", fmt.Errorf("clearing: %v", err)
+		}
+		g.Add("M0 ; Change tool to the %.0f degree V-bit and resume", p.Angle)
+	}
+	g.Add("M3 S%.0f ; Start spindle", p.Spindle)
+
+	deepest := 0.0
+	for _, c := range cuts {
+		deepest = math.Max(deepest, c.MaxDepth())
+	}
+	stepDown := p.StepDown
+	if stepDown <= 0 {
+		stepDown = deepest
+	}
+	prev := 0.0
+	for li, z := range pocket.DepthPasses(deepest, stepDown) {
+		g.Add("; Pass %d, Z%.3f", li+1, z)
+		pos := geom.Point{}
+		for _, c := range order(cuts, pos) {
+			if c.MaxDepth() <= prev+1e-6 {
+				continue
+			}
+			g.Add("G0 X%.3f Y%.3f", c.Path[0].X, c.Path[0].Y)
+			g.Add("G1 Z%.3f F%.0f", math.Max(-c.Depth[0], z), p.PlungeFeed)
+			g.Add("G1 F%.0f", p.Feed)
+			for i := 1; i <= len(c.Path); i++ {
+				k := i % len(c.Path)
+				g.Add("G1 X%.3f Y%.3f Z%.3f", c.Path[k].X, c.Path[k].Y, math.Max(-c.Depth[k], z))
+			}
+			g.Add("G0 Z%.3f", p.SafeZ)
+			pos = c.Path[0]
+		}
+		prev = -z
+	}
+	g.Add("M5 ; Stop spindle")
+	g.Add("M30 ; End program")
+	return g, nil
+}
+
+// order sorts the closed cuts nearest first, starting each at its point closest to the tool
+func order(cuts []Cut, start geom.Point) []Cut {
+	left := append([]Cut{}, cuts...)
+	out := make([]Cut, 0, len(cuts))
+	cur := start
+	for len(left) > 0 {
+		bi, bk, bd := 0, 0, math.Inf(1)
+		for i, c := range left {
+			for k, pt := range c.Path {
+				if d := pt.Dist(cur); d < bd {
+					bi, bk, bd = i, k, d
+				}
+			}
+		}
+		c := left[bi]
+		left = append(left[:bi], left[bi+1:]...)
+		out = append(out, Cut{
+			Path:  append(append(geom.Path{}, c.Path[bk:]...), c.Path[:bk]...),
+			Depth: append(append([]float64{}, c.Depth[bk:]...), c.Depth[:bk]...),
+		})
+		cur = c.Path[bk]
+	}
+	return out
+}
@@ -0,0 +1,202 @@
+package zero
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/grbl"
+)
+
+// Controller runs a line and returns what it answered, a *grbl.Conn is one
+type Controller interface {
+	Command(line string) ([]string, error)
+}
+
+// Result is what a live routine found, in machine coordinates
+type Result struct {
+	Zero     map[byte]float64 // machine position of the new work zero per axis
+	Diameter float64          // bore or boss diameter
+}
+
+// runner sends a routine to a controller
+type runner struct {
+	c    Controller
+	p    Params
+	zero map[byte]float64
+}
+
+// send runs lines in order
+func (r *runner) send(lines ...string) error {
+	for _, l := range lines {
+		if _, err := r.c.Command(l); err != nil {
+			return fmt.Errorf("%s: %v", l, err)
+		}
+	}
+	return nil
+}
+
+// touch probes along an axis and returns the machine position the slow touch triggered at
+func (r *runner) touch(axis byte, dir float64) (float64, error) {
+	moves := r.p.touch(axis, dir)
+	if err := r.send(moves[:2]...); err != nil {
+		return 0, err
+	}
+	lines, err := r.c.Command(moves[2])
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", moves[2], err)
+	}
+	pos, err := grbl.ProbeResult(lines)
+	if err != nil {
+		return 0, err
+	}
+	i := strings.IndexByte(gcode.AxisLetters, axis)
+	if i >= len(pos) {
+		return 0, fmt.Errorf("the controller does not report %c", axis)
+	}
+	return pos[i], nil
+}
+
+// set moves an axis to machine position at and makes the work zero land on machine position
+// zero with G10 L20. The G53 move leaves the tool exactly where the offset is taken from.
+func (r *runner) set(axis byte, at, zero float64) error {
+	r.zero[axis] = zero
+	return r.send(fmt.Sprintf("G53 G0 %c%s", axis, num(at)), r.p.set(axis, at-zero))
+}
+
+// Run drives the routine on a controller, working the zero out from the probe positions. The
+// bore and boss end with the tool over the centre.
+func Run(c Controller, p Params) (Result, error) {
+	if err := p.Validate(); err != nil {
+		return Result{}, err
+	}
+	r := &runner{c: c, p: p, zero: map[byte]float64{}}
+	res, err := r.run()
+	if err != nil {
+		return res, err
+	}
+	res.Zero = r.zero
+	return res, r.send("G90")
+}
+
+func (r *runner) run() (Result, error) {
+	p := r.p
+	rad := p.Tool / 2
+	res := Result{}
+	if err := r.send("G21", "G91"); err != nil {
+		return res, err
+	}
+	// face touches off a side and returns the machine position of the face
+	face := func(axis byte, dir float64) (float64, error) {
+		t, err := r.touch(axis, dir)
+		return t + dir*rad, err
+	}
+	// surface touches the plate and sets Z
+	surface := func() error {
+		t, err := r.touch('Z', -1)
+		if err != nil {
+			return err
+		}
+		return r.set('Z', t+p.PullOff, t-p.Plate)
+	}
+	// centre finds the middle of two faces along an axis. Inside a bore the tool crosses
+	// between them, round a boss it goes up and over.
+	centre := func(axis byte) (float64, float64, error) {
+		if p.Routine == Bore {
+			a, err := face(axis, 1)
+			if err != nil {
+				return 0, 0, err
+			}
+			b, err := face(axis, -1)
+			if err != nil {
+				return 0, 0, err
+			}
+			return (a + b) / 2, a - b, nil
+		}
+		out := p.Size/2 + p.Clearance
+		if err := r.send(fmt.Sprintf("G0 %c%s", axis, num(out)), fmt.Sprintf("G0 Z%s", num(-p.Depth))); err != nil {
+			return 0, 0, err
+		}
+		t, err := r.touch(axis, -1)
+		if err != nil {
+			return 0, 0, err
+		}
+		a := t - rad
+		err = r.send(fmt.Sprintf("G0 %c%s", axis, num(p.PullOff)), fmt.Sprintf("G0 Z%s", num(p.Depth)),
+			fmt.Sprintf("G53 G0 %c%s", axis, num(t-p.Size-p.Tool-p.Clearance)), fmt.Sprintf("G0 Z%s", num(-p.Depth)))
+		if err != nil {
+			return 0, 0, err
+		}
+		b, err := face(axis, 1)
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := r.send(fmt.Sprintf("G0 %c%s", axis, num(-p.PullOff)), fmt.Sprintf("G0 Z%s", num(p.Depth))); err != nil {
+			return 0, 0, err
+		}
+		return (a + b) / 2, a - b, nil
+	}
+
+	switch p.Routine {
+	case Surface:
+		return res, surface()
+	case Edge:
+		dir := 1.0
+		if p.Negative {
+			dir = -1
+		}
+		t, err := r.touch(p.Axis, dir)
+		if err != nil {
+			return res, err
+		}
+		return res, r.set(p.Axis, t-dir*p.PullOff, t+dir*(rad+p.Wall))
+	case Corner:
+		dx, dy, _ := p.directions()
+		up := p.PullOff + p.Depth
+		if err := surface(); err != nil {
+			return res, err
+		}
+		if err := r.send(fmt.Sprintf("G0 X%s", num(-dx*p.Clearance)), fmt.Sprintf("G0 Z%s", num(-up))); err != nil {
+			return res, err
+		}
+		t, err := r.touch('X', dx)
+		if err != nil {
+			return res, err
+		}
+		x := t + dx*(rad+p.Wall)
+		if err := r.set('X', t-dx*p.PullOff, x); err != nil {
+			return res, err
+		}
+		err = r.send(fmt.Sprintf("G0 Z%s", num(up)), fmt.Sprintf("G53 G0 X%s", num(x+dx*p.Clearance/2)),
+			fmt.Sprintf("G0 Y%s", num(-dy*p.Clearance)), fmt.Sprintf("G0 Z%s", num(-up)))
+		if err != nil {
+			return res, err
+		}
+		if t, err = r.touch('Y', dy); err != nil {
+			return res, err
+		}
+		if err := r.set('Y', t-dy*p.PullOff, t+dy*(rad+p.Wall)); err != nil {
+			return res, err
+		}
+		return res, r.send(fmt.Sprintf("G0 Z%s", num(up)))
+	}
+
+	cx, _, err := centre('X')
+	if err != nil {
+		return res, err
+	}
+	if err := r.send(fmt.Sprintf("G53 G0 X%s", num(cx))); err != nil {
+		return res, err
+	}
+	// the Y chord runs through the X centre, so it is the diameter
+	cy, d, err := centre('Y')
+	if err != nil {
+		return res, err
+	}
+	if err := r.send(fmt.Sprintf("G53 G0 Y%s", num(cy))); err != nil {
+		return res, err
+	}
+	res.Diameter = d
+	r.zero['X'], r.zero['Y'] = cx, cy
+	return res, r.send(fmt.Sprintf("G10 L20 P%d X0 Y0", p.System))
+}
@@ -0,0 +1,64 @@
+package zero
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxRotation is the largest stock rotation believed, more is a missed touch or the wrong edge
+const maxRotation = 10
+
+// Rotation returns how many degrees counter clockwise an edge along axis is turned, from two
+// touches span apart along it. t1 and t2 are the positions across the edge, they carry the
+// same tool radius so it cancels.
+func Rotation(axis byte, t1, t2, span float64) (float64, error) {
+	if span == 0 {
+		return 0, fmt.Errorf("the two touches need to be apart along the edge")
+	}
+	angle := math.Atan((t2-t1)/span) * 180 / math.Pi
+	if axis == 'Y' {
+		// an edge along Y turned counter clockwise leans towards -X
+		angle = -angle
+	}
+	if math.Abs(angle) > maxRotation {
+		return 0, fmt.Errorf("the edge is turned %.2f degrees, more than %d, check the touches", angle, maxRotation)
+	}
+	return angle, nil
+}
+
+// ProbeRotation touches an edge running along p.Axis twice, p.Span apart, and returns how far
+// the stock is turned. The tool starts beside the edge below its top and probes across it in
+// the positive direction, or the negative one with p.Negative.
+func ProbeRotation(c Controller, p Params) (float64, error) {
+	p.Routine = Edge
+	if err := p.Validate(); err != nil {
+		return 0, err
+	}
+	across, dir := byte('Y'), 1.0
+	if p.Axis == 'Y' {
+		across = 'X'
+	}
+	if p.Negative {
+		dir = -1
+	}
+	r := &runner{c: c, p: p, zero: map[byte]float64{}}
+	if err := r.send("G21", "G91"); err != nil {
+		return 0, err
+	}
+	t1, err := r.touch(across, dir)
+	if err != nil {
+		return 0, err
+	}
+	back := fmt.Sprintf("G0 %c%s", across, num(-dir*p.PullOff))
+	if err := r.send(back, fmt.Sprintf("G0 %c%s", p.Axis, num(p.Span))); err != nil {
+		return 0, err
+	}
+	t2, err := r.touch(across, dir)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.send(back, "G90"); err != nil {
+		return 0, err
+	}
+	return Rotation(p.Axis, t1, t2, p.Span)
+}
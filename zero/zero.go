@@ -0,0 +1,174 @@
+package zero
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/redt1de/cnctools/gcode"
+	"github.com/redt1de/cnctools/util"
+)
+
+// routines
+const (
+	Surface = "z"      // touch plate on the surface
+	Edge    = "edge"   // one side of the stock
+	Corner  = "corner" // XYZ touch plate on a corner
+	Bore    = "bore"   // centre of a hole, live only
+	Boss    = "boss"   // centre of a round boss, live only
+)
+
+// Params configures a zeroing routine. Each routine starts where the user jogged the tool:
+//   - z: over the touch plate
+//   - edge: beside the stock, below its top, probing along Axis
+//   - corner: over the corner plate, closer than Clearance minus Wall and the tool radius to
+//     both faces
+//   - bore: inside the hole, below its top
+//   - boss: over the middle of the boss, Depth above where the sides are probed
+type Params struct {
+	Routine   string
+	System    int     // 1 to 6 for G54 to G59
+	Axis      byte    // X or Y, for edge
+	Negative  bool    // edge probes towards -Axis
+	Corner    string  // stock corner, front-left, front-right, back-left or back-right
+	Tool      float64 // tool or probe tip diameter
+	Plate     float64 // touch plate thickness
+	Wall      float64 // plate wall between the probed face and the stock, for edge and corner
+	Size      float64 // rough boss diameter
+	Travel    float64 // furthest each probe move goes
+	Feed      float64
+	LatchFeed float64 // slow second touch
+	PullOff   float64 // backing off between the two touches
+	Clearance float64 // how far past a face the tool goes down
+	Depth     float64 // how far the tool goes down to probe a side
+	Span      float64 // distance along the edge between the two touches of ProbeRotation
+}
+
+// DefaultParams returns a corner routine into G54 with a 6mm tool
+func DefaultParams() Params {
+	return Params{
+		Routine:   Corner,
+		System:    1,
+		Axis:      'X',
+		Corner:    "front-left",
+		Tool:      6,
+		Plate:     10,
+		Wall:      5,
+		Size:      20,
+		Travel:    25,
+		Feed:      100,
+		LatchFeed: 20,
+		PullOff:   2,
+		Clearance: 15,
+		Depth:     5,
+		Span:      50,
+	}
+}
+
+// Validate checks the parameters
+func (p Params) Validate() error {
+	switch {
+	case p.Routine != Surface && p.Routine != Edge && p.Routine != Corner && p.Routine != Bore && p.Routine != Boss:
+		return fmt.Errorf("unknown routine %q", p.Routine)
+	case p.System < 1 || p.System > 6:
+		return fmt.Errorf("coordinate system must be 1 to 6 for G54 to G59")
+	case p.Routine == Edge && p.Axis != 'X' && p.Axis != 'Y':
+		return fmt.Errorf("edges are probed along X or Y")
+	case p.Tool < 0 || p.Plate < 0 || p.Wall < 0:
+		return fmt.Errorf("tool, plate and wall sizes can not be negative")
+	case p.Travel <= 0 || p.PullOff <= 0 || p.PullOff >= p.Travel:
+		return fmt.Errorf("travel and pull off must be positive, and the pull off less than the travel")
+	case p.Feed <= 0 || p.LatchFeed <= 0:
+		return fmt.Errorf("feed rates must be positive")
+	case (p.Routine == Corner || p.Routine == Boss) && (p.Clearance <= 0 || p.Depth <= 0):
+		return fmt.Errorf("clearance and depth must be positive")
+	case p.Routine == Boss && p.Size <= 0:
+		return fmt.Errorf("boss size must be positive")
+	}
+	if p.Routine == Corner {
+		if _, _, err := p.directions(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// directions returns which way the stock lies from the corner in X and Y
+func (p Params) directions() (float64, float64, error) {
+	switch strings.ToLower(p.Corner) {
+	case "front-left", "fl":
+		return 1, 1, nil
+	case "front-right", "fr":
+		return -1, 1, nil
+	case "back-left", "bl":
+		return 1, -1, nil
+	case "back-right", "br":
+		return -1, -1, nil
+	}
+	return 0, 0, fmt.Errorf("unknown corner %q", p.Corner)
+}
+
+// num formats a value for a line
+func num(v float64) string {
+	return gcode.FormatNumber(v)
+}
+
+// touch returns the relative moves that touch off along an axis, fast and then slowly
+func (p Params) touch(axis byte, dir float64) []string {
+	return []string{
+		fmt.Sprintf("G38.2 %c%s F%s", axis, num(dir*p.Travel), num(p.Feed)),
+		fmt.Sprintf("G0 %c%s", axis, num(-dir*p.PullOff)),
+		fmt.Sprintf("G38.2 %c%s F%s", axis, num(dir*2*p.PullOff), num(p.LatchFeed)),
+	}
+}
+
+// set returns the line that makes the current position read v on an axis
+func (p Params) set(axis byte, v float64) string {
+	return fmt.Sprintf("G10 L20 P%d %c%s", p.System, axis, num(v))
+}
+
+// Program returns the routine as a program that sets the work offsets where the probe
+// triggers. The bore and boss centres need the positions read back, they only run live.
+func Program(p Params) (util.Gcode, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	r := p.Tool / 2
+	g := util.Gcode("")
+	g.G91Preamble()
+	add := func(lines ...string) {
+		for _, l := range lines {
+			g.Add(l)
+		}
+	}
+	switch p.Routine {
+	case Surface:
+		add(p.touch('Z', -1)...)
+		add(p.set('Z', p.Plate), fmt.Sprintf("G0 Z%s ; Clear the plate", num(p.PullOff)))
+	case Edge:
+		dir := 1.0
+		if p.Negative {
+			dir = -1
+		}
+		add(p.touch(p.Axis, dir)...)
+		add(p.set(p.Axis, -dir*(r+p.Wall)), fmt.Sprintf("G0 %c%s", p.Axis, num(-dir*p.PullOff)))
+	case Corner:
+		dx, dy, _ := p.directions()
+		up := p.PullOff + p.Depth
+		g.Add("; Top")
+		add(p.touch('Z', -1)...)
+		add(p.set('Z', p.Plate), fmt.Sprintf("G0 Z%s", num(p.PullOff)))
+		g.Add("; X face")
+		add(fmt.Sprintf("G0 X%s", num(-dx*p.Clearance)), fmt.Sprintf("G0 Z%s", num(-up)))
+		add(p.touch('X', dx)...)
+		add(p.set('X', -dx*(r+p.Wall)), fmt.Sprintf("G0 X%s", num(-dx*p.PullOff)), fmt.Sprintf("G0 Z%s", num(up)))
+		g.Add("; Y face")
+		add(fmt.Sprintf("G90 G0 X%s", num(dx*p.Clearance/2)), "G91", fmt.Sprintf("G0 Y%s", num(-dy*p.Clearance)), fmt.Sprintf("G0 Z%s", num(-up)))
+		add(p.touch('Y', dy)...)
+		add(p.set('Y', -dy*(r+p.Wall)), fmt.Sprintf("G0 Y%s", num(-dy*p.PullOff)), fmt.Sprintf("G0 Z%s", num(up)))
+	default:
+		return "", fmt.Errorf("the %s centre is worked out from the probe positions, run it on the controller", p.Routine)
+	}
+	g.Add("G90")
+	g.Add("M30 ; End program")
+	return g, nil
+}